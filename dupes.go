@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/adaptive-scale/superscan/pkg/config"
+	"github.com/adaptive-scale/superscan/pkg/dupes"
+	"github.com/adaptive-scale/superscan/pkg/source"
+)
+
+// openSource creates the source named by a type:path spec and returns it with its start path
+func openSource(ctx context.Context, spec string, cfg *config.Config) (source.Source, string, error) {
+	sourceType, startPath, _ := strings.Cut(spec, ":")
+	src, err := source.NewSource(ctx, sourceType, cfg)
+	return src, startPath, err
+}
+
+// runDupes implements the dupes command, which finds identical files across sources
+func runDupes(args []string) {
+	fs := flag.NewFlagSet("dupes", flag.ExitOnError)
+	var sources stringList
+	fs.Var(&sources, "source", "Source to search as type:path, e.g. filesystem:/data or s3:exports/ (repeatable)")
+	hashName := fs.String("hash", "sha256", "Hash used to compare file contents (sha256|blake3)")
+	images := fs.Bool("images", false, "Also group images that look identical, e.g. resized or recompressed copies")
+	configPath := fs.String("config", "", "Path to configuration file (optional)")
+	timeout := fs.Duration("timeout", 0, "Stop after this long, reporting the duplicates found so far, e.g. 30m (default: no limit)")
+	applyFilters := filterFlags(fs)
+	fs.Parse(args)
+
+	if len(sources) == 0 {
+		fmt.Println("Error: at least one --source is required")
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	// Load configuration if a file was given
+	var cfg *config.Config
+	if *configPath != "" {
+		var err error
+		cfg, err = config.LoadConfig(*configPath)
+		if err != nil {
+			fmt.Printf("Error loading config: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	cfg = applyFilters(cfg)
+
+	ctx, cancel := commandContext(*timeout)
+	defer cancel()
+
+	// Create a source for every target
+	var targets []dupes.Target
+	for _, spec := range sources {
+		src, startPath, err := openSource(ctx, spec, cfg)
+		if err != nil {
+			fmt.Printf("Error creating source: %v\n", err)
+			os.Exit(1)
+		}
+		targets = append(targets, dupes.Target{
+			Label:     spec,
+			Source:    src,
+			StartPath: startPath,
+		})
+	}
+
+	finder, err := dupes.NewFinder(*hashName)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	finder.SetImages(*images)
+	groups, err := finder.Find(ctx, targets)
+	var opened []source.Source
+	for _, t := range targets {
+		opened = append(opened, t.Source)
+	}
+	closeSources(opened...)
+	if err != nil && groups == nil {
+		exitError("finding duplicates", err)
+	}
+	// Groups found before an interruption are still duplicates
+	dupes.Display(groups)
+	incomplete := reportErrors(opened...)
+	if err != nil {
+		exitError("finding duplicates", err)
+	}
+	if incomplete {
+		os.Exit(exitIncomplete)
+	}
+}
@@ -1,18 +1,63 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/adaptive-scale/superscan/pkg/config"
+	"github.com/adaptive-scale/superscan/pkg/scanerr"
 	"github.com/adaptive-scale/superscan/pkg/source"
+	"github.com/adaptive-scale/superscan/pkg/state"
 )
 
+// exitIncomplete is the exit status of a command that finished but could not list,
+// read or decode every path
+const exitIncomplete = 3
+
 func main() {
+	// Run subcommands
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "dupes":
+			runDupes(os.Args[2:])
+			return
+		case "similar":
+			runSimilar(os.Args[2:])
+			return
+		case "scan":
+			runScan(os.Args[2:])
+			return
+		case "watch":
+			runWatch(os.Args[2:])
+			return
+		}
+	}
+
 	// Define command line flags
-	sourceTypeStr := flag.String("source-type", "filesystem", "Type of source (filesystem|gdrive|s3|gcs)")
+	sourceTypeStr := flag.String("source-type", "filesystem", "Type of source (filesystem|gdrive|s3|gcs|webdav|smb|git|image)")
 	startPath := flag.String("start-path", "/", "Starting path for scanning (default: /)")
+	configPath := flag.String("config", "", "Path to configuration file (optional)")
+	sample := flag.Bool("sample", false, "Scan a random sample of files per prefix and estimate how common each finding type is")
+	sampleDepth := flag.Int("sample-depth", 0, "Directory levels below the start path that define a sampling prefix (default from config, or 1)")
+	seed := flag.Int64("seed", 0, "Seed for random sampling, to reproduce an earlier scan (default from config, or random)")
+	representatives := flag.Int("representatives", 0, "Cluster similar files and scan only this many files per cluster, extrapolating to the rest")
+	similarity := flag.Float64("similarity", 0, "Minimum similarity (0-1) of a file to its cluster's representative (default from config, or 0.8)")
+	metadataOnly := flag.Bool("metadata-only", false, "Cluster files by extension and size without reading them")
+	incremental := flag.Bool("incremental", false, "Scan only files that are new or changed since the last incremental scan")
+	stateFile := flag.String("state-file", "", "Database of scanned files for incremental scans (default from config, or ~/.superscan/state.db)")
+	posture := flag.Bool("posture", false, "Audit owners, permissions, ACLs and extended attributes of local files, reporting risky ones such as world-readable files containing secrets")
+	timeout := flag.Duration("timeout", 0, "Stop after this long, reporting what was found so far, e.g. 30m (default: no limit)")
+	archiveDepth := flag.Int("archive-depth", -1, "Maximum nesting depth when descending into archives, 0 disables (default from config, or 3)")
 	showVersion := flag.Bool("version", false, "Show version information")
+	applyFilters := filterFlags(flag.CommandLine)
 
 	// Parse the flags
 	flag.Parse()
@@ -31,16 +76,248 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Load configuration if a file was given
+	var cfg *config.Config
+	if *configPath != "" {
+		var err error
+		cfg, err = config.LoadConfig(*configPath)
+		if err != nil {
+			fmt.Printf("Error loading config: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Apply command line overrides
+	if *archiveDepth >= 0 {
+		if cfg == nil {
+			cfg = &config.Config{}
+			config.ApplyEnv(cfg)
+		}
+		cfg.Archives.Disabled = *archiveDepth == 0
+		cfg.Archives.MaxDepth = *archiveDepth
+	}
+	if *seed != 0 {
+		if cfg == nil {
+			cfg = &config.Config{}
+			config.ApplyEnv(cfg)
+		}
+		cfg.Sampling.Seed = *seed
+	}
+	if *sampleDepth > 0 {
+		if cfg == nil {
+			cfg = &config.Config{}
+			config.ApplyEnv(cfg)
+		}
+		cfg.Sampling.PrefixDepth = *sampleDepth
+	}
+
+	if *representatives > 0 || *similarity > 0 || *metadataOnly {
+		if cfg == nil {
+			cfg = &config.Config{}
+			config.ApplyEnv(cfg)
+		}
+		if *representatives > 0 {
+			cfg.Clustering.Representatives = *representatives
+		}
+		if *similarity > 0 {
+			cfg.Clustering.Threshold = *similarity
+		}
+		cfg.Clustering.MetadataOnly = cfg.Clustering.MetadataOnly || *metadataOnly
+	}
+
+	if *stateFile != "" {
+		if cfg == nil {
+			cfg = &config.Config{}
+			config.ApplyEnv(cfg)
+		}
+		cfg.State.Path = *stateFile
+	}
+	cfg = applyFilters(cfg)
+
+	// Stop on Ctrl-C, SIGTERM or timeout; every mode reports what it found until then
+	ctx, cancel := commandContext(*timeout)
+	defer cancel()
+
 	// Create source
-	src, err := source.NewSource(*sourceTypeStr, nil	)
+	src, err := source.NewSource(ctx, *sourceTypeStr, cfg)
 	if err != nil {
-		fmt.Printf("Error creating source: %v\n", err)
-		os.Exit(1)
+		exitError("creating source", err)
 	}
 
-	// List files
-	if err := src.ListFiles(*startPath); err != nil {
-		fmt.Printf("Error listing files: %v\n", err)
-		os.Exit(1)
+	var action string
+	switch {
+	case *sample:
+		// Scan a sample of the source
+		action = "sampling files"
+		err = source.SampleScan(ctx, src, *startPath, source.SampleOptionsFromConfig(cfg))
+	case *incremental:
+		// Scan only new and changed files
+		action = "scanning incrementally"
+		err = runIncremental(ctx, src, *startPath, cfg)
+	case *posture:
+		// Audit permissions and ownership
+		action = "auditing permissions"
+		auditor, ok := src.(source.Auditor)
+		if !ok {
+			exitError(action, fmt.Errorf("source %s does not support posture audits", src.GetName()))
+		}
+		err = auditor.Audit(ctx, *startPath)
+	case *representatives > 0:
+		// Scan only representatives of similar files
+		action = "scanning representatives"
+		err = source.RepresentativeScan(ctx, src, *startPath, source.RepresentativeOptionsFromConfig(cfg))
+	default:
+		// List files
+		action = "listing files"
+		err = src.ListFiles(ctx, *startPath)
+	}
+
+	closeSources(src)
+	incomplete := reportErrors(src)
+	if err != nil {
+		exitError(action, err)
+	}
+	if incomplete {
+		os.Exit(exitIncomplete)
+	}
+}
+
+// stringList collects repeated flags, such as --source type:path
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// filterFlags adds the flags that select which files are scanned to a flag set. The
+// returned function applies them on top of a configuration, creating one if needed.
+func filterFlags(fs *flag.FlagSet) func(cfg *config.Config) *config.Config {
+	var include, exclude stringList
+	fs.Var(&include, "include", "Only scan files matching this .gitignore style pattern, e.g. '*.csv' (repeatable)")
+	fs.Var(&exclude, "exclude", "Skip files and directories matching this .gitignore style pattern, e.g. 'node_modules/' (repeatable)")
+	hidden := fs.Bool("hidden", false, "Include hidden files and directories, which the filesystem source skips by default")
+	gitIgnore := fs.Bool("gitignore", false, "Honor .gitignore files as well as .superscanignore files")
+	maxDepth := fs.Int("max-depth", 0, "Only scan this many directory levels below the start path, 1 for its direct children (default: no limit)")
+	followSymlinks := fs.Bool("follow-symlinks", false, "Scan the targets of symlinks on the filesystem, which are skipped by default")
+	oneFileSystem := fs.Bool("one-file-system", false, "Do not descend into directories on another filesystem than the start path")
+	allFileSystems := fs.Bool("all-filesystems", false, "Descend into virtual filesystems such as /proc and /sys and into network mounts, which are skipped by default")
+
+	return func(cfg *config.Config) *config.Config {
+		if len(include) == 0 && len(exclude) == 0 && !*hidden && !*gitIgnore && *maxDepth == 0 &&
+			!*followSymlinks && !*oneFileSystem && !*allFileSystems {
+			return cfg
+		}
+		if cfg == nil {
+			cfg = &config.Config{}
+			config.ApplyEnv(cfg)
+		}
+		cfg.Filters.Include = append(cfg.Filters.Include, include...)
+		cfg.Filters.Exclude = append(cfg.Filters.Exclude, exclude...)
+		cfg.Filters.Hidden = cfg.Filters.Hidden || *hidden
+		cfg.Filters.GitIgnore = cfg.Filters.GitIgnore || *gitIgnore
+		if *maxDepth > 0 {
+			cfg.Filters.MaxDepth = *maxDepth
+		}
+		cfg.FileSystem.FollowSymlinks = cfg.FileSystem.FollowSymlinks || *followSymlinks
+		cfg.FileSystem.OneFileSystem = cfg.FileSystem.OneFileSystem || *oneFileSystem
+		cfg.FileSystem.AllFileSystems = cfg.FileSystem.AllFileSystems || *allFileSystems
+		return cfg
+	}
+}
+
+// runIncremental opens the state database and scans the new and changed files of a source
+func runIncremental(ctx context.Context, src source.Source, startPath string, cfg *config.Config) error {
+	path := ""
+	if cfg != nil {
+		path = cfg.State.Path
+	}
+	if path == "" {
+		var err error
+		if path, err = state.DefaultPath(); err != nil {
+			return err
+		}
+	}
+
+	store, err := state.Open(path)
+	if err != nil {
+		return err
+	}
+	var seed int64
+	if cfg != nil {
+		seed = cfg.Sampling.Seed
+	}
+	if err := source.IncrementalScan(ctx, src, startPath, store, seed); err != nil {
+		store.Close()
+		return err
+	}
+	return store.Close()
+}
+
+// commandContext returns a context that is cancelled on SIGINT or SIGTERM, or once
+// timeout has passed if it is positive. A second signal exits immediately.
+func commandContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-signals:
+		case <-ctx.Done():
+			return
+		}
+		fmt.Println("\nInterrupted, stopping...")
+		cancel()
+		<-signals
+		os.Exit(130)
+	}()
+
+	if timeout <= 0 {
+		return ctx, cancel
+	}
+	timeoutCtx, cancelTimeout := context.WithTimeout(ctx, timeout)
+	return timeoutCtx, func() {
+		cancelTimeout()
+		cancel()
+	}
+}
+
+// closeSources releases the connections held by sources, such as SMB sessions
+func closeSources(sources ...source.Source) {
+	for _, src := range sources {
+		if c, ok := src.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				fmt.Printf("Error closing %s source: %v\n", src.GetName(), err)
+			}
+		}
+	}
+}
+
+// reportErrors prints the paths the sources could not list, read or decode, and
+// reports whether there were any
+func reportErrors(sources ...source.Source) bool {
+	var errs []scanerr.PathError
+	for _, src := range sources {
+		errs = append(errs, src.Errors().Errors()...)
+	}
+	scanerr.Display(errs)
+	return len(errs) > 0
+}
+
+// exitError reports the error of a command and exits. Interrupted commands have
+// already reported their partial results and exit with 130, as shells expect.
+func exitError(action string, err error) {
+	switch {
+	case errors.Is(err, context.Canceled):
+		os.Exit(130)
+	case errors.Is(err, context.DeadlineExceeded):
+		fmt.Printf("Error %s: timed out\n", action)
+	default:
+		fmt.Printf("Error %s: %v\n", action, err)
 	}
-}
\ No newline at end of file
+	os.Exit(1)
+}
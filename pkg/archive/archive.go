@@ -0,0 +1,494 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/adaptive-scale/superscan/pkg/computation"
+	"github.com/bodgit/sevenzip"
+	"github.com/ulikunitz/xz"
+)
+
+// Separator separates an archive path from the path of an entry inside it
+const Separator = "!/"
+
+// ErrLimitExceeded is returned when expanding an archive would exceed the configured limits
+var ErrLimitExceeded = errors.New("archive limit exceeded")
+
+// Limits bound how deep and how much archive content is expanded
+type Limits struct {
+	// MaxDepth is how many levels of nested archives are expanded; 0 disables expansion
+	MaxDepth int
+	// MaxRatio is the largest allowed ratio of uncompressed to compressed size
+	MaxRatio float64
+	// MaxTotalSize is the largest number of uncompressed bytes read from one top-level archive
+	MaxTotalSize int64
+}
+
+// DefaultLimits returns the default expansion limits
+func DefaultLimits() Limits {
+	return Limits{
+		MaxDepth:     3,
+		MaxRatio:     100,
+		MaxTotalSize: 1 << 30,
+	}
+}
+
+// Entry is a file or directory inside an archive
+type Entry struct {
+	Name string
+	// Path is the virtual path of the entry, e.g. export.zip!/data/users.csv
+	Path  string
+	IsDir bool
+	Size  int64
+	// Type is the content type sniffed from the entry's first bytes, see computation.DetectType
+	Type     string
+	Children []*Entry
+	// Err records why a nested archive was not (fully) expanded
+	Err error
+}
+
+// WalkFunc is called for every entry of an archive. r streams the entry content and is
+// nil for directories; it is only valid until WalkFunc returns.
+type WalkFunc func(entry *Entry, r io.Reader) error
+
+// format identifies a supported archive or compression format
+type format int
+
+const (
+	formatNone format = iota
+	formatZip
+	formatTar
+	formatGzip
+	formatBzip2
+	formatXz
+	format7z
+)
+
+// detect returns the format of a file from its name
+func detect(name string) format {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"), strings.HasSuffix(lower, ".jar"), strings.HasSuffix(lower, ".war"), strings.HasSuffix(lower, ".ear"):
+		return formatZip
+	case strings.HasSuffix(lower, ".tar"):
+		return formatTar
+	case strings.HasSuffix(lower, ".gz"), strings.HasSuffix(lower, ".tgz"):
+		return formatGzip
+	case strings.HasSuffix(lower, ".bz2"), strings.HasSuffix(lower, ".tbz2"), strings.HasSuffix(lower, ".tbz"):
+		return formatBzip2
+	case strings.HasSuffix(lower, ".xz"), strings.HasSuffix(lower, ".txz"):
+		return formatXz
+	case strings.HasSuffix(lower, ".7z"):
+		return format7z
+	default:
+		return formatNone
+	}
+}
+
+// decompressedName returns the name of the file inside a single-file compressed stream
+func decompressedName(name string) string {
+	lower := strings.ToLower(name)
+	for _, ext := range []string{".tgz", ".tbz2", ".tbz", ".txz"} {
+		if strings.HasSuffix(lower, ext) {
+			return name[:len(name)-len(ext)] + ".tar"
+		}
+	}
+	return strings.TrimSuffix(name, path.Ext(name))
+}
+
+// IsArchive reports whether a file name has a supported archive or compression extension
+func IsArchive(name string) bool {
+	return detect(name) != formatNone
+}
+
+// Expand lists the entries of an archive as a tree rooted at an entry for the archive itself.
+// A partially expanded tree is returned along with ErrLimitExceeded when a limit is hit.
+func Expand(name string, r io.ReaderAt, size int64, limits Limits) (*Entry, error) {
+	root := &Entry{
+		Name:     path.Base(name),
+		Path:     name,
+		Size:     size,
+		Children: make([]*Entry, 0),
+	}
+	nodes := map[string]*Entry{name: root}
+
+	err := Walk(name, r, size, limits, func(entry *Entry, content io.Reader) error {
+		if content != nil {
+			// Sniff the content type from the first bytes
+			header := make([]byte, computation.SniffSize)
+			n, err := io.ReadFull(content, header)
+			if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+				entry.Err = err
+			}
+			entry.Type = computation.DetectType(header[:n])
+
+			// Single-file compressed streams do not declare their size
+			if entry.Size < 0 {
+				rest, err := io.Copy(io.Discard, content)
+				entry.Size = int64(n) + rest
+				if err != nil {
+					entry.Err = err
+				}
+			}
+		}
+
+		// Attach the entry to its parent, creating intermediate directories
+		parent := ensureParent(nodes, root, entry.Path)
+		if existing, ok := nodes[entry.Path]; ok {
+			existing.Size = entry.Size
+			existing.Err = entry.Err
+			if entry.Type != "" {
+				existing.Type = entry.Type
+			}
+			return nil
+		}
+		parent.Children = append(parent.Children, entry)
+		nodes[entry.Path] = entry
+		return nil
+	})
+	return root, err
+}
+
+// ensureParent returns the parent of a virtual path, creating missing directory entries.
+// Paths without a parent are attached to root.
+func ensureParent(nodes map[string]*Entry, root *Entry, virtualPath string) *Entry {
+	idx := strings.LastIndex(virtualPath, "/")
+	if idx <= 0 {
+		return root
+	}
+	parentPath := virtualPath[:idx]
+	if strings.HasSuffix(virtualPath[:idx+1], Separator) {
+		parentPath = virtualPath[:idx-1]
+	}
+	if parentPath == "" {
+		return root
+	}
+	if parent, ok := nodes[parentPath]; ok {
+		return parent
+	}
+
+	parent := &Entry{
+		Name:     path.Base(parentPath),
+		Path:     parentPath,
+		IsDir:    true,
+		Children: make([]*Entry, 0),
+	}
+	grandparent := ensureParent(nodes, root, parentPath)
+	grandparent.Children = append(grandparent.Children, parent)
+	nodes[parentPath] = parent
+	return parent
+}
+
+// Walk calls fn for every entry of an archive, descending into nested archives up to
+// limits.MaxDepth. Entries inside an archive have paths like outer.zip!/inner.tar!/file.
+func Walk(name string, r io.ReaderAt, size int64, limits Limits, fn WalkFunc) error {
+	if limits.MaxDepth <= 0 {
+		return nil
+	}
+	w := &walker{limits: limits, fn: fn}
+	return w.walk(name, detect(name), r, io.NewSectionReader(r, 0, size), size, 1)
+}
+
+// walker expands archives while accounting for the bytes it decompresses
+type walker struct {
+	limits Limits
+	fn     WalkFunc
+	used   int64
+}
+
+// walk expands one archive. ra is only used by formats that need random access.
+func (w *walker) walk(archivePath string, f format, ra io.ReaderAt, stream io.Reader, size int64, depth int) error {
+	switch f {
+	case formatZip:
+		return w.walkZip(archivePath, ra, size, depth)
+	case format7z:
+		return w.walk7z(archivePath, ra, size, depth)
+	case formatTar:
+		return w.walkTar(archivePath, stream, depth)
+	case formatGzip, formatBzip2, formatXz:
+		return w.walkCompressed(archivePath, f, stream, size, depth)
+	default:
+		return nil
+	}
+}
+
+// entryName cleans the name of an archive entry, so that names such as ./a, a//b or
+// ../../etc/passwd cannot escape the archive or create empty path elements. "" is
+// returned for the archive root.
+func entryName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// walkZip lists a zip archive
+func (w *walker) walkZip(archivePath string, ra io.ReaderAt, size int64, depth int) error {
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		return fmt.Errorf("failed to open zip %s: %w", archivePath, err)
+	}
+
+	// Refuse archives whose declared content is out of proportion to their size
+	var declared uint64
+	for _, zf := range zr.File {
+		declared += zf.UncompressedSize64
+	}
+	if err := w.checkRatio(archivePath, int64(declared), size); err != nil {
+		return err
+	}
+
+	for _, zf := range zr.File {
+		name := entryName(zf.Name)
+		if name == "" {
+			continue
+		}
+		entry := &Entry{
+			Name:  path.Base(name),
+			Path:  archivePath + Separator + name,
+			IsDir: zf.FileInfo().IsDir(),
+			Size:  int64(zf.UncompressedSize64),
+		}
+		if entry.IsDir {
+			if err := w.fn(entry, nil); err != nil {
+				return err
+			}
+			continue
+		}
+
+		rc, err := zf.Open()
+		if err != nil {
+			entry.Err = err
+			if err := w.fn(entry, nil); err != nil {
+				return err
+			}
+			continue
+		}
+		err = w.visit(entry, w.limit(rc, int64(zf.CompressedSize64)), depth)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walk7z lists a 7z archive
+func (w *walker) walk7z(archivePath string, ra io.ReaderAt, size int64, depth int) error {
+	sr, err := sevenzip.NewReader(ra, size)
+	if err != nil {
+		return fmt.Errorf("failed to open 7z %s: %w", archivePath, err)
+	}
+
+	var declared uint64
+	for _, sf := range sr.File {
+		declared += sf.UncompressedSize
+	}
+	if err := w.checkRatio(archivePath, int64(declared), size); err != nil {
+		return err
+	}
+
+	for _, sf := range sr.File {
+		name := entryName(sf.Name)
+		if name == "" {
+			continue
+		}
+		entry := &Entry{
+			Name:  path.Base(name),
+			Path:  archivePath + Separator + name,
+			IsDir: sf.FileInfo().IsDir(),
+			Size:  int64(sf.UncompressedSize),
+		}
+		if entry.IsDir {
+			if err := w.fn(entry, nil); err != nil {
+				return err
+			}
+			continue
+		}
+
+		rc, err := sf.Open()
+		if err != nil {
+			entry.Err = err
+			if err := w.fn(entry, nil); err != nil {
+				return err
+			}
+			continue
+		}
+		// Solid 7z streams cannot be attributed to one file, so only the total budget applies
+		err = w.visit(entry, w.limit(rc, 0), depth)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkTar lists a tar stream
+func (w *walker) walkTar(archivePath string, r io.Reader, depth int) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tar %s: %w", archivePath, err)
+		}
+
+		name := entryName(hdr.Name)
+		if name == "" {
+			continue
+		}
+		entry := &Entry{
+			Name:  path.Base(name),
+			Path:  archivePath + Separator + name,
+			IsDir: hdr.Typeflag == tar.TypeDir,
+			Size:  hdr.Size,
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = w.fn(entry, nil)
+		case tar.TypeReg:
+			err = w.visit(entry, tr, depth)
+		default:
+			// Links, devices and fifos have no content of their own
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// walkCompressed expands a single-file compressed stream. A compressed tar is walked as
+// the tar itself so its entries appear directly below the compressed file.
+func (w *walker) walkCompressed(archivePath string, f format, r io.Reader, size int64, depth int) error {
+	var dr io.Reader
+	switch f {
+	case formatGzip:
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return fmt.Errorf("failed to open gzip %s: %w", archivePath, err)
+		}
+		defer gr.Close()
+		dr = gr
+	case formatBzip2:
+		dr = bzip2.NewReader(r)
+	case formatXz:
+		xr, err := xz.NewReader(r)
+		if err != nil {
+			return fmt.Errorf("failed to open xz %s: %w", archivePath, err)
+		}
+		dr = xr
+	}
+	dr = w.limit(dr, size)
+
+	innerName := decompressedName(path.Base(archivePath))
+	if detect(innerName) == formatTar {
+		return w.walkTar(archivePath, dr, depth)
+	}
+
+	entry := &Entry{
+		Name: innerName,
+		Path: archivePath + Separator + innerName,
+		Size: -1,
+	}
+	return w.visit(entry, dr, depth)
+}
+
+// visit reports a file entry and descends into it if it is itself an archive
+func (w *walker) visit(entry *Entry, r io.Reader, depth int) error {
+	f := detect(entry.Name)
+	if f == formatNone || depth >= w.limits.MaxDepth {
+		return w.fn(entry, r)
+	}
+
+	// Nested archives are buffered, within the total size budget, so they can be both reported and expanded
+	if w.limits.MaxTotalSize > 0 {
+		r = io.LimitReader(r, w.limits.MaxTotalSize+1)
+	}
+	data, err := io.ReadAll(r)
+	if err == nil && w.limits.MaxTotalSize > 0 && int64(len(data)) > w.limits.MaxTotalSize {
+		err = fmt.Errorf("%w: %s is larger than %d bytes", ErrLimitExceeded, entry.Path, w.limits.MaxTotalSize)
+	}
+	if entry.Size < 0 {
+		entry.Size = int64(len(data))
+	}
+	if err != nil {
+		entry.Err = err
+		if fnErr := w.fn(entry, nil); fnErr != nil {
+			return fnErr
+		}
+		if errors.Is(err, ErrLimitExceeded) {
+			return err
+		}
+		return nil
+	}
+
+	if err := w.fn(entry, bytes.NewReader(data)); err != nil {
+		return err
+	}
+
+	br := bytes.NewReader(data)
+	if err := w.walk(entry.Path, f, br, br, int64(len(data)), depth+1); err != nil {
+		entry.Err = err
+		if fnErr := w.fn(entry, nil); fnErr != nil {
+			return fnErr
+		}
+		// A corrupt nested archive does not stop the walk of its parent
+		if errors.Is(err, ErrLimitExceeded) {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkRatio rejects an archive whose declared uncompressed size is too large
+func (w *walker) checkRatio(archivePath string, uncompressed, compressed int64) error {
+	if w.limits.MaxRatio > 0 && compressed > 0 && float64(uncompressed)/float64(compressed) > w.limits.MaxRatio {
+		return fmt.Errorf("%w: %s expands %d bytes to %d (ratio above %.0f)", ErrLimitExceeded, archivePath, compressed, uncompressed, w.limits.MaxRatio)
+	}
+	if w.limits.MaxTotalSize > 0 && w.used+uncompressed > w.limits.MaxTotalSize {
+		return fmt.Errorf("%w: %s would exceed total size limit of %d bytes", ErrLimitExceeded, archivePath, w.limits.MaxTotalSize)
+	}
+	return nil
+}
+
+// limit wraps a decompressing reader so it fails once the ratio against compressedSize
+// or the walk's total size budget is exceeded. A compressedSize of 0 disables the ratio check.
+func (w *walker) limit(r io.Reader, compressedSize int64) io.Reader {
+	maxRead := int64(-1)
+	if w.limits.MaxRatio > 0 && compressedSize > 0 {
+		maxRead = int64(float64(compressedSize) * w.limits.MaxRatio)
+	}
+	return &limitedReader{r: r, w: w, max: maxRead}
+}
+
+// limitedReader enforces decompression limits while reading
+type limitedReader struct {
+	r    io.Reader
+	w    *walker
+	max  int64
+	read int64
+}
+
+// Read implements io.Reader
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	n, err := lr.r.Read(p)
+	lr.read += int64(n)
+	lr.w.used += int64(n)
+	if lr.max >= 0 && lr.read > lr.max {
+		return n, fmt.Errorf("%w: compression ratio above %.0f", ErrLimitExceeded, lr.w.limits.MaxRatio)
+	}
+	if lr.w.limits.MaxTotalSize > 0 && lr.w.used > lr.w.limits.MaxTotalSize {
+		return n, fmt.Errorf("%w: more than %d bytes decompressed", ErrLimitExceeded, lr.w.limits.MaxTotalSize)
+	}
+	return n, err
+}
@@ -0,0 +1,156 @@
+package computation
+
+import (
+	"sort"
+)
+
+const (
+	// DefaultSimilarity is the default threshold for two files to be near duplicates
+	DefaultSimilarity = 0.8
+
+	// Signatures are split into signatureBands bands for locality sensitive hashing;
+	// files agreeing on any whole band become candidates. With 32 bands of 4 hashes,
+	// files with a similarity of 0.6 are found with a probability above 98%.
+	signatureBands = 32
+	bandRows       = SignatureHashes / signatureBands
+)
+
+// Item is a file to cluster, with the signature of its content if it was read, or
+// the perceptual hash of an image
+type Item struct {
+	File      File
+	Signature Signature
+	Image     *ImageHash
+}
+
+// Similarity scores two files between 0 and 1. Images with perceptual hashes are
+// compared by how they look, files with content signatures by content, and others
+// by type or extension and size.
+func Similarity(a, b Item) float64 {
+	if a.Image != nil && b.Image != nil {
+		return a.Image.Similarity(*b.Image)
+	}
+	if a.Signature != nil && b.Signature != nil {
+		return a.Signature.Similarity(b.Signature)
+	}
+	return fileSimilarity(a.File, b.File)
+}
+
+// Member is an item of a cluster with its similarity to the cluster's representative
+type Member struct {
+	// Index is the position of the item in the slice given to ClusterItems
+	Index int
+	Score float64
+}
+
+// Cluster is a group of similar items. The first member is the representative,
+// with a score of 1.
+type Cluster struct {
+	Members []Member
+}
+
+// Representative returns the index of the item the cluster was formed around
+func (c *Cluster) Representative() int {
+	return c.Members[0].Index
+}
+
+// ClusterItems groups items whose similarity to a cluster's representative is at
+// least threshold. Items are visited in order and each joins the most similar
+// existing representative, or starts a new cluster of its own, so every item is in
+// exactly one cluster. Items with signatures or image hashes are only compared with
+// representatives sharing a band of their hash; items with neither with
+// representatives of the same type or extension and a close enough size. Clusters
+// are returned largest first.
+func ClusterItems(items []Item, threshold float64) []Cluster {
+	var clusters []Cluster
+
+	// Content and image clustering, finding candidate representatives by hash band
+	bands := make(map[[2]uint64][]int)
+	var metadataOnly []int
+	for i, item := range items {
+		var keys [][2]uint64
+		switch {
+		case item.Image != nil:
+			keys = imageBandKeys(*item.Image)
+		case item.Signature != nil:
+			keys = bandKeys(item.Signature)
+		default:
+			metadataOnly = append(metadataOnly, i)
+			continue
+		}
+
+		best, bestScore := -1, 0.0
+		seen := make(map[int]bool)
+		for _, key := range keys {
+			for _, c := range bands[key] {
+				if seen[c] {
+					continue
+				}
+				seen[c] = true
+				score := Similarity(item, items[clusters[c].Representative()])
+				if score >= threshold && score > bestScore {
+					best, bestScore = c, score
+				}
+			}
+		}
+		if best >= 0 {
+			clusters[best].Members = append(clusters[best].Members, Member{Index: i, Score: bestScore})
+			continue
+		}
+
+		clusters = append(clusters, Cluster{Members: []Member{{Index: i, Score: 1}}})
+		for _, key := range keys {
+			bands[key] = append(bands[key], len(clusters)-1)
+		}
+	}
+
+	// Metadata clustering: within a type, sorted by size, an item is only similar
+	// enough to the latest representative if any
+	sort.SliceStable(metadataOnly, func(i, j int) bool {
+		a, b := items[metadataOnly[i]].File, items[metadataOnly[j]].File
+		if metadataKey(a) != metadataKey(b) {
+			return metadataKey(a) < metadataKey(b)
+		}
+		return a.Size < b.Size
+	})
+	current := -1
+	for _, i := range metadataOnly {
+		if current >= 0 {
+			rep := items[clusters[current].Representative()]
+			if metadataKey(rep.File) == metadataKey(items[i].File) {
+				if score := Similarity(items[i], rep); score >= threshold {
+					clusters[current].Members = append(clusters[current].Members, Member{Index: i, Score: score})
+					continue
+				}
+			}
+		}
+		clusters = append(clusters, Cluster{Members: []Member{{Index: i, Score: 1}}})
+		current = len(clusters) - 1
+	}
+
+	sort.SliceStable(clusters, func(i, j int) bool {
+		return len(clusters[i].Members) > len(clusters[j].Members)
+	})
+	return clusters
+}
+
+// bandKeys returns the locality sensitive hashing key of every band of a signature
+func bandKeys(sig Signature) [][2]uint64 {
+	keys := make([][2]uint64, signatureBands)
+	for b := range keys {
+		h := uint64(0)
+		for _, v := range sig[b*bandRows : (b+1)*bandRows] {
+			h = mix64(h*31 + v)
+		}
+		keys[b] = [2]uint64{uint64(b), h}
+	}
+	return keys
+}
+
+// metadataKey is what files must share to be compared by metadata alone
+func metadataKey(f File) string {
+	if f.Type != "" {
+		return "type:" + f.Type
+	}
+	return "ext:" + getExtension(f.Name)
+}
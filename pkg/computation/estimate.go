@@ -0,0 +1,129 @@
+package computation
+
+import (
+	"math"
+)
+
+// SampleSize returns how many of population items must be sampled to estimate a
+// proportion within margin at the given confidence level (e.g. 0.05 and 0.95).
+// It uses Cochran's formula with the worst case proportion of 0.5 and a finite
+// population correction.
+func SampleSize(population int64, margin, confidence float64) int {
+	if population <= 0 {
+		return 0
+	}
+	z := NormalQuantile(1 - (1-confidence)/2)
+	n0 := z * z * 0.25 / (margin * margin)
+	n := n0 / (1 + (n0-1)/float64(population))
+	size := int(math.Ceil(n))
+	if int64(size) > population {
+		return int(population)
+	}
+	return size
+}
+
+// StratumCount is the outcome of sampling one stratum for a property such as
+// "contains an AWS key"
+type StratumCount struct {
+	// Population is how many items the stratum holds
+	Population int64
+	// Sampled is how many of them were inspected, Hits how many of those had the property
+	Sampled int
+	Hits    int
+}
+
+// Estimate is an estimated proportion with its confidence interval
+type Estimate struct {
+	Proportion float64
+	Low        float64
+	High       float64
+}
+
+// EstimatePrevalence combines per-stratum samples into a population-wide proportion
+// and confidence interval. Strata are weighted by population, the variance includes
+// the finite population correction, and the interval is a Wilson score interval on
+// the effective sample size so that zero hits still give a useful upper bound.
+func EstimatePrevalence(strata []StratumCount, confidence float64) Estimate {
+	var total int64
+	sampled := 0
+	census := true
+	for _, s := range strata {
+		if s.Sampled > 0 {
+			total += s.Population
+			sampled += s.Sampled
+			census = census && int64(s.Sampled) >= s.Population
+		}
+	}
+	if total == 0 || sampled == 0 {
+		return Estimate{High: 1}
+	}
+
+	// Stratified estimate and its variance
+	var p, variance float64
+	for _, s := range strata {
+		if s.Sampled == 0 {
+			continue
+		}
+		w := float64(s.Population) / float64(total)
+		ph := float64(s.Hits) / float64(s.Sampled)
+		p += w * ph
+		if s.Sampled > 1 {
+			fpc := 1 - float64(s.Sampled)/float64(s.Population)
+			variance += w * w * fpc * ph * (1 - ph) / float64(s.Sampled-1)
+		}
+	}
+
+	// Nothing is uncertain when every item was inspected
+	if census {
+		return Estimate{Proportion: p, Low: p, High: p}
+	}
+
+	// Effective sample size: what a simple random sample with the same variance would need
+	n := float64(sampled)
+	if variance > 0 && p > 0 && p < 1 {
+		n = p * (1 - p) / variance
+	}
+
+	z := NormalQuantile(1 - (1-confidence)/2)
+	denom := 1 + z*z/n
+	center := (p + z*z/(2*n)) / denom
+	half := z * math.Sqrt(p*(1-p)/n+z*z/(4*n*n)) / denom
+	return Estimate{
+		Proportion: p,
+		Low:        math.Max(0, center-half),
+		High:       math.Min(1, center+half),
+	}
+}
+
+// NormalQuantile returns the inverse of the standard normal cumulative distribution,
+// using Acklam's rational approximation (relative error below 1.2e-9)
+func NormalQuantile(p float64) float64 {
+	if p <= 0 {
+		return math.Inf(-1)
+	}
+	if p >= 1 {
+		return math.Inf(1)
+	}
+
+	a := [6]float64{-3.969683028665376e+01, 2.209460984245205e+02, -2.759285104469687e+02, 1.383577518672690e+02, -3.066479806614716e+01, 2.506628277459239e+00}
+	b := [5]float64{-5.447609879822406e+01, 1.615858368580409e+02, -1.556989798598866e+02, 6.680131188771972e+01, -1.328068155288572e+01}
+	c := [6]float64{-7.784894002430293e-03, -3.223964580411365e-01, -2.400758277161838e+00, -2.549732539343734e+00, 4.374664141464968e+00, 2.938163982698783e+00}
+	d := [4]float64{7.784695709041462e-03, 3.224671290700398e-01, 2.445134137142996e+00, 3.754408661907416e+00}
+
+	const low = 0.02425
+	switch {
+	case p < low:
+		q := math.Sqrt(-2 * math.Log(p))
+		return (((((c[0]*q+c[1])*q+c[2])*q+c[3])*q+c[4])*q + c[5]) /
+			((((d[0]*q+d[1])*q+d[2])*q+d[3])*q + 1)
+	case p > 1-low:
+		q := math.Sqrt(-2 * math.Log(1-p))
+		return -(((((c[0]*q+c[1])*q+c[2])*q+c[3])*q+c[4])*q + c[5]) /
+			((((d[0]*q+d[1])*q+d[2])*q+d[3])*q + 1)
+	default:
+		q := p - 0.5
+		r := q * q
+		return (((((a[0]*r+a[1])*r+a[2])*r+a[3])*r+a[4])*r + a[5]) * q /
+			(((((b[0]*r+b[1])*r+b[2])*r+b[3])*r+b[4])*r + 1)
+	}
+}
@@ -0,0 +1,253 @@
+package computation
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"math"
+	"math/bits"
+	"sort"
+
+	"github.com/adaptive-scale/superscan/pkg/scanerr"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	// ImageDuplicateSimilarity is the image similarity above which two images are
+	// treated as the same picture, e.g. resized or recompressed copies
+	ImageDuplicateSimilarity = 0.9
+
+	// Images are first reduced to at most thumbSize square pixels of luminance
+	thumbSize = 64
+	// pHash takes the lowest 8x8 frequencies of a dctSize square DCT
+	dctSize = 32
+
+	// MaxImagePixels bounds the images HashImage decodes, as decoding allocates memory
+	// for every pixel and a tiny file can declare a huge image
+	MaxImagePixels = 50_000_000
+)
+
+// ImageHash holds three 64 bit perceptual hashes of an image. Visually similar
+// images have hashes that differ in few bits, regardless of resolution or encoding.
+type ImageHash struct {
+	// Average is set where a pixel of an 8x8 thumbnail is brighter than the mean (aHash)
+	Average uint64
+	// Difference is set where a pixel of a 9x8 thumbnail is brighter than its right neighbour (dHash)
+	Difference uint64
+	// Perceptual is set where a low frequency DCT coefficient is above the median (pHash)
+	Perceptual uint64
+}
+
+// String formats the hashes as hex, e.g. for reports
+func (h ImageHash) String() string {
+	return fmt.Sprintf("%016x%016x%016x", h.Average, h.Difference, h.Perceptual)
+}
+
+// Similarity returns the share of the 192 hash bits on which two images agree
+func (h ImageHash) Similarity(other ImageHash) float64 {
+	distance := bits.OnesCount64(h.Average^other.Average) +
+		bits.OnesCount64(h.Difference^other.Difference) +
+		bits.OnesCount64(h.Perceptual^other.Perceptual)
+	return 1 - float64(distance)/192
+}
+
+// IsImageType reports whether a detected type (see DetectType) can be hashed by HashImage
+func IsImageType(fileType string) bool {
+	switch fileType {
+	case "jpeg", "png", "gif", "webp":
+		return true
+	}
+	return false
+}
+
+// IsImageFile reports whether a file name has the extension of an image HashImage can decode
+func IsImageFile(name string) bool {
+	switch getExtension(name) {
+	case "jpg", "jpeg", "jpe", "jfif", "png", "gif", "webp":
+		return true
+	}
+	return false
+}
+
+// HashImage decodes a JPEG, PNG, GIF (first frame) or WebP image and computes its
+// perceptual hashes. Images over MaxImagePixels are rejected before decoding them.
+func HashImage(r io.Reader) (ImageHash, error) {
+	// The header read to check the size is replayed to decode the image
+	var header bytes.Buffer
+	cfg, _, err := image.DecodeConfig(io.TeeReader(r, &header))
+	if err != nil {
+		return ImageHash{}, scanerr.Decode(fmt.Errorf("failed to decode image: %v", err))
+	}
+	if pixels := int64(cfg.Width) * int64(cfg.Height); pixels > MaxImagePixels {
+		return ImageHash{}, scanerr.Decode(fmt.Errorf("image of %dx%d pixels is over the limit of %d megapixels",
+			cfg.Width, cfg.Height, MaxImagePixels/1_000_000))
+	}
+
+	img, _, err := image.Decode(io.MultiReader(&header, r))
+	if err != nil {
+		return ImageHash{}, scanerr.Decode(fmt.Errorf("failed to decode image: %v", err))
+	}
+	if img.Bounds().Empty() {
+		return ImageHash{}, scanerr.Decode(fmt.Errorf("failed to decode image: empty image"))
+	}
+
+	thumb := thumbnail(img)
+	return ImageHash{
+		Average:    averageHash(thumb.resize(8, 8)),
+		Difference: differenceHash(thumb.resize(9, 8)),
+		Perceptual: perceptualHash(thumb.resize(dctSize, dctSize)),
+	}, nil
+}
+
+// grayImage is a small luminance image
+type grayImage struct {
+	w, h int
+	pix  []float64
+}
+
+// thumbnail reduces an image to at most thumbSize square luminance pixels in one
+// pass, averaging the source pixels that fall into each thumbnail pixel
+func thumbnail(img image.Image) *grayImage {
+	b := img.Bounds()
+	w, h := min(b.Dx(), thumbSize), min(b.Dy(), thumbSize)
+	sums := make([]float64, w*h)
+	counts := make([]int, w*h)
+
+	add := func(x, y int, lum float64) {
+		i := (y-b.Min.Y)*h/b.Dy()*w + (x-b.Min.X)*w/b.Dx()
+		sums[i] += lum
+		counts[i]++
+	}
+	if ycc, ok := img.(*image.YCbCr); ok {
+		// JPEG: the luma plane is the luminance already
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				add(x, y, float64(ycc.Y[ycc.YOffset(x, y)])*257)
+			}
+		}
+	} else {
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				r, g, bl, _ := img.At(x, y).RGBA()
+				add(x, y, 0.299*float64(r)+0.587*float64(g)+0.114*float64(bl))
+			}
+		}
+	}
+
+	for i := range sums {
+		sums[i] /= float64(counts[i])
+	}
+	return &grayImage{w: w, h: h, pix: sums}
+}
+
+// resize scales the image to w x h by averaging the pixels each target pixel covers
+func (g *grayImage) resize(w, h int) *grayImage {
+	out := &grayImage{w: w, h: h, pix: make([]float64, w*h)}
+	for y := 0; y < h; y++ {
+		y0, y1 := y*g.h/h, max((y+1)*g.h/h, y*g.h/h+1)
+		for x := 0; x < w; x++ {
+			x0, x1 := x*g.w/w, max((x+1)*g.w/w, x*g.w/w+1)
+			var sum float64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					sum += g.pix[sy*g.w+sx]
+				}
+			}
+			out.pix[y*w+x] = sum / float64((y1-y0)*(x1-x0))
+		}
+	}
+	return out
+}
+
+// averageHash sets a bit for every pixel of an 8x8 image brighter than the mean
+func averageHash(g *grayImage) uint64 {
+	var mean float64
+	for _, v := range g.pix {
+		mean += v
+	}
+	mean /= float64(len(g.pix))
+
+	var hash uint64
+	for i, v := range g.pix {
+		if v > mean {
+			hash |= 1 << i
+		}
+	}
+	return hash
+}
+
+// differenceHash sets a bit for every pixel of a 9x8 image brighter than its right neighbour
+func differenceHash(g *grayImage) uint64 {
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			if g.pix[y*9+x] > g.pix[y*9+x+1] {
+				hash |= 1 << (y*8 + x)
+			}
+		}
+	}
+	return hash
+}
+
+// perceptualHash sets a bit for every one of the lowest 8x8 DCT frequencies of a
+// square image that is above their median, ignoring the overall brightness
+func perceptualHash(g *grayImage) uint64 {
+	n := g.w
+	// Separable 2D DCT-II, keeping only the lowest 8 frequencies in each direction
+	cos := make([][]float64, 8)
+	for u := range cos {
+		cos[u] = make([]float64, n)
+		for x := 0; x < n; x++ {
+			cos[u][x] = math.Cos(float64(2*x+1) * float64(u) * math.Pi / float64(2*n))
+		}
+	}
+	rows := make([]float64, n*8)
+	for y := 0; y < n; y++ {
+		for u := 0; u < 8; u++ {
+			var sum float64
+			for x := 0; x < n; x++ {
+				sum += g.pix[y*n+x] * cos[u][x]
+			}
+			rows[y*8+u] = sum
+		}
+	}
+	coeffs := make([]float64, 64)
+	for v := 0; v < 8; v++ {
+		for u := 0; u < 8; u++ {
+			var sum float64
+			for y := 0; y < n; y++ {
+				sum += rows[y*8+u] * cos[v][y]
+			}
+			coeffs[v*8+u] = sum
+		}
+	}
+
+	// The DC coefficient is the mean brightness and would dominate the median
+	sorted := append([]float64(nil), coeffs[1:]...)
+	sort.Float64s(sorted)
+	median := sorted[len(sorted)/2]
+
+	var hash uint64
+	for i, c := range coeffs {
+		if c > median {
+			hash |= 1 << i
+		}
+	}
+	return hash
+}
+
+// imageBandKeys returns the locality sensitive hashing keys of an image hash: each
+// byte of each hash, so images differing in fewer than 24 bits share at least one
+func imageBandKeys(h ImageHash) [][2]uint64 {
+	keys := make([][2]uint64, 0, 24)
+	for i, v := range []uint64{h.Average, h.Difference, h.Perceptual} {
+		for b := 0; b < 8; b++ {
+			keys = append(keys, [2]uint64{uint64(signatureBands + i*8 + b), (v >> (8 * b)) & 0xff})
+		}
+	}
+	return keys
+}
@@ -0,0 +1,242 @@
+package computation
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// SniffSize is how many leading bytes of a file are used to detect its type
+const SniffSize = 8192
+
+// FileType describes a file format recognised by its magic bytes
+type FileType struct {
+	Name string
+	// Executable is set for native binaries, bytecode and scripts
+	Executable bool
+	// Extensions lists the extensions this format is normally stored under
+	Extensions []string
+}
+
+// Generic types reported when no signature matches
+const (
+	TypeText   = "text"
+	TypeBinary = "binary"
+)
+
+// signature is a sequence of magic bytes at a fixed offset
+type signature struct {
+	offset int
+	magic  []byte
+	name   string
+}
+
+// signatures are checked in order, so longer and more specific ones come first
+var signatures = []signature{
+	{0, []byte("\x7fELF"), "elf"},
+	{0, []byte{0xfe, 0xed, 0xfa, 0xce}, "macho"},
+	{0, []byte{0xfe, 0xed, 0xfa, 0xcf}, "macho"},
+	{0, []byte{0xce, 0xfa, 0xed, 0xfe}, "macho"},
+	{0, []byte{0xcf, 0xfa, 0xed, 0xfe}, "macho"},
+	{0, []byte("\x00asm"), "wasm"},
+	{0, []byte("#!"), "script"},
+	{0, []byte("PK\x03\x04"), "zip"},
+	{0, []byte("PK\x05\x06"), "zip"},
+	{0, []byte("PK\x07\x08"), "zip"},
+	{0, []byte{0x1f, 0x8b}, "gzip"},
+	{0, []byte("BZh"), "bzip2"},
+	{0, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}, "xz"},
+	{0, []byte{'7', 'z', 0xbc, 0xaf, 0x27, 0x1c}, "7z"},
+	{0, []byte("Rar!\x1a\x07"), "rar"},
+	{0, []byte{0x28, 0xb5, 0x2f, 0xfd}, "zstd"},
+	{257, []byte("ustar"), "tar"},
+	{0, []byte("%PDF-"), "pdf"},
+	{0, []byte{0xd0, 0xcf, 0x11, 0xe0, 0xa1, 0xb1, 0x1a, 0xe1}, "ole"},
+	{0, []byte("SQLite format 3\x00"), "sqlite"},
+	{0, []byte("\x89PNG\r\n\x1a\n"), "png"},
+	{0, []byte{0xff, 0xd8, 0xff}, "jpeg"},
+	{0, []byte("GIF87a"), "gif"},
+	{0, []byte("GIF89a"), "gif"},
+	{0, []byte("II*\x00"), "tiff"},
+	{0, []byte("MM\x00*"), "tiff"},
+	{0, []byte("8BPS"), "psd"},
+	{4, []byte("ftyp"), "mp4"},
+	{0, []byte("ID3"), "mp3"},
+	{0, []byte("OggS"), "ogg"},
+	{0, []byte("fLaC"), "flac"},
+	{0, []byte{0x1a, 0x45, 0xdf, 0xa3}, "matroska"},
+}
+
+// fileTypes maps detected type names to their description
+var fileTypes = map[string]FileType{
+	"elf":        {Name: "elf", Executable: true, Extensions: []string{"so", "o", "ko", "elf", "bin", "out", "axf", "run"}},
+	"pe":         {Name: "pe", Executable: true, Extensions: []string{"exe", "dll", "sys", "com", "scr", "ocx", "cpl", "efi", "drv", "mui", "node", "pyd"}},
+	"macho":      {Name: "macho", Executable: true, Extensions: []string{"dylib", "bundle", "o", "so", "bin", "out"}},
+	"java-class": {Name: "java-class", Executable: true, Extensions: []string{"class"}},
+	"wasm":       {Name: "wasm", Executable: true, Extensions: []string{"wasm"}},
+	"script":     {Name: "script", Executable: true, Extensions: []string{"sh", "bash", "zsh", "ksh", "csh", "fish", "command", "py", "pl", "pm", "rb", "php", "js", "mjs", "cjs", "ts", "lua", "tcl", "awk", "sed", "r", "run", "cgi", "bats", "expect"}},
+	"zip": {Name: "zip", Extensions: []string{
+		"zip", "zipx", "jar", "war", "ear", "aar", "apk", "aab", "ipa", "xpi", "whl", "egg", "nupkg", "vsix", "appx", "msix", "epub", "kmz", "3mf", "xps", "oxps", "sketch",
+		"docx", "docm", "dotx", "dotm", "xlsx", "xlsm", "xltx", "xltm", "pptx", "pptm", "potx", "potm", "ppsx", "vsdx",
+		"odt", "ods", "odp", "odg", "ott", "ots", "otp",
+	}},
+	"gzip":     {Name: "gzip", Extensions: []string{"gz", "tgz", "gzip", "svgz", "emz"}},
+	"bzip2":    {Name: "bzip2", Extensions: []string{"bz2", "tbz", "tbz2", "bz"}},
+	"xz":       {Name: "xz", Extensions: []string{"xz", "txz"}},
+	"7z":       {Name: "7z", Extensions: []string{"7z"}},
+	"rar":      {Name: "rar", Extensions: []string{"rar"}},
+	"zstd":     {Name: "zstd", Extensions: []string{"zst", "zstd", "tzst"}},
+	"tar":      {Name: "tar", Extensions: []string{"tar"}},
+	"pdf":      {Name: "pdf", Extensions: []string{"pdf", "ai"}},
+	"ole":      {Name: "ole", Extensions: []string{"doc", "dot", "xls", "xlt", "ppt", "pot", "pps", "msi", "msg", "vsd", "pub", "mpp", "db"}},
+	"sqlite":   {Name: "sqlite", Extensions: []string{"sqlite", "sqlite3", "db", "db3", "sdb"}},
+	"png":      {Name: "png", Extensions: []string{"png", "apng"}},
+	"jpeg":     {Name: "jpeg", Extensions: []string{"jpg", "jpeg", "jpe", "jfif"}},
+	"gif":      {Name: "gif", Extensions: []string{"gif"}},
+	"tiff":     {Name: "tiff", Extensions: []string{"tif", "tiff", "dng", "cr2", "nef", "arw"}},
+	"psd":      {Name: "psd", Extensions: []string{"psd", "psb"}},
+	"webp":     {Name: "webp", Extensions: []string{"webp"}},
+	"wav":      {Name: "wav", Extensions: []string{"wav"}},
+	"avi":      {Name: "avi", Extensions: []string{"avi"}},
+	"mp4":      {Name: "mp4", Extensions: []string{"mp4", "m4a", "m4v", "m4b", "mov", "qt", "3gp", "3g2", "f4v", "heic", "heif", "avif"}},
+	"mp3":      {Name: "mp3", Extensions: []string{"mp3"}},
+	"ogg":      {Name: "ogg", Extensions: []string{"ogg", "oga", "ogv", "opus", "spx"}},
+	"flac":     {Name: "flac", Extensions: []string{"flac"}},
+	"matroska": {Name: "matroska", Extensions: []string{"mkv", "webm", "mka", "mks"}},
+}
+
+// DetectType identifies a file from its first bytes (up to SniffSize).
+// It returns a type name such as "zip" or "pe", TypeText or TypeBinary when no
+// signature matches, or "" for an empty file.
+func DetectType(header []byte) string {
+	if len(header) == 0 {
+		return ""
+	}
+	if len(header) > SniffSize {
+		header = header[:SniffSize]
+	}
+
+	// Signatures that need more than a prefix match
+	if isPE(header) {
+		return "pe"
+	}
+	if len(header) >= 8 && bytes.HasPrefix(header, []byte{0xca, 0xfe, 0xba, 0xbe}) {
+		// Java class files and universal Mach-O binaries share a magic number;
+		// class files carry a major version of 45 or more where Mach-O has a small architecture count
+		if binary.BigEndian.Uint16(header[6:8]) >= 45 {
+			return "java-class"
+		}
+		return "macho"
+	}
+	if len(header) >= 12 && bytes.HasPrefix(header, []byte("RIFF")) {
+		switch string(header[8:12]) {
+		case "WEBP":
+			return "webp"
+		case "WAVE":
+			return "wav"
+		case "AVI ":
+			return "avi"
+		}
+	}
+
+	for _, sig := range signatures {
+		end := sig.offset + len(sig.magic)
+		if len(header) >= end && bytes.Equal(header[sig.offset:end], sig.magic) {
+			return sig.name
+		}
+	}
+
+	if looksLikeText(header) {
+		return TypeText
+	}
+	return TypeBinary
+}
+
+// isPE reports whether a header is a Windows PE executable (an MZ stub pointing at a PE header)
+func isPE(header []byte) bool {
+	if len(header) < 0x40 || !bytes.HasPrefix(header, []byte("MZ")) {
+		return false
+	}
+	offset := int(binary.LittleEndian.Uint32(header[0x3c:0x40]))
+	if offset+4 > len(header) {
+		// The PE header lies beyond the sniffed bytes, trust the MZ stub
+		return offset < 1<<20
+	}
+	return bytes.Equal(header[offset:offset+4], []byte("PE\x00\x00"))
+}
+
+// looksLikeText reports whether a header is valid UTF-8 without NUL bytes
+func looksLikeText(header []byte) bool {
+	if bytes.IndexByte(header, 0) >= 0 {
+		return false
+	}
+	// A multi-byte rune may be cut at the end of the header
+	for i := 0; i < utf8.UTFMax && len(header) > 0; i++ {
+		if utf8.Valid(header) {
+			return true
+		}
+		header = header[:len(header)-1]
+	}
+	return false
+}
+
+// LookupType returns the description of a detected type name
+func LookupType(name string) (FileType, bool) {
+	t, ok := fileTypes[name]
+	return t, ok
+}
+
+// ExtensionMismatch explains why a file's extension does not match its detected type,
+// e.g. an executable renamed to .txt or a zip renamed to .jpg. It returns "" when the
+// extension is consistent, missing, or the type was not recognised. Numeric extensions
+// are version or rotation numbers, as in libc.so.6 or app.log.1, so the extension
+// before them is checked instead.
+func ExtensionMismatch(filename, detected string) string {
+	ext := typeExtension(filename)
+	if ext == "" {
+		return ""
+	}
+	t, ok := fileTypes[detected]
+	if !ok {
+		return ""
+	}
+	for _, e := range t.Extensions {
+		if e == ext {
+			return ""
+		}
+	}
+
+	kind := t.Name
+	if t.Executable {
+		kind += " executable"
+	}
+	return fmt.Sprintf("content is %s but extension is .%s", kind, ext)
+}
+
+// typeExtension returns the lower case extension of a file name, skipping trailing
+// numeric extensions
+func typeExtension(filename string) string {
+	parts := strings.Split(strings.ToLower(filepath.Base(filename)), ".")
+	for i := len(parts) - 1; i > 0; i-- {
+		if !isNumber(parts[i]) {
+			return parts[i]
+		}
+	}
+	return ""
+}
+
+// isNumber reports whether s is a non-empty run of ASCII digits
+func isNumber(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
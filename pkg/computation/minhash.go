@@ -0,0 +1,168 @@
+package computation
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// SignatureHashes is the number of hash functions in a MinHash signature
+	SignatureHashes = 128
+	// SignatureBytes is how much of a file's content is shingled for its signature
+	SignatureBytes = 256 * 1024
+
+	// Text is shingled by runs of wordShingle words, other content by byteShingle bytes
+	wordShingle = 3
+	byteShingle = 8
+)
+
+// signatureSeeds perturb the shingle hashes into SignatureHashes independent hash functions
+var signatureSeeds = func() [SignatureHashes]uint64 {
+	var seeds [SignatureHashes]uint64
+	x := uint64(0x5bd1e9955bd1e995)
+	for i := range seeds {
+		x += 0x9e3779b97f4a7c15
+		seeds[i] = mix64(x)
+	}
+	return seeds
+}()
+
+// Signature is a MinHash signature of a file's content. The share of positions at
+// which two signatures agree estimates the Jaccard similarity of their shingle sets.
+type Signature []uint64
+
+// ContentSignature computes the MinHash signature of content (up to SignatureBytes).
+// Text is compared by overlapping runs of words, so reordered or edited lines still
+// share most shingles; binary content by overlapping runs of bytes. It returns nil
+// when the content is too short to shingle.
+func ContentSignature(content []byte) Signature {
+	if len(content) > SignatureBytes {
+		content = content[:SignatureBytes]
+	}
+
+	var shingles []uint64
+	if looksLikeText(content[:min(len(content), SniffSize)]) {
+		shingles = wordShingles(content)
+	} else {
+		shingles = byteShingles(content)
+	}
+	if len(shingles) == 0 {
+		return nil
+	}
+
+	sig := make(Signature, SignatureHashes)
+	for i := range sig {
+		sig[i] = ^uint64(0)
+	}
+	for _, s := range shingles {
+		for i, seed := range signatureSeeds {
+			if h := mix64(s ^ seed); h < sig[i] {
+				sig[i] = h
+			}
+		}
+	}
+	return sig
+}
+
+// Similarity estimates the Jaccard similarity of the content behind two signatures
+func (s Signature) Similarity(other Signature) float64 {
+	if len(s) == 0 || len(s) != len(other) {
+		return 0
+	}
+	equal := 0
+	for i := range s {
+		if s[i] == other[i] {
+			equal++
+		}
+	}
+	return float64(equal) / float64(len(s))
+}
+
+// wordShingles hashes every run of wordShingle consecutive words, ignoring case and
+// punctuation. Content with fewer words is a single shingle.
+func wordShingles(content []byte) []uint64 {
+	var words []uint64
+	start := -1
+	for i := 0; i <= len(content); {
+		r, size := utf8.RuneError, 1
+		if i < len(content) {
+			r, size = utf8.DecodeRune(content[i:])
+		}
+		isWord := i < len(content) && (unicode.IsLetter(r) || unicode.IsDigit(r))
+		if isWord && start < 0 {
+			start = i
+		} else if !isWord && start >= 0 {
+			words = append(words, hashBytes(toLower(content[start:i])))
+			start = -1
+		}
+		i += size
+	}
+	if len(words) == 0 {
+		return nil
+	}
+	if len(words) < wordShingle {
+		return []uint64{combine(words)}
+	}
+
+	shingles := make([]uint64, 0, len(words)-wordShingle+1)
+	for i := 0; i+wordShingle <= len(words); i++ {
+		shingles = append(shingles, combine(words[i:i+wordShingle]))
+	}
+	return shingles
+}
+
+// byteShingles hashes every run of byteShingle consecutive bytes
+func byteShingles(content []byte) []uint64 {
+	if len(content) < byteShingle {
+		if len(content) == 0 {
+			return nil
+		}
+		return []uint64{hashBytes(content)}
+	}
+	shingles := make([]uint64, 0, len(content)-byteShingle+1)
+	for i := 0; i+byteShingle <= len(content); i++ {
+		shingles = append(shingles, hashBytes(content[i:i+byteShingle]))
+	}
+	return shingles
+}
+
+// toLower returns a copy of b with ASCII letters lower cased
+func toLower(b []byte) []byte {
+	out := make([]byte, len(b))
+	for i, c := range b {
+		if c >= 'A' && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		out[i] = c
+	}
+	return out
+}
+
+// combine hashes a sequence of word hashes into one shingle hash
+func combine(words []uint64) uint64 {
+	h := uint64(0)
+	for _, w := range words {
+		h = mix64(h*31 + w)
+	}
+	return h
+}
+
+// hashBytes returns the 64 bit FNV-1a hash of b
+func hashBytes(b []byte) uint64 {
+	h := uint64(14695981039346656037)
+	for _, c := range b {
+		h ^= uint64(c)
+		h *= 1099511628211
+	}
+	return h
+}
+
+// mix64 is the splitmix64 finalizer, a fast bijective scrambling of 64 bit values
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
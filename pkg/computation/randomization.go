@@ -1,21 +1,11 @@
 package computation
 
 import (
-    "fmt"
-    "math/rand"
     "time"
 )
 
-// Generic random selection function
+// Generic random selection function. Each call uses a fresh time based seed;
+// use SelectRandomWith and a Sampler for reproducible selections.
 func SelectRandom[T any](items []T, n int) []T {
-    if n > len(items) {
-        n = len(items)
-    }
-    rand.Seed(time.Now().UnixNano())
-    perm := rand.Perm(len(items))
-    result := make([]T, n)
-    for i := 0; i < n; i++ {
-        result[i] = items[perm[i]]
-    }
-    return result
+    return SelectRandomWith(NewSampler(time.Now().UnixNano()), items, n)
 }
@@ -0,0 +1,210 @@
+package computation
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Sampler is a source of reproducible random choices. Two samplers created with
+// the same seed make the same choices, so a sample can be recreated from the seed
+// recorded in a scan report.
+type Sampler struct {
+	seed int64
+	rng  *rand.Rand
+}
+
+// NewSampler creates a sampler with an explicit seed
+func NewSampler(seed int64) *Sampler {
+	return &Sampler{
+		seed: seed,
+		rng:  rand.New(rand.NewSource(seed)),
+	}
+}
+
+// Seed returns the seed the sampler was created with
+func (s *Sampler) Seed() int64 {
+	return s.seed
+}
+
+// Derive returns an independent sampler for a key, such as a file path. Its choices
+// depend only on the seed and the key, not on how many choices were made before,
+// so samples stay the same when files are visited in a different order.
+func (s *Sampler) Derive(key string) *Sampler {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return NewSampler(s.seed ^ int64(h.Sum64()))
+}
+
+// Intn returns a random number in [0, n)
+func (s *Sampler) Intn(n int) int {
+	return s.rng.Intn(n)
+}
+
+// Perm returns a random permutation of [0, n)
+func (s *Sampler) Perm(n int) []int {
+	return s.rng.Perm(n)
+}
+
+// SelectRandomWith picks n items without replacement using the given sampler
+func SelectRandomWith[T any](s *Sampler, items []T, n int) []T {
+	if n > len(items) {
+		n = len(items)
+	}
+	perm := s.Perm(len(items))
+	result := make([]T, n)
+	for i := 0; i < n; i++ {
+		result[i] = items[perm[i]]
+	}
+	return result
+}
+
+// Reservoir keeps a uniform random sample of fixed size from a stream of unknown length
+type Reservoir[T any] struct {
+	sampler *Sampler
+	size    int
+	seen    int64
+	items   []T
+}
+
+// NewReservoir creates a reservoir holding at most size items
+func NewReservoir[T any](s *Sampler, size int) *Reservoir[T] {
+	return &Reservoir[T]{
+		sampler: s,
+		size:    size,
+		items:   make([]T, 0, size),
+	}
+}
+
+// Add offers an item from the stream to the reservoir
+func (r *Reservoir[T]) Add(item T) {
+	r.seen++
+	if len(r.items) < r.size {
+		r.items = append(r.items, item)
+		return
+	}
+	// Keep the new item with probability size/seen
+	if j := r.sampler.rng.Int63n(r.seen); j < int64(r.size) {
+		r.items[j] = item
+	}
+}
+
+// Items returns the sampled items
+func (r *Reservoir[T]) Items() []T {
+	return r.items
+}
+
+// Seen returns how many items were offered to the reservoir
+func (r *Reservoir[T]) Seen() int64 {
+	return r.seen
+}
+
+// StratumFunc assigns a file to a stratum
+type StratumFunc func(f File) string
+
+// ByDirectory groups files by the directory of their (slash separated) name
+func ByDirectory(f File) string {
+	return path.Dir(f.Name)
+}
+
+// ByExtension groups files by their lower case extension
+func ByExtension(f File) string {
+	return getExtension(f.Name)
+}
+
+// sizeBuckets are the upper bounds of the size buckets used by BySizeBucket
+var sizeBuckets = []struct {
+	limit int64
+	name  string
+}{
+	{1, "empty"},
+	{1 << 10, "<1KB"},
+	{1 << 20, "1KB-1MB"},
+	{100 << 20, "1MB-100MB"},
+	{10 << 30, "100MB-10GB"},
+}
+
+// BySizeBucket groups files into order of magnitude size buckets
+func BySizeBucket(f File) string {
+	for _, b := range sizeBuckets {
+		if f.Size < b.limit {
+			return b.name
+		}
+	}
+	return ">10GB"
+}
+
+// Strata combines several stratum functions into one, e.g. directory and extension
+func Strata(funcs ...StratumFunc) StratumFunc {
+	return func(f File) string {
+		keys := make([]string, len(funcs))
+		for i, fn := range funcs {
+			keys[i] = fn(f)
+		}
+		return strings.Join(keys, "|")
+	}
+}
+
+// ByPrefix groups files by the first depth directories of their (slash separated)
+// name, so at depth 2 "logs/2024/01/app.log" belongs to "logs/2024". Files closer
+// to the root belong to their own directory.
+func ByPrefix(depth int) StratumFunc {
+	return func(f File) string {
+		parts := strings.Split(path.Dir(f.Name), "/")
+		if len(parts) > depth {
+			parts = parts[:depth]
+		}
+		return strings.Join(parts, "/")
+	}
+}
+
+// Stratum is the sample drawn from one stratum
+type Stratum[T any] struct {
+	Key string
+	// Seen is how many items belonged to the stratum
+	Seen   int64
+	Sample []T
+}
+
+// StratifiedSampler draws a separate reservoir sample from every stratum of a
+// stream, so small directories or rare extensions are not crowded out by large ones
+type StratifiedSampler[T any] struct {
+	sampler    *Sampler
+	perStratum int
+	key        func(T) string
+	strata     map[string]*Reservoir[T]
+}
+
+// NewStratifiedSampler keeps up to perStratum items from every stratum
+func NewStratifiedSampler[T any](s *Sampler, perStratum int, key func(T) string) *StratifiedSampler[T] {
+	return &StratifiedSampler[T]{
+		sampler:    s,
+		perStratum: perStratum,
+		key:        key,
+		strata:     make(map[string]*Reservoir[T]),
+	}
+}
+
+// Add offers an item to the reservoir of its stratum
+func (ss *StratifiedSampler[T]) Add(item T) {
+	key := ss.key(item)
+	r, ok := ss.strata[key]
+	if !ok {
+		// Each stratum draws from its own sampler so strata do not affect each other
+		r = NewReservoir[T](ss.sampler.Derive(key), ss.perStratum)
+		ss.strata[key] = r
+	}
+	r.Add(item)
+}
+
+// Strata returns the sample of every stratum, ordered by key
+func (ss *StratifiedSampler[T]) Strata() []Stratum[T] {
+	strata := make([]Stratum[T], 0, len(ss.strata))
+	for key, r := range ss.strata {
+		strata = append(strata, Stratum[T]{Key: key, Seen: r.Seen(), Sample: r.Items()})
+	}
+	sort.Slice(strata, func(i, j int) bool { return strata[i].Key < strata[j].Key })
+	return strata
+}
@@ -1,7 +1,6 @@
 package computation
 
 import (
-    "fmt"
     "math"
     "path/filepath"
     "strings"
@@ -9,8 +8,9 @@ import (
 
 // File struct
 type File struct {
-    Name string
+    Name string // file name, or a slash separated path
     Size int64 // in bytes
+    Type string // detected content type, see DetectType
 }
 
 // Helper to get extension, normalized
@@ -24,9 +24,12 @@ func getExtension(filename string) string {
 
 // Similarity function
 func fileSimilarity(a, b File) float64 {
-    extA := getExtension(a.Name)
-    extB := getExtension(b.Name)
-    if extA != extB {
+    // Prefer the sniffed content type over the extension when both are known
+    if a.Type != "" && b.Type != "" {
+        if a.Type != b.Type {
+            return 0
+        }
+    } else if getExtension(a.Name) != getExtension(b.Name) {
         return 0
     }
     maxSize := math.Max(float64(a.Size), float64(b.Size))
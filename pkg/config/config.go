@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -11,14 +12,25 @@ import (
 // Config holds the application configuration
 type Config struct {
 	GoogleDrive GoogleDriveConfig `yaml:"google_drive,omitempty"`
-	S3         S3Config          `yaml:"s3,omitempty"`
+	S3          S3Config          `yaml:"s3,omitempty"`
+	WebDAV      WebDAVConfig      `yaml:"webdav,omitempty"`
+	SMB         SMBConfig         `yaml:"smb,omitempty"`
+	Archives    ArchiveConfig     `yaml:"archives,omitempty"`
+	Sampling    SamplingConfig    `yaml:"sampling,omitempty"`
+	Clustering  ClusteringConfig  `yaml:"clustering,omitempty"`
+	State       StateConfig       `yaml:"state,omitempty"`
+	Retry       RetryConfig       `yaml:"retry,omitempty"`
+	Filters     FiltersConfig     `yaml:"filters,omitempty"`
+	FileSystem  FileSystemConfig  `yaml:"filesystem,omitempty"`
 }
 
 // GoogleDriveConfig holds Google Drive specific configuration
 type GoogleDriveConfig struct {
 	CredentialsFile string `yaml:"credentials_file"`
-	TokenFile      string `yaml:"token_file"`
-	StartPath      string `yaml:"start_path"`
+	TokenFile       string `yaml:"token_file"`
+	StartPath       string `yaml:"start_path"`
+	// QPS limits requests to the Drive API per second, 0 for no limit
+	QPS float64 `yaml:"qps"`
 }
 
 // S3Config holds AWS S3 specific configuration
@@ -26,6 +38,112 @@ type S3Config struct {
 	Bucket    string `yaml:"bucket"`
 	Region    string `yaml:"region"`
 	StartPath string `yaml:"start_path"`
+	// QPS limits requests to S3 per second, 0 for no limit
+	QPS float64 `yaml:"qps"`
+}
+
+// WebDAVConfig holds WebDAV (and Nextcloud) specific configuration
+type WebDAVConfig struct {
+	URL       string `yaml:"url"`
+	Username  string `yaml:"username"`
+	Password  string `yaml:"password"`
+	Token     string `yaml:"token"`
+	StartPath string `yaml:"start_path"`
+	// QPS limits requests to the server per second, 0 for no limit
+	QPS float64 `yaml:"qps"`
+}
+
+// SMBConfig holds SMB/CIFS network share specific configuration
+type SMBConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	Domain   string `yaml:"domain"`
+	Share    string `yaml:"share"`
+}
+
+// ArchiveConfig controls descent into archives found while scanning.
+// Zero values fall back to the built-in defaults.
+type ArchiveConfig struct {
+	Disabled     bool    `yaml:"disabled"`
+	MaxDepth     int     `yaml:"max_depth"`
+	MaxRatio     float64 `yaml:"max_ratio"`
+	MaxTotalSize int64   `yaml:"max_total_size"`
+}
+
+// SamplingConfig controls random sampling. A zero seed picks a new one for every run;
+// other zero values fall back to the built-in defaults.
+type SamplingConfig struct {
+	Seed int64 `yaml:"seed"`
+	// PrefixDepth is how many directory levels below the start path define a stratum
+	PrefixDepth int `yaml:"prefix_depth"`
+	// Margin and Confidence set the per-prefix sample size, e.g. 0.05 at 0.95
+	Margin     float64 `yaml:"margin"`
+	Confidence float64 `yaml:"confidence"`
+	// MaxPerPrefix caps how many files are scanned from one prefix
+	MaxPerPrefix int `yaml:"max_per_prefix"`
+}
+
+// ClusteringConfig controls representative-only scanning of similar files.
+// Zero values fall back to the built-in defaults.
+type ClusteringConfig struct {
+	// Representatives is how many files of each cluster are scanned
+	Representatives int `yaml:"representatives"`
+	// Threshold is the minimum similarity (0-1) of a file to its cluster's representative
+	Threshold float64 `yaml:"threshold"`
+	// MetadataOnly clusters files by extension and size without reading them
+	MetadataOnly bool `yaml:"metadata_only"`
+	// Signatures is how many files of each extension and size bucket are read to
+	// cluster them by content
+	Signatures int `yaml:"signatures"`
+}
+
+// StateConfig controls where scan state is kept: the database of scanned files used
+// by incremental scans and the checkpoints of resumable scans
+type StateConfig struct {
+	// Path is the database file, ~/.superscan/state.db by default
+	Path string `yaml:"path"`
+	// Checkpoints is the directory of scan checkpoints, ~/.superscan/scans by default
+	Checkpoints string `yaml:"checkpoints"`
+}
+
+// RetryConfig controls how requests to cloud APIs that fail with throttling or server
+// errors are retried. Zero values fall back to the built-in defaults.
+type RetryConfig struct {
+	// MaxAttempts is how often a request is tried, 1 disables retries
+	MaxAttempts int `yaml:"max_attempts"`
+	// BaseDelay is the backoff before the first retry, doubled for every retry after it
+	BaseDelay time.Duration `yaml:"base_delay"`
+	// MaxDelay caps the backoff between two attempts
+	MaxDelay time.Duration `yaml:"max_delay"`
+}
+
+// FiltersConfig selects which files are listed and scanned, with .gitignore style patterns
+// matched against paths relative to the start path
+type FiltersConfig struct {
+	// Include limits scanning to files matching one of these patterns
+	Include []string `yaml:"include" json:"include,omitempty"`
+	// Exclude skips files and directories matching one of these patterns
+	Exclude []string `yaml:"exclude" json:"exclude,omitempty"`
+	// Hidden includes hidden files and directories, which the filesystem source skips by default
+	Hidden bool `yaml:"hidden" json:"hidden,omitempty"`
+	// GitIgnore honors .gitignore files in addition to .superscanignore files
+	GitIgnore bool `yaml:"gitignore" json:"gitignore,omitempty"`
+	// MaxDepth limits how many directory levels below the start path are scanned, 0 for no limit
+	MaxDepth int `yaml:"max_depth" json:"max_depth,omitempty"`
+}
+
+// FileSystemConfig controls how the local filesystem is traversed
+type FileSystemConfig struct {
+	// FollowSymlinks scans the targets of symlinks, descending into linked directories
+	// unless they loop back to one being walked
+	FollowSymlinks bool `yaml:"follow_symlinks" json:"follow_symlinks,omitempty"`
+	// OneFileSystem does not descend into directories on another filesystem than the start path
+	OneFileSystem bool `yaml:"one_file_system" json:"one_file_system,omitempty"`
+	// AllFileSystems descends into virtual filesystems such as /proc and /sys and into
+	// network mounts, which are skipped by default
+	AllFileSystems bool `yaml:"all_filesystems" json:"all_filesystems,omitempty"`
 }
 
 // LoadConfig loads the configuration from a file or environment variable
@@ -53,14 +171,17 @@ func LoadConfig(configPath string) (*Config, error) {
 			config := &Config{
 				GoogleDrive: GoogleDriveConfig{
 					CredentialsFile: filepath.Join(configDir, "credentials.json"),
-					TokenFile:      filepath.Join(configDir, "token.json"),
-					StartPath:      "root",
+					TokenFile:       filepath.Join(configDir, "token.json"),
+					StartPath:       "root",
 				},
 				S3: S3Config{
 					Bucket:    "",
 					Region:    "us-east-1",
 					StartPath: "",
 				},
+				SMB: SMBConfig{
+					Port: 445,
+				},
 			}
 			if err := SaveConfig(configPath, config); err != nil {
 				return nil, err
@@ -75,6 +196,13 @@ func LoadConfig(configPath string) (*Config, error) {
 		return nil, fmt.Errorf("error parsing config file: %v", err)
 	}
 
+	ApplyEnv(&config)
+
+	return &config, nil
+}
+
+// ApplyEnv overrides configuration values with those set in the environment
+func ApplyEnv(config *Config) {
 	// Override credentials file path if environment variable is set
 	if credsPath := os.Getenv("SUPERSCAN_CONFIG_GOOGLE"); credsPath != "" {
 		config.GoogleDrive.CredentialsFile = credsPath
@@ -90,7 +218,36 @@ func LoadConfig(configPath string) (*Config, error) {
 		config.S3.Region = region
 	}
 
-	return &config, nil
+	// Override WebDAV connection settings if environment variables are set
+	if url := os.Getenv("SUPERSCAN_WEBDAV_URL"); url != "" {
+		config.WebDAV.URL = url
+	}
+	if username := os.Getenv("SUPERSCAN_WEBDAV_USERNAME"); username != "" {
+		config.WebDAV.Username = username
+	}
+	if password := os.Getenv("SUPERSCAN_WEBDAV_PASSWORD"); password != "" {
+		config.WebDAV.Password = password
+	}
+	if token := os.Getenv("SUPERSCAN_WEBDAV_TOKEN"); token != "" {
+		config.WebDAV.Token = token
+	}
+
+	// Override SMB connection settings if environment variables are set
+	if host := os.Getenv("SUPERSCAN_SMB_HOST"); host != "" {
+		config.SMB.Host = host
+	}
+	if username := os.Getenv("SUPERSCAN_SMB_USERNAME"); username != "" {
+		config.SMB.Username = username
+	}
+	if password := os.Getenv("SUPERSCAN_SMB_PASSWORD"); password != "" {
+		config.SMB.Password = password
+	}
+	if domain := os.Getenv("SUPERSCAN_SMB_DOMAIN"); domain != "" {
+		config.SMB.Domain = domain
+	}
+	if share := os.Getenv("SUPERSCAN_SMB_SHARE"); share != "" {
+		config.SMB.Share = share
+	}
 }
 
 // SaveConfig saves the configuration to a file
@@ -110,4 +267,4 @@ func GetConfigAsYAML(config *Config) (string, error) {
 		return "", fmt.Errorf("error marshaling config: %v", err)
 	}
 	return string(data), nil
-} 
\ No newline at end of file
+}
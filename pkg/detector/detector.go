@@ -0,0 +1,252 @@
+package detector
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/adaptive-scale/superscan/pkg/computation"
+	"github.com/adaptive-scale/superscan/pkg/extract"
+	"github.com/adaptive-scale/superscan/pkg/logger"
+	"github.com/adaptive-scale/superscan/pkg/scanerr"
+	"github.com/adaptive-scale/superscan/pkg/tabular"
+)
+
+// DefaultMaxSize is the largest content, in bytes, the engine scans by default
+const DefaultMaxSize = 10 * 1024 * 1024
+
+// binarySniffLen is how much of the content is inspected to decide whether it is binary
+const binarySniffLen = 8000
+
+// Finding describes a sensitive value found in scanned content
+type Finding struct {
+	// Rule is the name of the rule that matched
+	Rule string
+	// Path identifies the scanned content within its source
+	Path string
+	// Location points at the match inside the content, e.g. "line 12"
+	Location string
+	// Match is the redacted matched value
+	Match string
+	// Metadata holds source specific attribution such as commit or layer
+	Metadata map[string]string
+}
+
+// String returns a single line description of the finding
+func (f Finding) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %s", f.Rule, f.Path)
+	if f.Location != "" {
+		fmt.Fprintf(&b, " (%s)", f.Location)
+	}
+	fmt.Fprintf(&b, " %s", f.Match)
+
+	// Print metadata in a stable order
+	keys := make([]string, 0, len(f.Metadata))
+	for k := range f.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&b, " %s=%s", k, f.Metadata[k])
+	}
+	return b.String()
+}
+
+// Engine runs detection rules against content
+type Engine struct {
+	rules      []Rule
+	maxSize    int64
+	sampleRows int
+	sampler    *computation.Sampler
+	log        *logger.Logger
+}
+
+// NewEngine creates a new engine using the given rules, or the default rules if none are given
+func NewEngine(rules ...Rule) *Engine {
+	if len(rules) == 0 {
+		rules = DefaultRules()
+	}
+	return &Engine{
+		rules:      rules,
+		maxSize:    DefaultMaxSize,
+		sampleRows: tabular.DefaultSampleRows,
+		sampler:    computation.NewSampler(time.Now().UnixNano()),
+		log:        logger.New(logger.INFO),
+	}
+}
+
+// SetMaxSize sets the largest content, in bytes, the engine scans
+func (e *Engine) SetMaxSize(size int64) {
+	e.maxSize = size
+}
+
+// SetSampleRows sets how many rows of tabular data are sampled to classify its columns
+func (e *Engine) SetSampleRows(rows int) {
+	e.sampleRows = rows
+}
+
+// SetSeed makes sampling reproducible. Each file is sampled with a sampler derived
+// from the seed and its path, so results do not depend on scan order.
+func (e *Engine) SetSeed(seed int64) {
+	e.sampler = computation.NewSampler(seed)
+}
+
+// Seed returns the seed used for sampling
+func (e *Engine) Seed() int64 {
+	return e.sampler.Seed()
+}
+
+// Scan reads content and returns the findings of every rule. Documents such as PDF and
+// office files are converted to text first; other binary content and content larger
+// than the maximum size are skipped. Image and document metadata is reported as
+// metadata-* findings. If part of the content cannot be decoded, the findings of the
+// rest are returned along with a decode error.
+func (e *Engine) Scan(path string, r io.Reader) ([]Finding, error) {
+	data, err := io.ReadAll(io.LimitReader(r, e.maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if int64(len(data)) > e.maxSize {
+		e.log.Debug("Skipping %s: larger than %d bytes", path, e.maxSize)
+		return nil, nil
+	}
+
+	// Classify the columns of structured data, one finding per column rather than per cell
+	var findings []Finding
+	var decodeErr error
+	if tabular.Supported(path) {
+		table, err := tabular.Read(path, data)
+		if err != nil {
+			decodeErr = scanerr.Decode(fmt.Errorf("failed to read table %s: %v", path, err))
+		} else {
+			findings = append(findings, e.columnFindings(path, table)...)
+		}
+	}
+
+	// Report metadata that identifies people or places, such as EXIF GPS positions and document authors
+	if extract.MetadataSupported(path, data[:min(len(data), computation.SniffSize)]) {
+		props, err := extract.Metadata(path, data)
+		if err != nil && !errors.Is(err, extract.ErrEncrypted) && decodeErr == nil {
+			decodeErr = scanerr.Decode(fmt.Errorf("failed to read metadata of %s: %v", path, err))
+		}
+		for _, p := range props {
+			findings = append(findings, Finding{
+				Rule:     "metadata-" + p.Kind,
+				Path:     path,
+				Location: p.Location,
+				Match:    Redact(p.Value),
+				Metadata: map[string]string{"field": p.Field},
+			})
+		}
+	}
+
+	// Extract document text so findings can point at a page, sheet cell or slide
+	if extract.Supported(path) {
+		segments, err := extract.Extract(path, data)
+		if errors.Is(err, extract.ErrEncrypted) {
+			e.log.Debug("Skipping encrypted document: %s", path)
+			return findings, decodeErr
+		}
+		if err != nil {
+			return findings, scanerr.Decode(fmt.Errorf("failed to extract text from %s: %v", path, err))
+		}
+		for _, segment := range segments {
+			findings = append(findings, e.scanText(path, segment.Location, []byte(segment.Text))...)
+		}
+		return findings, decodeErr
+	}
+
+	if isBinary(data) {
+		e.log.Debug("Skipping binary content: %s", path)
+		return findings, decodeErr
+	}
+
+	return append(findings, e.scanText(path, "", data)...), decodeErr
+}
+
+// columnFindings reports every column of a table whose sampled values look like personal data
+func (e *Engine) columnFindings(path string, table *tabular.Table) []Finding {
+	var findings []Finding
+	for _, column := range tabular.Classify(table, e.sampleRows, e.sampler.Derive(path)) {
+		for _, hit := range column.Classes {
+			findings = append(findings, Finding{
+				Rule:     hit.Class,
+				Path:     path,
+				Location: fmt.Sprintf("column %s", column.Name),
+				Match:    Redact(hit.Example),
+				Metadata: map[string]string{
+					"hit_rate":  fmt.Sprintf("%.2f", hit.Rate),
+					"sampled":   fmt.Sprintf("%d", column.Sampled),
+					"non_empty": fmt.Sprintf("%d", column.NonEmpty),
+					"rows":      fmt.Sprintf("%d", len(table.Rows)),
+					"type":      column.Type,
+					"seed":      fmt.Sprintf("%d", e.sampler.Seed()),
+				},
+			})
+		}
+	}
+	return findings
+}
+
+// scanText matches every rule line by line. Lines are numbered within the segment
+// at segmentLocation, or within the whole content if it is empty.
+func (e *Engine) scanText(path, segmentLocation string, data []byte) []Finding {
+	var findings []Finding
+
+	multiline := bytes.IndexByte(bytes.TrimRight(data, "\r\n"), '\n') >= 0
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), len(data)+1)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+
+		location := fmt.Sprintf("line %d", line)
+		if segmentLocation != "" {
+			location = segmentLocation
+			if multiline {
+				location = fmt.Sprintf("%s, line %d", segmentLocation, line)
+			}
+		}
+
+		for _, rule := range e.rules {
+			for _, match := range rule.Pattern.FindAllStringSubmatch(text, -1) {
+				// Report the captured secret if the rule has a group, else the whole match
+				value := match[0]
+				if len(match) > 1 && match[1] != "" {
+					value = match[1]
+				}
+				findings = append(findings, Finding{
+					Rule:     rule.Name,
+					Path:     path,
+					Location: location,
+					Match:    Redact(value),
+				})
+			}
+		}
+	}
+
+	return findings
+}
+
+// Redact hides all but the first and last four characters of a matched value
+func Redact(value string) string {
+	if len(value) <= 8 {
+		return strings.Repeat("*", len(value))
+	}
+	return value[:4] + strings.Repeat("*", len(value)-8) + value[len(value)-4:]
+}
+
+// isBinary reports whether data looks like binary content
+func isBinary(data []byte) bool {
+	if len(data) > binarySniffLen {
+		data = data[:binarySniffLen]
+	}
+	return bytes.IndexByte(data, 0) >= 0
+}
@@ -0,0 +1,61 @@
+package detector
+
+import "regexp"
+
+// Rule describes a pattern that identifies one kind of sensitive data
+type Rule struct {
+	Name        string
+	Description string
+	Pattern     *regexp.Regexp
+}
+
+// DefaultRules returns the built-in secret detection rules
+func DefaultRules() []Rule {
+	return []Rule{
+		{
+			Name:        "aws-access-key-id",
+			Description: "AWS access key ID",
+			Pattern:     regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`),
+		},
+		{
+			Name:        "aws-secret-access-key",
+			Description: "AWS secret access key",
+			Pattern:     regexp.MustCompile(`(?i)aws.{0,20}secret.{0,20}['"=:\s]([0-9a-zA-Z/+]{40})\b`),
+		},
+		{
+			Name:        "private-key",
+			Description: "PEM encoded private key",
+			Pattern:     regexp.MustCompile(`-----BEGIN (?:RSA |EC |DSA |OPENSSH |PGP |ENCRYPTED )?PRIVATE KEY(?: BLOCK)?-----`),
+		},
+		{
+			Name:        "github-token",
+			Description: "GitHub personal access or app token",
+			Pattern:     regexp.MustCompile(`\b(?:ghp|gho|ghu|ghs|ghr)_[A-Za-z0-9]{36,}\b|\bgithub_pat_[A-Za-z0-9_]{60,}\b`),
+		},
+		{
+			Name:        "slack-token",
+			Description: "Slack API token",
+			Pattern:     regexp.MustCompile(`\bxox[abposr]-[0-9A-Za-z-]{10,}\b`),
+		},
+		{
+			Name:        "google-api-key",
+			Description: "Google API key",
+			Pattern:     regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`),
+		},
+		{
+			Name:        "stripe-secret-key",
+			Description: "Stripe live secret key",
+			Pattern:     regexp.MustCompile(`\b[rs]k_live_[0-9A-Za-z]{24,}\b`),
+		},
+		{
+			Name:        "jwt",
+			Description: "JSON Web Token",
+			Pattern:     regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`),
+		},
+		{
+			Name:        "password-assignment",
+			Description: "Hard-coded password or secret assignment",
+			Pattern:     regexp.MustCompile(`(?i)\b(?:password|passwd|pwd|secret|api_?key|access_?token)\b\s*[:=]\s*['"]?([^\s'"]{8,})`),
+		},
+	}
+}
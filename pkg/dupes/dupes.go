@@ -0,0 +1,409 @@
+package dupes
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/adaptive-scale/superscan/pkg/computation"
+	"github.com/adaptive-scale/superscan/pkg/logger"
+	"github.com/adaptive-scale/superscan/pkg/scanerr"
+	"github.com/adaptive-scale/superscan/pkg/source"
+	"lukechampine.com/blake3"
+)
+
+// PartialSize is how many leading bytes are hashed to rule out files of equal size cheaply
+const PartialSize = 64 * 1024
+
+// Target is a source and start path to search for duplicates
+type Target struct {
+	// Label prefixes the paths of the target's files in the report, e.g. "s3:exports"
+	Label     string
+	Source    source.Source
+	StartPath string
+}
+
+// File is a file found in one of the targets
+type File struct {
+	Label string
+	source.FileInfo
+	reader source.ContentReader
+	errors *scanerr.Log
+}
+
+// String returns the labelled path of the file
+func (f *File) String() string {
+	if f.RelPath != "" {
+		return path.Join(f.Label, f.RelPath)
+	}
+	return path.Join(f.Label, f.Path)
+}
+
+// Group is a set of files with identical content, or of visually identical images
+type Group struct {
+	// Size is the size of every file of an identical group, or of the first (largest) image
+	Size int64
+	// Digest identifies the content, e.g. "sha256:ab12..." or "md5:..." when only
+	// provider checksums were compared, or "image:..." for perceptual hashes
+	Digest string
+	Files  []*File
+	// Visual marks a group of images that look the same but whose bytes may differ
+	Visual bool
+	// Scores holds the similarity of each image to the first, for visual groups
+	Scores []float64
+}
+
+// Wasted returns the bytes used by all but the largest copy
+func (g *Group) Wasted() int64 {
+	var total, largest int64
+	for _, f := range g.Files {
+		total += f.Size
+		largest = max(largest, f.Size)
+	}
+	return total - largest
+}
+
+// Finder groups files by size, then by a hash of their first bytes, then by a full content hash
+type Finder struct {
+	hashName string
+	newHash  func() hash.Hash
+	images   bool
+	log      *logger.Logger
+}
+
+// NewFinder creates a finder using "sha256" or "blake3" for full content hashes
+func NewFinder(hashName string) (*Finder, error) {
+	f := &Finder{
+		hashName: hashName,
+		log:      logger.New(logger.INFO),
+	}
+	switch hashName {
+	case "sha256", "":
+		f.hashName = "sha256"
+		f.newHash = sha256.New
+	case "blake3":
+		f.newHash = func() hash.Hash { return blake3.New(32, nil) }
+	default:
+		return nil, fmt.Errorf("unsupported hash: %s", hashName)
+	}
+	return f, nil
+}
+
+// SetImages enables grouping of images that look identical, such as resized or
+// recompressed copies, in addition to byte-identical files
+func (d *Finder) SetImages(enabled bool) {
+	d.images = enabled
+}
+
+// Find lists every target and returns the groups of duplicate files, largest waste
+// first. If ctx is cancelled while comparing files, the groups found so far are
+// returned along with its error.
+func (d *Finder) Find(ctx context.Context, targets []Target) ([]*Group, error) {
+	// Group files by size
+	bySize := make(map[int64][]*File)
+	var images []*File
+	for _, t := range targets {
+		walker, ok := t.Source.(source.Walker)
+		if !ok {
+			return nil, fmt.Errorf("source %s cannot be searched for duplicates", t.Source.GetName())
+		}
+		reader, ok := t.Source.(source.ContentReader)
+		if !ok {
+			return nil, fmt.Errorf("source %s cannot be searched for duplicates", t.Source.GetName())
+		}
+
+		d.log.Info("Listing %s", t.Label)
+		err := walker.Walk(ctx, t.StartPath, func(info source.FileInfo) error {
+			// Empty files are trivially identical and waste nothing
+			if info.Size > 0 {
+				f := &File{Label: t.Label, FileInfo: info, reader: reader, errors: t.Source.Errors()}
+				bySize[info.Size] = append(bySize[info.Size], f)
+				if d.images && computation.IsImageFile(f.String()) {
+					images = append(images, f)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, fmt.Errorf("failed to list %s: %v", t.Label, err)
+		}
+	}
+
+	var groups []*Group
+	for size, files := range bySize {
+		if ctx.Err() != nil {
+			break
+		}
+		if len(files) < 2 {
+			continue
+		}
+		groups = append(groups, d.groupBySize(ctx, size, files)...)
+	}
+	if len(images) > 1 && ctx.Err() == nil {
+		groups = append(groups, d.groupImages(ctx, images, groups)...)
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Wasted() != groups[j].Wasted() {
+			return groups[i].Wasted() > groups[j].Wasted()
+		}
+		return groups[i].Digest < groups[j].Digest
+	})
+	return groups, ctx.Err()
+}
+
+// groupBySize splits files of equal size into groups of identical content
+func (d *Finder) groupBySize(ctx context.Context, size int64, files []*File) []*Group {
+	// Files with a provider checksum need no download, but the others can then
+	// only be compared with them by their MD5
+	var withMD5, without []*File
+	for _, f := range files {
+		if f.MD5 != "" {
+			withMD5 = append(withMD5, f)
+		} else {
+			without = append(without, f)
+		}
+	}
+
+	// Without provider checksums to compare against, rule out most files by their first bytes
+	candidates := without
+	if len(withMD5) == 0 && size > PartialSize {
+		candidates = d.partialCollisions(ctx, without)
+	}
+
+	// Hash candidates in full; MD5 is computed alongside to match provider checksums
+	digests := make(map[*File][]string)
+	for _, f := range withMD5 {
+		digests[f] = append(digests[f], "md5:"+f.MD5)
+	}
+	if len(candidates) > 1 || len(withMD5) > 0 {
+		for _, f := range candidates {
+			full, md5sum, err := d.hashFile(ctx, f, -1)
+			if err != nil {
+				if ctx.Err() != nil {
+					break
+				}
+				f.errors.Add(f.String(), "hash file", err)
+				continue
+			}
+			digests[f] = append(digests[f], d.hashName+":"+full, "md5:"+md5sum)
+		}
+	}
+
+	return groupByDigest(size, files, digests)
+}
+
+// groupImages groups images that look the same. Groups whose images are all
+// copies of each other were already found by content and are left out.
+func (d *Finder) groupImages(ctx context.Context, images []*File, identical []*Group) []*Group {
+	exact := make(map[*File]*Group)
+	for _, g := range identical {
+		for _, f := range g.Files {
+			exact[f] = g
+		}
+	}
+
+	var hashed []*File
+	var items []computation.Item
+	for _, f := range images {
+		h, err := d.hashImage(ctx, f)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			f.errors.Add(f.String(), "hash image", err)
+			continue
+		}
+		hashed = append(hashed, f)
+		items = append(items, computation.Item{File: computation.File{Name: f.String(), Size: f.Size}, Image: &h})
+	}
+
+	var groups []*Group
+	for _, c := range computation.ClusterItems(items, computation.ImageDuplicateSimilarity) {
+		if len(c.Members) < 2 {
+			continue
+		}
+
+		// Copies of one file that were already grouped by content
+		first := exact[hashed[c.Representative()]]
+		sameGroup := first != nil
+		for _, m := range c.Members {
+			sameGroup = sameGroup && exact[hashed[m.Index]] == first
+		}
+		if sameGroup {
+			continue
+		}
+
+		// The largest image comes first, as the copy worth keeping
+		members := c.Members
+		sort.SliceStable(members, func(i, j int) bool {
+			return hashed[members[i].Index].Size > hashed[members[j].Index].Size
+		})
+		kept := items[members[0].Index].Image
+		group := &Group{
+			Size:   hashed[members[0].Index].Size,
+			Digest: "image:" + kept.String(),
+			Visual: true,
+		}
+		for _, m := range members {
+			group.Files = append(group.Files, hashed[m.Index])
+			group.Scores = append(group.Scores, items[m.Index].Image.Similarity(*kept))
+		}
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// hashImage computes the perceptual hash of an image file
+func (d *Finder) hashImage(ctx context.Context, f *File) (computation.ImageHash, error) {
+	rc, err := f.reader.ReadFile(ctx, f.Path)
+	if err != nil {
+		return computation.ImageHash{}, err
+	}
+	defer rc.Close()
+	return computation.HashImage(rc)
+}
+
+// partialCollisions returns the files whose leading bytes match at least one other file
+func (d *Finder) partialCollisions(ctx context.Context, files []*File) []*File {
+	byPartial := make(map[string][]*File)
+	for _, f := range files {
+		partial, _, err := d.hashFile(ctx, f, PartialSize)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			f.errors.Add(f.String(), "hash file", err)
+			continue
+		}
+		byPartial[partial] = append(byPartial[partial], f)
+	}
+
+	var candidates []*File
+	for _, group := range byPartial {
+		if len(group) > 1 {
+			candidates = append(candidates, group...)
+		}
+	}
+	return candidates
+}
+
+// hashFile hashes the first limit bytes of a file, or all of it if limit is negative,
+// returning the configured hash and the MD5
+func (d *Finder) hashFile(ctx context.Context, f *File, limit int64) (string, string, error) {
+	rc, err := f.reader.ReadFile(ctx, f.Path)
+	if err != nil {
+		return "", "", err
+	}
+	defer rc.Close()
+
+	var r io.Reader = rc
+	if limit >= 0 {
+		r = io.LimitReader(rc, limit)
+	}
+	h := d.newHash()
+	m := md5.New()
+	if _, err := io.Copy(io.MultiWriter(h, m), r); err != nil {
+		return "", "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), hex.EncodeToString(m.Sum(nil)), nil
+}
+
+// groupByDigest joins files sharing any digest into groups with more than one file
+func groupByDigest(size int64, files []*File, digests map[*File][]string) []*Group {
+	// Union-find over files, linking files that share a digest
+	parent := make(map[*File]*File)
+	var find func(f *File) *File
+	find = func(f *File) *File {
+		if parent[f] != f {
+			parent[f] = find(parent[f])
+		}
+		return parent[f]
+	}
+	owner := make(map[string]*File)
+	for _, f := range files {
+		if _, ok := digests[f]; !ok {
+			continue
+		}
+		parent[f] = f
+		for _, digest := range digests[f] {
+			if other, ok := owner[digest]; ok {
+				parent[find(f)] = find(other)
+			} else {
+				owner[digest] = f
+			}
+		}
+	}
+
+	members := make(map[*File][]*File)
+	for _, f := range files {
+		if _, ok := parent[f]; ok {
+			root := find(f)
+			members[root] = append(members[root], f)
+		}
+	}
+
+	var groups []*Group
+	for root, group := range members {
+		if len(group) < 2 {
+			continue
+		}
+		sort.Slice(group, func(i, j int) bool { return group[i].String() < group[j].String() })
+		groups = append(groups, &Group{
+			Size:   size,
+			Digest: preferredDigest(group, digests, root),
+			Files:  group,
+		})
+	}
+	return groups
+}
+
+// preferredDigest names a group by its strong content hash if any member was hashed in full
+func preferredDigest(group []*File, digests map[*File][]string, root *File) string {
+	for _, f := range group {
+		for _, digest := range digests[f] {
+			if !strings.HasPrefix(digest, "md5:") {
+				return digest
+			}
+		}
+	}
+	return digests[root][0]
+}
+
+// Display prints each group of duplicates and the total bytes they waste
+func Display(groups []*Group) {
+	if len(groups) == 0 {
+		fmt.Println("\n✅ No duplicate files found")
+		return
+	}
+
+	var wasted int64
+	files := 0
+	fmt.Printf("\n🗂  Duplicate files\n")
+	for _, g := range groups {
+		wasted += g.Wasted()
+		files += len(g.Files)
+		if g.Visual {
+			fmt.Printf("\n  %d visually identical images, %d bytes wasted (%s)\n", len(g.Files), g.Wasted(), g.Digest)
+			for i, f := range g.Files {
+				fmt.Printf("    %s (%d bytes, %.0f%% similar)\n", f, f.Size, g.Scores[i]*100)
+			}
+			continue
+		}
+		fmt.Printf("\n  %d copies of %d bytes, %d bytes wasted (%s)\n", len(g.Files), g.Size, g.Wasted(), g.Digest)
+		for _, f := range g.Files {
+			fmt.Printf("    %s\n", f)
+		}
+	}
+	fmt.Printf("\n  %d group(s), %d files, %d bytes wasted\n", len(groups), files, wasted)
+}
@@ -0,0 +1,332 @@
+package extract
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+)
+
+// EXIF tags reported as metadata, by IFD
+const (
+	tagArtist             = 0x013b
+	tagExifIFD            = 0x8769
+	tagGPSIFD             = 0x8825
+	tagXPComment          = 0x9c9c
+	tagXPAuthor           = 0x9c9d
+	tagCameraSerialNumber = 0xc62f
+	tagUserComment        = 0x9286
+	tagCameraOwnerName    = 0xa430
+	tagBodySerialNumber   = 0xa431
+	tagLensSerialNumber   = 0xa435
+	tagGPSLatitudeRef     = 1
+	tagGPSLatitude        = 2
+	tagGPSLongitudeRef    = 3
+	tagGPSLongitude       = 4
+)
+
+// exifTypeSizes is the size in bytes of one value of each TIFF field type
+var exifTypeSizes = map[uint16]int{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8}
+
+// exifEntry is a field of a TIFF image file directory
+type exifEntry struct {
+	typ   uint16
+	count int
+	value []byte
+}
+
+// imageMetadata returns the EXIF, XMP and text metadata of a JPEG, PNG, WebP or TIFF image
+func imageMetadata(data []byte) []Property {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xff, 0xd8}):
+		return jpegMetadata(data)
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return pngMetadata(data)
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return webpMetadata(data)
+	case bytes.HasPrefix(data, []byte("II*\x00")), bytes.HasPrefix(data, []byte("MM\x00*")):
+		return exifMetadata(data)
+	}
+	return nil
+}
+
+// jpegMetadata reads the APP1 (EXIF and XMP) and comment segments of a JPEG
+func jpegMetadata(data []byte) []Property {
+	var props []Property
+	i := 2
+	for i+4 <= len(data) && data[i] == 0xff {
+		marker := data[i+1]
+		// Image data follows the start of scan; there is no metadata after it
+		if marker == 0xda || marker == 0xd9 {
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			break
+		}
+		segment := data[i+4 : i+2+length]
+
+		switch {
+		case marker == 0xe1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")):
+			props = append(props, exifMetadata(segment[6:])...)
+		case marker == 0xe1 && bytes.HasPrefix(segment, []byte("http://ns.adobe.com/xap/1.0/\x00")):
+			props = append(props, xmpMetadata(segment[29:])...)
+		case marker == 0xfe:
+			props = append(props, Property{Kind: KindComment, Field: "COM", Location: "JPEG comment", Value: string(segment)})
+		}
+		i += 2 + length
+	}
+	return props
+}
+
+// pngMetadata reads the eXIf chunk and the text chunks of a PNG
+func pngMetadata(data []byte) []Property {
+	var props []Property
+	i := 8
+	for i+12 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		kind := string(data[i+4 : i+8])
+		if length < 0 || i+12+length > len(data) {
+			break
+		}
+		chunk := data[i+8 : i+8+length]
+		i += 12 + length
+
+		switch kind {
+		case "eXIf":
+			props = append(props, exifMetadata(chunk)...)
+		case "tEXt", "zTXt", "iTXt":
+			keyword, text, ok := pngText(kind, chunk)
+			if !ok {
+				continue
+			}
+			switch keyword {
+			case "XML:com.adobe.xmp":
+				props = append(props, xmpMetadata([]byte(text))...)
+			case "Author":
+				props = append(props, Property{Kind: KindAuthor, Field: keyword, Location: "PNG text", Value: text})
+			case "Comment":
+				props = append(props, Property{Kind: KindComment, Field: keyword, Location: "PNG text", Value: text})
+			}
+		case "IEND":
+			return props
+		}
+	}
+	return props
+}
+
+// pngText decodes a tEXt, zTXt or iTXt chunk into its keyword and text
+func pngText(kind string, chunk []byte) (string, string, bool) {
+	keyword, rest, ok := bytes.Cut(chunk, []byte{0})
+	if !ok {
+		return "", "", false
+	}
+	compressed := false
+	switch kind {
+	case "zTXt":
+		if len(rest) < 1 {
+			return "", "", false
+		}
+		compressed, rest = true, rest[1:]
+	case "iTXt":
+		// Compression flag and method, then language tag and translated keyword
+		if len(rest) < 2 {
+			return "", "", false
+		}
+		compressed = rest[0] == 1
+		rest = rest[2:]
+		for n := 0; n < 2; n++ {
+			if _, rest, ok = bytes.Cut(rest, []byte{0}); !ok {
+				return "", "", false
+			}
+		}
+	}
+	if compressed {
+		zr, err := zlib.NewReader(bytes.NewReader(rest))
+		if err != nil {
+			return "", "", false
+		}
+		defer zr.Close()
+		if rest, err = io.ReadAll(io.LimitReader(zr, maxPartSize)); err != nil {
+			return "", "", false
+		}
+	}
+	return string(keyword), string(rest), true
+}
+
+// webpMetadata reads the EXIF and XMP chunks of a WebP
+func webpMetadata(data []byte) []Property {
+	var props []Property
+	i := 12
+	for i+8 <= len(data) {
+		kind := string(data[i : i+4])
+		length := int(binary.LittleEndian.Uint32(data[i+4:]))
+		if length < 0 || i+8+length > len(data) {
+			break
+		}
+		chunk := data[i+8 : i+8+length]
+		// Chunks are padded to an even size
+		i += 8 + length + length%2
+
+		switch kind {
+		case "EXIF":
+			props = append(props, exifMetadata(bytes.TrimPrefix(chunk, []byte("Exif\x00\x00")))...)
+		case "XMP ":
+			props = append(props, xmpMetadata(chunk)...)
+		}
+	}
+	return props
+}
+
+// exifMetadata reads authors, comments, serial numbers and GPS position from TIFF
+// structured EXIF data
+func exifMetadata(tiff []byte) []Property {
+	if len(tiff) < 8 {
+		return nil
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil
+	}
+
+	ifd0 := readIFD(tiff, order, int(order.Uint32(tiff[4:])))
+	exif := map[uint16]exifEntry{}
+	if e, ok := ifd0[tagExifIFD]; ok {
+		exif = readIFD(tiff, order, int(exifUint(e, order)))
+	}
+	gps := map[uint16]exifEntry{}
+	if e, ok := ifd0[tagGPSIFD]; ok {
+		gps = readIFD(tiff, order, int(exifUint(e, order)))
+	}
+
+	var props []Property
+	add := func(kind, field, value string) {
+		if value = strings.TrimSpace(value); value != "" {
+			props = append(props, Property{Kind: kind, Field: field, Location: "EXIF", Value: value})
+		}
+	}
+	add(KindAuthor, "Artist", exifString(ifd0[tagArtist]))
+	add(KindAuthor, "XPAuthor", utf16String(ifd0[tagXPAuthor].value, binary.LittleEndian))
+	add(KindComment, "XPComment", utf16String(ifd0[tagXPComment].value, binary.LittleEndian))
+	add(KindSerial, "CameraSerialNumber", exifString(ifd0[tagCameraSerialNumber]))
+	add(KindAuthor, "CameraOwnerName", exifString(exif[tagCameraOwnerName]))
+	add(KindSerial, "BodySerialNumber", exifString(exif[tagBodySerialNumber]))
+	add(KindSerial, "LensSerialNumber", exifString(exif[tagLensSerialNumber]))
+	add(KindComment, "UserComment", userComment(exif[tagUserComment].value, order))
+
+	lat, latOK := gpsCoordinate(gps[tagGPSLatitude], exifString(gps[tagGPSLatitudeRef]), order)
+	lon, lonOK := gpsCoordinate(gps[tagGPSLongitude], exifString(gps[tagGPSLongitudeRef]), order)
+	if latOK && lonOK {
+		add(KindGPS, "GPSLatitude/GPSLongitude", fmt.Sprintf("%.5f, %.5f", lat, lon))
+	}
+	return props
+}
+
+// readIFD reads the entries of the image file directory at offset
+func readIFD(tiff []byte, order binary.ByteOrder, offset int) map[uint16]exifEntry {
+	entries := make(map[uint16]exifEntry)
+	if offset < 8 || offset+2 > len(tiff) {
+		return entries
+	}
+	n := int(order.Uint16(tiff[offset:]))
+	for i := 0; i < n; i++ {
+		pos := offset + 2 + i*12
+		if pos+12 > len(tiff) {
+			break
+		}
+		tag := order.Uint16(tiff[pos:])
+		typ := order.Uint16(tiff[pos+2:])
+		count := int(order.Uint32(tiff[pos+4:]))
+		size, ok := exifTypeSizes[typ]
+		if !ok || count < 0 || count > len(tiff) {
+			continue
+		}
+
+		// Values of up to four bytes are stored in the entry itself
+		value := tiff[pos+8 : pos+12]
+		if total := size * count; total > 4 {
+			start := int(order.Uint32(tiff[pos+8:]))
+			if start < 0 || start+total > len(tiff) {
+				continue
+			}
+			value = tiff[start : start+total]
+		} else {
+			value = value[:total]
+		}
+		entries[tag] = exifEntry{typ: typ, count: count, value: value}
+	}
+	return entries
+}
+
+// exifUint returns a SHORT or LONG value
+func exifUint(e exifEntry, order binary.ByteOrder) uint32 {
+	switch {
+	case e.typ == 3 && len(e.value) >= 2:
+		return uint32(order.Uint16(e.value))
+	case e.typ == 4 && len(e.value) >= 4:
+		return order.Uint32(e.value)
+	}
+	return 0
+}
+
+// exifString returns an ASCII value without its NUL terminator
+func exifString(e exifEntry) string {
+	return strings.TrimRight(string(e.value), "\x00 ")
+}
+
+// userComment decodes an EXIF UserComment, which starts with an eight byte character code
+func userComment(value []byte, order binary.ByteOrder) string {
+	if len(value) < 8 {
+		return ""
+	}
+	code, text := string(value[:8]), value[8:]
+	switch {
+	case strings.HasPrefix(code, "UNICODE"):
+		return utf16String(text, order)
+	case strings.HasPrefix(code, "ASCII"), code == "\x00\x00\x00\x00\x00\x00\x00\x00":
+		return strings.TrimRight(string(text), "\x00 ")
+	}
+	return ""
+}
+
+// utf16String decodes NUL terminated UTF-16 text
+func utf16String(value []byte, order binary.ByteOrder) string {
+	units := make([]uint16, 0, len(value)/2)
+	for i := 0; i+1 < len(value); i += 2 {
+		u := order.Uint16(value[i:])
+		if u == 0 {
+			break
+		}
+		units = append(units, u)
+	}
+	return string(utf16.Decode(units))
+}
+
+// gpsCoordinate converts degrees, minutes and seconds rationals to signed decimal degrees
+func gpsCoordinate(e exifEntry, ref string, order binary.ByteOrder) (float64, bool) {
+	if e.typ != 5 || e.count < 3 || len(e.value) < 24 {
+		return 0, false
+	}
+	var parts [3]float64
+	for i := range parts {
+		num := order.Uint32(e.value[i*8:])
+		den := order.Uint32(e.value[i*8+4:])
+		if den == 0 {
+			return 0, false
+		}
+		parts[i] = float64(num) / float64(den)
+	}
+	deg := parts[0] + parts[1]/60 + parts[2]/3600
+	if ref == "S" || ref == "W" {
+		deg = -deg
+	}
+	return deg, true
+}
@@ -0,0 +1,92 @@
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// maxPartSize bounds how much of a single document part is decompressed
+const maxPartSize = 64 * 1024 * 1024
+
+// Segment is a piece of text extracted from a document along with where it was found
+type Segment struct {
+	// Location identifies the segment within the document, e.g. "page 3" or "Sheet2!C14"
+	Location string
+	Text     string
+}
+
+// extractors maps lower case file extensions to their extractor
+var extractors = map[string]func([]byte) ([]Segment, error){
+	".pdf":  extractPDF,
+	".docx": extractDOCX,
+	".docm": extractDOCX,
+	".xlsx": extractXLSX,
+	".xlsm": extractXLSX,
+	".pptx": extractPPTX,
+	".pptm": extractPPTX,
+	".odt":  extractODF,
+	".ods":  extractODF,
+	".odp":  extractODF,
+}
+
+// Supported reports whether text can be extracted from a file with this name
+func Supported(name string) bool {
+	_, ok := extractors[strings.ToLower(filepath.Ext(name))]
+	return ok
+}
+
+// Extract converts a document into text segments
+func Extract(name string, data []byte) ([]Segment, error) {
+	extractor, ok := extractors[strings.ToLower(filepath.Ext(name))]
+	if !ok {
+		return nil, fmt.Errorf("unsupported document type: %s", name)
+	}
+	return extractor(data)
+}
+
+// openZip opens a zip based document (OOXML or OpenDocument)
+func openZip(data []byte) (*zip.Reader, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open document container: %v", err)
+	}
+	return zr, nil
+}
+
+// readZipFile reads a part of a zip based document, returning nil if it does not exist
+func readZipFile(zr *zip.Reader, name string) ([]byte, error) {
+	for _, f := range zr.File {
+		if f.Name != name {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %v", name, err)
+		}
+		defer rc.Close()
+
+		data, err := io.ReadAll(io.LimitReader(rc, maxPartSize+1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", name, err)
+		}
+		if len(data) > maxPartSize {
+			return nil, fmt.Errorf("%s is larger than %d bytes", name, maxPartSize)
+		}
+		return data, nil
+	}
+	return nil, nil
+}
+
+// columnName converts a zero based column index to its spreadsheet name (0 -> A, 27 -> AB)
+func columnName(index int) string {
+	name := ""
+	for index >= 0 {
+		name = string(rune('A'+index%26)) + name
+		index = index/26 - 1
+	}
+	return name
+}
@@ -0,0 +1,437 @@
+package extract
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/adaptive-scale/superscan/pkg/computation"
+)
+
+// Kinds of metadata that can identify people or places
+const (
+	KindGPS            = "gps"
+	KindAuthor         = "author"
+	KindLastModifiedBy = "last-modified-by"
+	KindSerial         = "serial-number"
+	KindComment        = "comment"
+	KindInternalPath   = "internal-path"
+)
+
+// Property is a metadata value of a file that may leak personal data
+type Property struct {
+	// Kind is one of the Kind constants
+	Kind string
+	// Field names the metadata field, e.g. "Artist" or "cp:lastModifiedBy"
+	Field string
+	// Location is where in the file the field was found, e.g. "EXIF" or "core properties"
+	Location string
+	Value    string
+}
+
+var (
+	// xmlTagPattern matches XML tags, to reduce element content to its text
+	xmlTagPattern = regexp.MustCompile(`<[^>]*>`)
+	// xmpCoordinatePattern matches an XMP GPS coordinate such as "41,24.2028N"
+	xmpCoordinatePattern = regexp.MustCompile(`^(\d+(?:\.\d+)?),(\d+(?:\.\d+)?)(?:,(\d+(?:\.\d+)?))?([NSEW])$`)
+	// pdfInfoPattern matches the reference to the document information dictionary
+	pdfInfoPattern = regexp.MustCompile(`/Info\s+(\d+)\s+\d+\s+R`)
+	// pdfKeyPattern matches a name followed by a string in a dictionary
+	pdfKeyPattern = regexp.MustCompile(`/(Author|Contents|T)\s*([(<])`)
+	// windowsPathPattern matches drive letter and UNC paths
+	windowsPathPattern = regexp.MustCompile(`^(?:file:/*)?(?:[A-Za-z]:[\\/]|\\\\[^\\]+\\)`)
+)
+
+// xmpField is an XMP property that may identify a person
+type xmpField struct {
+	name string
+	kind string
+}
+
+// xmpFields are the XMP properties reported as metadata
+var xmpFields = []xmpField{
+	{"dc:creator", KindAuthor},
+	{"exifEX:CameraOwnerName", KindAuthor},
+	{"aux:OwnerName", KindAuthor},
+	{"aux:SerialNumber", KindSerial},
+	{"aux:LensSerialNumber", KindSerial},
+	{"exifEX:BodySerialNumber", KindSerial},
+	{"exifEX:LensSerialNumber", KindSerial},
+	{"exif:UserComment", KindComment},
+	// Files placed into a Photoshop or Illustrator document
+	{"stRef:filePath", KindInternalPath},
+}
+
+// xmpPatterns match each XMP property written as an attribute or as an element
+var xmpPatterns = func() map[string]*regexp.Regexp {
+	patterns := make(map[string]*regexp.Regexp)
+	for _, name := range []string{"exif:GPSLatitude", "exif:GPSLongitude"} {
+		patterns[name] = xmpPattern(name)
+	}
+	for _, f := range xmpFields {
+		patterns[f.name] = xmpPattern(f.name)
+	}
+	return patterns
+}()
+
+// xmpPattern matches name="value" or <name ...>value</name>
+func xmpPattern(name string) *regexp.Regexp {
+	q := regexp.QuoteMeta(name)
+	return regexp.MustCompile(`(?s)\b` + q + `="([^"]*)"|<` + q + `\b[^>]*>(.*?)</` + q + `>`)
+}
+
+// xmlEntities replaces the predefined XML entities and common character references
+var xmlEntities = strings.NewReplacer("&lt;", "<", "&gt;", ">", "&quot;", `"`, "&apos;", "'", "&#xA;", "\n", "&#xD;", "\r", "&#x9;", "\t", "&amp;", "&")
+
+// metadataReaders maps lower case document extensions to their metadata reader
+var metadataReaders = map[string]func([]byte) ([]Property, error){
+	".pdf":  pdfMetadata,
+	".docx": ooxmlMetadata,
+	".docm": ooxmlMetadata,
+	".xlsx": ooxmlMetadata,
+	".xlsm": ooxmlMetadata,
+	".pptx": ooxmlMetadata,
+	".pptm": ooxmlMetadata,
+	".odt":  odfMetadata,
+	".ods":  odfMetadata,
+	".odp":  odfMetadata,
+}
+
+// MetadataSupported reports whether metadata can be read from a file with this name
+// and first bytes: JPEG, PNG, WebP and TIFF images by content, documents by extension
+func MetadataSupported(name string, header []byte) bool {
+	if _, ok := metadataReaders[strings.ToLower(filepath.Ext(name))]; ok {
+		return true
+	}
+	switch computation.DetectType(header) {
+	case "jpeg", "png", "webp", "tiff":
+		return true
+	}
+	return false
+}
+
+// Metadata returns the GPS positions, authors, serial numbers, comments and internal
+// paths recorded in an image's EXIF and XMP or a document's properties
+func Metadata(name string, data []byte) ([]Property, error) {
+	var props []Property
+	if reader, ok := metadataReaders[strings.ToLower(filepath.Ext(name))]; ok {
+		var err error
+		if props, err = reader(data); err != nil {
+			return nil, err
+		}
+	} else {
+		props = imageMetadata(data)
+	}
+
+	// The same value is often stored in several places, e.g. EXIF and XMP
+	seen := make(map[string]bool)
+	unique := props[:0]
+	for _, p := range props {
+		p.Value = strings.TrimSpace(p.Value)
+		key := p.Kind + "\x00" + p.Value
+		if p.Value == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, p)
+	}
+	return unique, nil
+}
+
+// xmpMetadata reads the properties of an XMP packet
+func xmpMetadata(packet []byte) []Property {
+	var props []Property
+	for _, f := range xmpFields {
+		for _, value := range xmpValues(packet, f.name) {
+			props = append(props, Property{Kind: f.kind, Field: f.name, Location: "XMP", Value: value})
+		}
+	}
+
+	lat := xmpValues(packet, "exif:GPSLatitude")
+	lon := xmpValues(packet, "exif:GPSLongitude")
+	if len(lat) > 0 && len(lon) > 0 {
+		latDeg, latOK := xmpCoordinate(lat[0])
+		lonDeg, lonOK := xmpCoordinate(lon[0])
+		if latOK && lonOK {
+			props = append(props, Property{
+				Kind:     KindGPS,
+				Field:    "exif:GPSLatitude/exif:GPSLongitude",
+				Location: "XMP",
+				Value:    fmt.Sprintf("%.5f, %.5f", latDeg, lonDeg),
+			})
+		}
+	}
+	return props
+}
+
+// xmpValues returns the values of an XMP property, with the markup of structured
+// values such as rdf:Seq lists reduced to their text
+func xmpValues(packet []byte, name string) []string {
+	var values []string
+	for _, m := range xmpPatterns[name].FindAllSubmatch(packet, -1) {
+		value := string(m[1])
+		if m[2] != nil {
+			value = xmlTagPattern.ReplaceAllString(string(m[2]), " ")
+		}
+		if value = strings.Join(strings.Fields(xmlEntities.Replace(value)), " "); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// xmpCoordinate converts an XMP coordinate ("DDD,MM.mmk" or "DDD,MM,SSk") to signed decimal degrees
+func xmpCoordinate(value string) (float64, bool) {
+	m := xmpCoordinatePattern.FindStringSubmatch(value)
+	if m == nil {
+		return 0, false
+	}
+	deg, _ := strconv.ParseFloat(m[1], 64)
+	min, _ := strconv.ParseFloat(m[2], 64)
+	sec, _ := strconv.ParseFloat(m[3], 64)
+	deg += min/60 + sec/3600
+	if m[4] == "S" || m[4] == "W" {
+		deg = -deg
+	}
+	return deg, true
+}
+
+// ooxmlMetadata reads the core properties, comments and external relationships of
+// an OOXML document
+func ooxmlMetadata(data []byte) ([]Property, error) {
+	zr, err := openZip(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var props []Property
+	core, err := readZipFile(zr, "docProps/core.xml")
+	if err != nil {
+		return nil, err
+	}
+	props = append(props, xmlFields(core, "core properties", map[string]string{
+		"creator":        KindAuthor,
+		"lastModifiedBy": KindLastModifiedBy,
+		"description":    KindComment,
+	})...)
+
+	for _, f := range zr.File {
+		switch {
+		case f.Name == "word/comments.xml" || strings.HasPrefix(f.Name, "xl/comments") ||
+			strings.HasPrefix(f.Name, "ppt/comments/"):
+			part, err := readZipFile(zr, f.Name)
+			if err != nil {
+				return props, err
+			}
+			props = append(props, ooxmlComments(f.Name, part)...)
+		case f.Name == "ppt/commentAuthors.xml":
+			part, err := readZipFile(zr, f.Name)
+			if err != nil {
+				return props, err
+			}
+			props = append(props, xmlAttributes(part, f.Name, "cmAuthor", "name", KindAuthor)...)
+		case f.Name == "xl/workbook.xml":
+			part, err := readZipFile(zr, f.Name)
+			if err != nil {
+				return props, err
+			}
+			// Excel records the folder a workbook was last saved in
+			props = append(props, xmlAttributes(part, f.Name, "absPath", "url", KindInternalPath)...)
+		case strings.HasSuffix(f.Name, ".rels"):
+			part, err := readZipFile(zr, f.Name)
+			if err != nil {
+				return props, err
+			}
+			// Templates, linked files and images referenced by local or network paths
+			for _, p := range xmlAttributes(part, f.Name, "Relationship", "Target", KindInternalPath) {
+				if windowsPathPattern.MatchString(p.Value) || strings.HasPrefix(p.Value, "file:") {
+					props = append(props, p)
+				}
+			}
+		}
+	}
+	return props, nil
+}
+
+// ooxmlComments reads the authors and text of the comments of a Word, Excel or PowerPoint part
+func ooxmlComments(part string, data []byte) []Property {
+	var props []Property
+	props = append(props, xmlAttributes(data, part, "comment", "author", KindAuthor)...)
+	props = append(props, xmlFields(data, part, map[string]string{"author": KindAuthor})...)
+
+	// Comment text, one property per comment
+	d := xml.NewDecoder(bytes.NewReader(data))
+	var text strings.Builder
+	depth := 0
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Local == "comment" || t.Name.Local == "cm" {
+				depth++
+				text.Reset()
+			}
+		case xml.EndElement:
+			if (t.Name.Local == "comment" || t.Name.Local == "cm") && depth > 0 {
+				depth--
+				props = append(props, Property{Kind: KindComment, Field: t.Name.Local, Location: part, Value: text.String()})
+			}
+		case xml.CharData:
+			if depth > 0 {
+				text.Write(t)
+				text.WriteByte(' ')
+			}
+		}
+	}
+	return props
+}
+
+// odfMetadata reads the document properties of an OpenDocument file
+func odfMetadata(data []byte) ([]Property, error) {
+	zr, err := openZip(data)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := readZipFile(zr, "meta.xml")
+	if err != nil {
+		return nil, err
+	}
+	return xmlFields(meta, "meta.xml", map[string]string{
+		"initial-creator": KindAuthor,
+		"creator":         KindLastModifiedBy,
+		"description":     KindComment,
+	}), nil
+}
+
+// xmlFields returns the text of every element whose local name is in fields
+func xmlFields(data []byte, location string, fields map[string]string) []Property {
+	var props []Property
+	d := xml.NewDecoder(bytes.NewReader(data))
+	var current xml.Name
+	var text strings.Builder
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if _, ok := fields[t.Name.Local]; ok {
+				current = t.Name
+				text.Reset()
+			}
+		case xml.EndElement:
+			if t.Name == current {
+				props = append(props, Property{Kind: fields[t.Name.Local], Field: t.Name.Local, Location: location, Value: text.String()})
+				current = xml.Name{}
+			}
+		case xml.CharData:
+			if current.Local != "" {
+				text.Write(t)
+			}
+		}
+	}
+	return props
+}
+
+// xmlAttributes returns an attribute of every element with the given local name
+func xmlAttributes(data []byte, location, element, attribute, kind string) []Property {
+	var props []Property
+	d := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			break
+		}
+		if t, ok := tok.(xml.StartElement); ok && t.Name.Local == element {
+			if value := attr(t, attribute); value != "" {
+				props = append(props, Property{Kind: kind, Field: element + "@" + attribute, Location: location, Value: value})
+			}
+		}
+	}
+	return props
+}
+
+// pdfMetadata reads the document information dictionary, XMP metadata and the
+// annotations (comments) of a PDF
+func pdfMetadata(data []byte) ([]Property, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(data, "\x00\t\r\n "), []byte("%PDF")) {
+		return nil, fmt.Errorf("not a PDF file")
+	}
+	if bytes.Contains(data, []byte("/Encrypt")) {
+		return nil, ErrEncrypted
+	}
+	doc := parsePDF(data)
+
+	var props []Property
+	// The last /Info reference belongs to the latest incremental update
+	if refs := pdfInfoPattern.FindAllSubmatch(data, -1); len(refs) > 0 {
+		num, _ := strconv.Atoi(string(refs[len(refs)-1][1]))
+		if info, ok := doc.objects[num]; ok {
+			for key, value := range pdfStrings(info.dict) {
+				if key == "Author" {
+					props = append(props, Property{Kind: KindAuthor, Field: "/Author", Location: "PDF info", Value: value})
+				}
+			}
+		}
+	}
+
+	for _, obj := range doc.objects {
+		switch {
+		case strings.Contains(obj.dict, "/Metadata") && strings.Contains(obj.dict, "/XML"):
+			if packet, err := decodeStream(obj); err == nil {
+				props = append(props, xmpMetadata(packet)...)
+			}
+		case strings.Contains(obj.dict, "/Annot"):
+			strs := pdfStrings(obj.dict)
+			if author := strs["T"]; author != "" {
+				props = append(props, Property{Kind: KindAuthor, Field: "/T", Location: "PDF annotation", Value: author})
+			}
+			if comment := strs["Contents"]; comment != "" {
+				props = append(props, Property{Kind: KindComment, Field: "/Contents", Location: "PDF annotation", Value: comment})
+			}
+		}
+	}
+	return props, nil
+}
+
+// pdfStrings returns the string values of the /Author, /Contents and /T keys of a dictionary
+func pdfStrings(dict string) map[string]string {
+	strs := make(map[string]string)
+	for _, m := range pdfKeyPattern.FindAllStringSubmatchIndex(dict, -1) {
+		key := dict[m[2]:m[3]]
+		var value string
+		if dict[m[4]] == '(' {
+			value, _ = readLiteralString([]byte(dict), m[4])
+		} else {
+			value, _ = readHexString([]byte(dict), m[4])
+		}
+		strs[key] = pdfText(value)
+	}
+	return strs
+}
+
+// pdfText decodes a PDF text string, which is either PDFDocEncoding or UTF-16BE with a byte order mark
+func pdfText(s string) string {
+	if !strings.HasPrefix(s, "\xfe\xff") {
+		return s
+	}
+	s = s[2:]
+	// Hex strings have had their zero bytes dropped already
+	if !strings.Contains(s, "\x00") || len(s)%2 == 1 {
+		return s
+	}
+	units := make([]uint16, len(s)/2)
+	for i := range units {
+		units[i] = uint16(s[2*i])<<8 | uint16(s[2*i+1])
+	}
+	return string(utf16.Decode(units))
+}
@@ -0,0 +1,171 @@
+package extract
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// odfState tracks where the decoder is inside an OpenDocument content.xml
+type odfState struct {
+	segments []Segment
+
+	// Text documents
+	paragraph int
+
+	// Spreadsheets
+	sheet    string
+	row      int
+	col      int
+	colSpan  int
+	rowSpan  int
+	inCell   bool
+	cellText strings.Builder
+
+	// Presentations
+	page     int
+	inPage   bool
+	pageText strings.Builder
+
+	text  strings.Builder
+	depth int
+}
+
+// extractODF returns the text of an OpenDocument text, spreadsheet or presentation.
+// Paragraphs are located as "paragraph N", cells as "Sheet!C14" and pages as "slide N".
+func extractODF(data []byte) ([]Segment, error) {
+	zr, err := openZip(data)
+	if err != nil {
+		return nil, err
+	}
+	content, err := readZipFile(zr, "content.xml")
+	if err != nil {
+		return nil, err
+	}
+	if content == nil {
+		return nil, fmt.Errorf("content.xml not found")
+	}
+
+	s := &odfState{}
+	d := xml.NewDecoder(bytes.NewReader(content))
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return s.segments, fmt.Errorf("failed to parse content.xml: %v", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			s.start(t)
+		case xml.EndElement:
+			s.end(t)
+		case xml.CharData:
+			if s.depth > 0 {
+				s.text.Write(t)
+			}
+		}
+	}
+	return s.segments, nil
+}
+
+// start handles an opening element
+func (s *odfState) start(t xml.StartElement) {
+	switch t.Name.Local {
+	case "table":
+		s.sheet = attr(t, "name")
+		s.row = 0
+	case "table-row":
+		s.col = 0
+		s.rowSpan = repeated(t, "number-rows-repeated")
+	case "table-cell", "covered-table-cell":
+		s.inCell = true
+		s.colSpan = repeated(t, "number-columns-repeated")
+		s.cellText.Reset()
+	case "page":
+		s.page++
+		s.inPage = true
+		s.pageText.Reset()
+	case "p", "h":
+		if s.depth == 0 {
+			s.text.Reset()
+		}
+		s.depth++
+	case "s":
+		if s.depth > 0 {
+			s.text.WriteString(strings.Repeat(" ", repeated(t, "c")))
+		}
+	case "tab":
+		if s.depth > 0 {
+			s.text.WriteByte('\t')
+		}
+	case "line-break":
+		if s.depth > 0 {
+			s.text.WriteByte('\n')
+		}
+	}
+}
+
+// end handles a closing element
+func (s *odfState) end(t xml.EndElement) {
+	switch t.Name.Local {
+	case "p", "h":
+		s.depth--
+		if s.depth > 0 {
+			return
+		}
+		text := s.text.String()
+		switch {
+		case s.inCell:
+			if s.cellText.Len() > 0 {
+				s.cellText.WriteByte('\n')
+			}
+			s.cellText.WriteString(text)
+		case s.inPage:
+			s.pageText.WriteString(text)
+			s.pageText.WriteByte('\n')
+		default:
+			s.paragraph++
+			if strings.TrimSpace(text) != "" {
+				s.segments = append(s.segments, Segment{
+					Location: fmt.Sprintf("paragraph %d", s.paragraph),
+					Text:     text,
+				})
+			}
+		}
+	case "table-cell", "covered-table-cell":
+		s.inCell = false
+		if strings.TrimSpace(s.cellText.String()) != "" {
+			s.segments = append(s.segments, Segment{
+				Location: fmt.Sprintf("%s!%s%d", s.sheet, columnName(s.col), s.row+1),
+				Text:     s.cellText.String(),
+			})
+		}
+		s.col += s.colSpan
+	case "table-row":
+		s.row += s.rowSpan
+	case "table":
+		s.sheet = ""
+	case "page":
+		s.inPage = false
+		if strings.TrimSpace(s.pageText.String()) != "" {
+			s.segments = append(s.segments, Segment{
+				Location: fmt.Sprintf("slide %d", s.page),
+				Text:     s.pageText.String(),
+			})
+		}
+	}
+}
+
+// repeated returns a repeat count attribute, defaulting to 1
+func repeated(t xml.StartElement, name string) int {
+	if n, err := strconv.Atoi(attr(t, name)); err == nil && n > 0 {
+		return n
+	}
+	return 1
+}
@@ -0,0 +1,404 @@
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// slidePattern matches slide parts of a presentation
+var slidePattern = regexp.MustCompile(`^ppt/slides/slide(\d+)\.xml$`)
+
+// cellRefPattern splits a cell reference such as C14 into column and row
+var cellRefPattern = regexp.MustCompile(`^([A-Z]+)(\d+)$`)
+
+// extractDOCX returns one segment per non-empty paragraph of a Word document
+func extractDOCX(data []byte) ([]Segment, error) {
+	zr, err := openZip(data)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := readZipFile(zr, "word/document.xml")
+	if err != nil {
+		return nil, err
+	}
+	if doc == nil {
+		return nil, fmt.Errorf("word/document.xml not found")
+	}
+
+	var segments []Segment
+	var text strings.Builder
+	paragraph := 0
+
+	d := xml.NewDecoder(bytes.NewReader(doc))
+	inText := false
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return segments, fmt.Errorf("failed to parse document.xml: %v", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "p":
+				paragraph++
+				text.Reset()
+			case "t":
+				inText = true
+			case "tab":
+				text.WriteByte('\t')
+			case "br", "cr":
+				text.WriteByte('\n')
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				if s := strings.TrimSpace(text.String()); s != "" {
+					segments = append(segments, Segment{
+						Location: fmt.Sprintf("paragraph %d", paragraph),
+						Text:     s,
+					})
+				}
+			}
+		case xml.CharData:
+			if inText {
+				text.Write(t)
+			}
+		}
+	}
+	return segments, nil
+}
+
+// extractXLSX returns one segment per non-empty cell of an Excel workbook
+func extractXLSX(data []byte) ([]Segment, error) {
+	zr, err := openZip(data)
+	if err != nil {
+		return nil, err
+	}
+
+	sharedStrings, err := readSharedStrings(zr)
+	if err != nil {
+		return nil, err
+	}
+	sheets, err := readSheetList(zr)
+	if err != nil {
+		return nil, err
+	}
+
+	var segments []Segment
+	for _, sheet := range sheets {
+		part, err := readZipFile(zr, sheet.part)
+		if err != nil {
+			return segments, err
+		}
+		if part == nil {
+			continue
+		}
+		sheetSegments, err := extractSheet(sheet.name, part, sharedStrings)
+		if err != nil {
+			return segments, err
+		}
+		segments = append(segments, sheetSegments...)
+	}
+	return segments, nil
+}
+
+// xlsxSheet is a worksheet name and the zip part holding it
+type xlsxSheet struct {
+	name string
+	part string
+}
+
+// readSheetList returns the worksheets of a workbook in workbook order
+func readSheetList(zr *zip.Reader) ([]xlsxSheet, error) {
+	workbook, err := readZipFile(zr, "xl/workbook.xml")
+	if err != nil {
+		return nil, err
+	}
+	if workbook == nil {
+		return nil, fmt.Errorf("xl/workbook.xml not found")
+	}
+	rels, err := readZipFile(zr, "xl/_rels/workbook.xml.rels")
+	if err != nil {
+		return nil, err
+	}
+
+	// Map relationship IDs to worksheet parts
+	targets := make(map[string]string)
+	var relDoc struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if rels != nil {
+		if err := xml.Unmarshal(rels, &relDoc); err != nil {
+			return nil, fmt.Errorf("failed to parse workbook relationships: %v", err)
+		}
+	}
+	for _, rel := range relDoc.Relationships {
+		target := rel.Target
+		if strings.HasPrefix(target, "/") {
+			target = strings.TrimPrefix(target, "/")
+		} else {
+			target = path.Join("xl", target)
+		}
+		targets[rel.ID] = target
+	}
+
+	var wbDoc struct {
+		Sheets []struct {
+			Name  string     `xml:"name,attr"`
+			Attrs []xml.Attr `xml:",any,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := xml.Unmarshal(workbook, &wbDoc); err != nil {
+		return nil, fmt.Errorf("failed to parse workbook.xml: %v", err)
+	}
+
+	sheets := make([]xlsxSheet, 0, len(wbDoc.Sheets))
+	for i, s := range wbDoc.Sheets {
+		part := fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1)
+		for _, attr := range s.Attrs {
+			if attr.Name.Local == "id" {
+				if target, ok := targets[attr.Value]; ok {
+					part = target
+				}
+			}
+		}
+		sheets = append(sheets, xlsxSheet{name: s.Name, part: part})
+	}
+	return sheets, nil
+}
+
+// readSharedStrings returns the shared string table of a workbook
+func readSharedStrings(zr *zip.Reader) ([]string, error) {
+	data, err := readZipFile(zr, "xl/sharedStrings.xml")
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	var strs []string
+	var current strings.Builder
+	inText := false
+	d := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return strs, fmt.Errorf("failed to parse sharedStrings.xml: %v", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "si":
+				current.Reset()
+			case "t":
+				inText = true
+			case "rPh":
+				// Phonetic hints repeat the text and are skipped
+				if err := d.Skip(); err != nil {
+					return strs, err
+				}
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "si":
+				strs = append(strs, current.String())
+			}
+		case xml.CharData:
+			if inText {
+				current.Write(t)
+			}
+		}
+	}
+	return strs, nil
+}
+
+// extractSheet returns the non-empty cells of a worksheet
+func extractSheet(name string, data []byte, sharedStrings []string) ([]Segment, error) {
+	var segments []Segment
+
+	var cellRef, cellType string
+	var value strings.Builder
+	inValue := false
+	row, col := 0, -1
+
+	d := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return segments, fmt.Errorf("failed to parse sheet %s: %v", name, err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "row":
+				row++
+				col = -1
+				if r := attr(t, "r"); r != "" {
+					if n, err := strconv.Atoi(r); err == nil {
+						row = n
+					}
+				}
+			case "c":
+				col++
+				cellRef = attr(t, "r")
+				cellType = attr(t, "t")
+				value.Reset()
+				if m := cellRefPattern.FindStringSubmatch(cellRef); m != nil {
+					col = columnIndex(m[1])
+				} else {
+					cellRef = fmt.Sprintf("%s%d", columnName(col), row)
+				}
+			case "v", "t":
+				inValue = true
+			case "f":
+				// Formulas are not values
+				if err := d.Skip(); err != nil {
+					return segments, err
+				}
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "v", "t":
+				inValue = false
+			case "c":
+				text := value.String()
+				if cellType == "s" {
+					if idx, err := strconv.Atoi(strings.TrimSpace(text)); err == nil && idx >= 0 && idx < len(sharedStrings) {
+						text = sharedStrings[idx]
+					}
+				}
+				if strings.TrimSpace(text) != "" {
+					segments = append(segments, Segment{
+						Location: fmt.Sprintf("%s!%s", name, cellRef),
+						Text:     text,
+					})
+				}
+			}
+		case xml.CharData:
+			if inValue {
+				value.Write(t)
+			}
+		}
+	}
+	return segments, nil
+}
+
+// extractPPTX returns one segment per slide of a PowerPoint presentation
+func extractPPTX(data []byte) ([]Segment, error) {
+	zr, err := openZip(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Order slides by number rather than by zip order
+	type slide struct {
+		number int
+		name   string
+	}
+	var slides []slide
+	for _, f := range zr.File {
+		if m := slidePattern.FindStringSubmatch(f.Name); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			slides = append(slides, slide{number: n, name: f.Name})
+		}
+	}
+	sort.Slice(slides, func(i, j int) bool { return slides[i].number < slides[j].number })
+
+	var segments []Segment
+	for _, s := range slides {
+		part, err := readZipFile(zr, s.name)
+		if err != nil {
+			return segments, err
+		}
+		text, err := drawingText(part)
+		if err != nil {
+			return segments, fmt.Errorf("failed to parse slide %d: %v", s.number, err)
+		}
+		if strings.TrimSpace(text) != "" {
+			segments = append(segments, Segment{
+				Location: fmt.Sprintf("slide %d", s.number),
+				Text:     text,
+			})
+		}
+	}
+	return segments, nil
+}
+
+// drawingText returns the text runs of a DrawingML part, one line per paragraph
+func drawingText(data []byte) (string, error) {
+	var text strings.Builder
+	inText := false
+	d := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return text.String(), err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Local == "t" {
+				inText = true
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				text.WriteByte('\n')
+			}
+		case xml.CharData:
+			if inText {
+				text.Write(t)
+			}
+		}
+	}
+	return text.String(), nil
+}
+
+// attr returns the value of an attribute by local name
+func attr(el xml.StartElement, local string) string {
+	for _, a := range el.Attr {
+		if a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// columnIndex converts a spreadsheet column name to a zero based index (A -> 0, AB -> 27)
+func columnIndex(name string) int {
+	index := 0
+	for _, c := range name {
+		index = index*26 + int(c-'A') + 1
+	}
+	return index - 1
+}
@@ -0,0 +1,475 @@
+package extract
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	// pdfObjectPattern matches the start of an indirect object, e.g. "12 0 obj"
+	pdfObjectPattern = regexp.MustCompile(`(\d+)\s+\d+\s+obj\b`)
+	// pdfRefPattern matches an indirect reference, e.g. "12 0 R"
+	pdfRefPattern = regexp.MustCompile(`(\d+)\s+\d+\s+R\b`)
+	// pdfLengthPattern matches a direct stream length
+	pdfLengthPattern = regexp.MustCompile(`/Length\s+(\d+)(\s+\d+\s+R)?`)
+	// pdfStreamPattern matches the stream keyword and its end of line
+	pdfStreamPattern = regexp.MustCompile(`stream\r?\n`)
+	// pdfPagesPattern matches the page tree root of the catalog
+	pdfPagesPattern = regexp.MustCompile(`/Pages\s+(\d+)\s+\d+\s+R`)
+	// pdfKidsPattern matches the children of a page tree node
+	pdfKidsPattern = regexp.MustCompile(`/Kids\s*\[([^\]]*)\]`)
+	// pdfContentsPattern matches the content streams of a page
+	pdfContentsPattern = regexp.MustCompile(`/Contents\s*(\[[^\]]*\]|\d+\s+\d+\s+R)`)
+	// pdfRootPattern matches the catalog of a trailer or cross-reference stream
+	pdfRootPattern = regexp.MustCompile(`/Root\s+(\d+)\s+\d+\s+R`)
+)
+
+// ErrEncrypted is returned for encrypted PDF files, whose text cannot be read. It is
+// not a decode failure: such files are skipped on purpose.
+var ErrEncrypted = errors.New("encrypted PDF files are not supported")
+
+// pdfObject is an indirect object of a PDF file
+type pdfObject struct {
+	dict   string
+	stream []byte
+}
+
+// pdfDocument holds the objects of a PDF file by number
+type pdfDocument struct {
+	objects map[int]*pdfObject
+	// root is the object number of the catalog named by the last trailer, 0 if none
+	root int
+}
+
+// extractPDF returns one segment per page of a PDF. Only text drawn with standard or
+// simple font encodings is recovered; text in images is not.
+func extractPDF(data []byte) ([]Segment, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(data, "\x00\t\r\n "), []byte("%PDF")) {
+		return nil, fmt.Errorf("not a PDF file")
+	}
+	if bytes.Contains(data, []byte("/Encrypt")) {
+		return nil, ErrEncrypted
+	}
+
+	doc := parsePDF(data)
+	pages := doc.pages()
+
+	var segments []Segment
+	for i, page := range pages {
+		var text strings.Builder
+		for _, ref := range doc.contentRefs(page) {
+			obj, ok := doc.objects[ref]
+			if !ok {
+				continue
+			}
+			content, err := decodeStream(obj)
+			if err != nil {
+				continue
+			}
+			text.WriteString(contentText(content))
+		}
+		if strings.TrimSpace(text.String()) != "" {
+			segments = append(segments, Segment{
+				Location: fmt.Sprintf("page %d", i+1),
+				Text:     text.String(),
+			})
+		}
+	}
+	return segments, nil
+}
+
+// parsePDF finds every indirect object, including those packed in object streams
+func parsePDF(data []byte) *pdfDocument {
+	doc := &pdfDocument{objects: make(map[int]*pdfObject)}
+
+	matches := pdfObjectPattern.FindAllSubmatchIndex(data, -1)
+	for i, m := range matches {
+		num, _ := strconv.Atoi(string(data[m[2]:m[3]]))
+		end := len(data)
+		if i+1 < len(matches) {
+			end = matches[i+1][0]
+		}
+		body := data[m[1]:end]
+		if idx := bytes.Index(body, []byte("endobj")); idx >= 0 && !bytes.Contains(body[:idx], []byte("stream")) {
+			body = body[:idx]
+		}
+
+		obj := &pdfObject{dict: string(body)}
+		if loc := pdfStreamPattern.FindIndex(body); loc != nil {
+			obj.dict = string(body[:loc[0]])
+			raw := body[loc[1]:]
+
+			// Use a direct /Length when present, otherwise search for endstream
+			if lm := pdfLengthPattern.FindStringSubmatch(obj.dict); lm != nil && lm[2] == "" {
+				if n, err := strconv.Atoi(lm[1]); err == nil && n <= len(raw) {
+					raw = raw[:n]
+				}
+			} else if idx := bytes.Index(raw, []byte("endstream")); idx >= 0 {
+				raw = bytes.TrimRight(raw[:idx], "\r\n")
+			}
+			obj.stream = raw
+		}
+		// Later definitions of an object (incremental updates) replace earlier ones
+		doc.objects[num] = obj
+	}
+
+	// The trailer of the last incremental update names the current catalog
+	if roots := pdfRootPattern.FindAllSubmatch(data, -1); len(roots) > 0 {
+		doc.root, _ = strconv.Atoi(string(roots[len(roots)-1][1]))
+	}
+
+	// Unpack object streams used by PDF 1.5 and later
+	for _, obj := range doc.objects {
+		if !strings.Contains(obj.dict, "/ObjStm") {
+			continue
+		}
+		doc.unpackObjectStream(obj)
+	}
+	return doc
+}
+
+// unpackObjectStream adds the objects compressed in an object stream
+func (doc *pdfDocument) unpackObjectStream(obj *pdfObject) {
+	data, err := decodeStream(obj)
+	if err != nil {
+		return
+	}
+	n := dictInt(obj.dict, "/N")
+	first := dictInt(obj.dict, "/First")
+	if n <= 0 || first <= 0 || first > len(data) {
+		return
+	}
+
+	header := strings.Fields(string(data[:first]))
+	for i := 0; i+1 < len(header) && i/2 < n; i += 2 {
+		num, err1 := strconv.Atoi(header[i])
+		offset, err2 := strconv.Atoi(header[i+1])
+		if err1 != nil || err2 != nil {
+			return
+		}
+		start := first + offset
+		end := len(data)
+		if i+3 < len(header) {
+			if next, err := strconv.Atoi(header[i+3]); err == nil {
+				end = first + next
+			}
+		}
+		if start > end || end > len(data) {
+			return
+		}
+		if _, exists := doc.objects[num]; !exists {
+			doc.objects[num] = &pdfObject{dict: string(data[start:end])}
+		}
+	}
+}
+
+// catalog returns the document catalog: the one named by the last trailer, or else
+// the lowest numbered catalog object
+func (doc *pdfDocument) catalog() *pdfObject {
+	if obj, ok := doc.objects[doc.root]; ok && strings.Contains(obj.dict, "/Catalog") {
+		return obj
+	}
+	nums := make([]int, 0, len(doc.objects))
+	for num := range doc.objects {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+	for _, num := range nums {
+		if obj := doc.objects[num]; strings.Contains(obj.dict, "/Catalog") {
+			return obj
+		}
+	}
+	return nil
+}
+
+// pages returns the page objects in document order by walking the page tree
+func (doc *pdfDocument) pages() []*pdfObject {
+	catalog := doc.catalog()
+	if catalog == nil {
+		return nil
+	}
+	m := pdfPagesPattern.FindStringSubmatch(catalog.dict)
+	if m == nil {
+		return nil
+	}
+	num, _ := strconv.Atoi(m[1])
+	root := doc.objects[num]
+	if root == nil {
+		return nil
+	}
+
+	var pages []*pdfObject
+	seen := make(map[*pdfObject]bool)
+	var walk func(node *pdfObject)
+	walk = func(node *pdfObject) {
+		if node == nil || seen[node] {
+			return
+		}
+		seen[node] = true
+
+		kids := pdfKidsPattern.FindStringSubmatch(node.dict)
+		if kids == nil {
+			pages = append(pages, node)
+			return
+		}
+		for _, ref := range pdfRefPattern.FindAllStringSubmatch(kids[1], -1) {
+			num, _ := strconv.Atoi(ref[1])
+			walk(doc.objects[num])
+		}
+	}
+	walk(root)
+	return pages
+}
+
+// contentRefs returns the object numbers of a page's content streams
+func (doc *pdfDocument) contentRefs(page *pdfObject) []int {
+	m := pdfContentsPattern.FindStringSubmatch(page.dict)
+	if m == nil {
+		return nil
+	}
+
+	var refs []int
+	for _, ref := range pdfRefPattern.FindAllStringSubmatch(m[1], -1) {
+		num, _ := strconv.Atoi(ref[1])
+		// A single reference may point at an array of content streams
+		if obj, ok := doc.objects[num]; ok && obj.stream == nil && strings.HasPrefix(strings.TrimSpace(obj.dict), "[") {
+			for _, inner := range pdfRefPattern.FindAllStringSubmatch(obj.dict, -1) {
+				n, _ := strconv.Atoi(inner[1])
+				refs = append(refs, n)
+			}
+			continue
+		}
+		refs = append(refs, num)
+	}
+	return refs
+}
+
+// decodeStream returns the decoded data of a stream, supporting FlateDecode
+func decodeStream(obj *pdfObject) ([]byte, error) {
+	if obj.stream == nil {
+		return nil, fmt.Errorf("object has no stream")
+	}
+	if !strings.Contains(obj.dict, "/FlateDecode") {
+		if strings.Contains(obj.dict, "/Filter") {
+			return nil, fmt.Errorf("unsupported stream filter")
+		}
+		return obj.stream, nil
+	}
+
+	zr, err := zlib.NewReader(bytes.NewReader(obj.stream))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	// Tolerate truncated streams by keeping what was decoded
+	data, err := io.ReadAll(io.LimitReader(zr, maxPartSize))
+	if len(data) == 0 && err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// dictInt returns an integer value of a dictionary key
+func dictInt(dict, key string) int {
+	m := regexp.MustCompile(regexp.QuoteMeta(key) + `\s+(\d+)`).FindStringSubmatch(dict)
+	if m == nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(m[1])
+	return n
+}
+
+// contentText interprets the text showing operators of a content stream
+func contentText(content []byte) string {
+	var text strings.Builder
+	var operands []string
+	var numbers []float64
+
+	for i := 0; i < len(content); {
+		c := content[i]
+		switch {
+		case c == '%':
+			// Comment to end of line
+			for i < len(content) && content[i] != '\n' && content[i] != '\r' {
+				i++
+			}
+		case c == '(':
+			s, next := readLiteralString(content, i)
+			operands = append(operands, s)
+			i = next
+		case c == '<' && i+1 < len(content) && content[i+1] != '<':
+			s, next := readHexString(content, i)
+			operands = append(operands, s)
+			i = next
+		case c == '[':
+			// TJ arrays mix strings with kerning adjustments
+			i++
+			var parts strings.Builder
+			for i < len(content) && content[i] != ']' {
+				switch {
+				case content[i] == '(':
+					s, next := readLiteralString(content, i)
+					parts.WriteString(s)
+					i = next
+				case content[i] == '<':
+					s, next := readHexString(content, i)
+					parts.WriteString(s)
+					i = next
+				case content[i] == '-' || (content[i] >= '0' && content[i] <= '9') || content[i] == '.':
+					start := i
+					for i < len(content) && (content[i] == '-' || content[i] == '.' || (content[i] >= '0' && content[i] <= '9')) {
+						i++
+					}
+					// Large negative adjustments separate words
+					if n, err := strconv.ParseFloat(string(content[start:i]), 64); err == nil && n < -200 {
+						parts.WriteByte(' ')
+					}
+				default:
+					i++
+				}
+			}
+			i++
+			operands = append(operands, parts.String())
+		case isPDFDelimiter(c):
+			i++
+		default:
+			start := i
+			for i < len(content) && !isPDFDelimiter(content[i]) && content[i] != '(' && content[i] != '<' && content[i] != '[' && content[i] != '%' {
+				i++
+			}
+			if i == start {
+				i++
+				continue
+			}
+			token := string(content[start:i])
+			if n, err := strconv.ParseFloat(token, 64); err == nil {
+				numbers = append(numbers, n)
+				continue
+			}
+
+			switch token {
+			case "Tj", "TJ":
+				if len(operands) > 0 {
+					text.WriteString(operands[len(operands)-1])
+				}
+			case "'", "\"":
+				text.WriteByte('\n')
+				if len(operands) > 0 {
+					text.WriteString(operands[len(operands)-1])
+				}
+			case "T*", "ET":
+				text.WriteByte('\n')
+			case "Td", "TD":
+				// Vertical moves start a new line, horizontal ones a new word
+				if len(numbers) >= 2 && numbers[len(numbers)-1] != 0 {
+					text.WriteByte('\n')
+				} else {
+					text.WriteByte(' ')
+				}
+			case "Tm":
+				text.WriteByte('\n')
+			}
+			operands = operands[:0]
+			numbers = numbers[:0]
+		}
+	}
+	return text.String()
+}
+
+// readLiteralString reads a balanced (...) string starting at i, handling escapes
+func readLiteralString(content []byte, i int) (string, int) {
+	var b strings.Builder
+	depth := 0
+	for i < len(content) {
+		c := content[i]
+		switch {
+		case c == '\\' && i+1 < len(content):
+			i++
+			switch e := content[i]; e {
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case 'b', 'f':
+			case '\r', '\n':
+				// Line continuation
+			default:
+				if e >= '0' && e <= '7' {
+					end := i
+					for end < len(content) && end < i+3 && content[end] >= '0' && content[end] <= '7' {
+						end++
+					}
+					n, _ := strconv.ParseUint(string(content[i:end]), 8, 8)
+					b.WriteByte(byte(n))
+					i = end - 1
+				} else {
+					b.WriteByte(e)
+				}
+			}
+		case c == '(':
+			if depth > 0 {
+				b.WriteByte(c)
+			}
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return b.String(), i + 1
+			}
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+		i++
+	}
+	return b.String(), i
+}
+
+// readHexString reads a <...> hex string starting at i
+func readHexString(content []byte, i int) (string, int) {
+	end := bytes.IndexByte(content[i:], '>')
+	if end < 0 {
+		return "", len(content)
+	}
+	hex := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(" \t\r\n", r) {
+			return -1
+		}
+		return r
+	}, string(content[i+1:i+end]))
+	if len(hex)%2 == 1 {
+		hex += "0"
+	}
+
+	var b strings.Builder
+	for j := 0; j+1 < len(hex); j += 2 {
+		n, err := strconv.ParseUint(hex[j:j+2], 16, 8)
+		if err != nil {
+			break
+		}
+		// Skip the high byte of two byte encodings so simple text stays readable
+		if n != 0 {
+			b.WriteByte(byte(n))
+		}
+	}
+	return b.String(), i + end + 1
+}
+
+// isPDFDelimiter reports whether c separates tokens in a content stream
+func isPDFDelimiter(c byte) bool {
+	switch c {
+	case ' ', '\t', '\r', '\n', '\f', 0, ']', '>', '{', '}', '/', ')':
+		return true
+	}
+	return false
+}
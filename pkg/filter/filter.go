@@ -0,0 +1,194 @@
+package filter
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+)
+
+const (
+	// IgnoreFile lists patterns of files to skip, with .gitignore syntax, in the
+	// directory it is in and below
+	IgnoreFile = ".superscanignore"
+	// GitIgnoreFile is honored like IgnoreFile when enabled
+	GitIgnoreFile = ".gitignore"
+)
+
+// Options configure a Filter. Patterns use .gitignore syntax and are matched against
+// slash separated paths relative to the start path: "*.log" matches at any depth,
+// "/build" only at the top, "docs/" only directories and "**" any number of
+// directories. A pattern starting with "!" re-includes what an earlier one excluded.
+type Options struct {
+	// Include limits scanning to files matching one of these patterns; all files if empty
+	Include []string
+	// Exclude skips files and directories matching one of these patterns
+	Exclude []string
+	// Hidden includes files and directories whose name starts with a dot on sources
+	// that skip them by default
+	Hidden bool
+	// GitIgnore honors .gitignore files as well as .superscanignore files
+	GitIgnore bool
+	// MaxDepth limits how many directory levels below the start path are listed, 1
+	// for its direct children only; 0 for no limit
+	MaxDepth int
+}
+
+// Filter decides which files of a source are listed and scanned. It is applied to
+// paths before any content is fetched, and excluded directories are not descended into.
+type Filter struct {
+	include   gitignore.Matcher
+	exclude   gitignore.Matcher
+	hidden    bool
+	gitIgnore bool
+	maxDepth  int
+}
+
+// New creates a filter from options
+func New(opts Options) *Filter {
+	f := &Filter{
+		exclude:   gitignore.NewMatcher(parsePatterns(opts.Exclude, nil)),
+		hidden:    opts.Hidden,
+		gitIgnore: opts.GitIgnore,
+		maxDepth:  opts.MaxDepth,
+	}
+	if len(opts.Include) > 0 {
+		f.include = gitignore.NewMatcher(parsePatterns(opts.Include, nil))
+	}
+	return f
+}
+
+// Match reports whether the file or directory at relPath should be listed. Include
+// patterns only apply to files, so that directories holding included files are walked.
+func (f *Filter) Match(relPath string, isDir bool) bool {
+	parts := splitPath(relPath)
+	if len(parts) == 0 {
+		return true
+	}
+	if f.maxDepth > 0 && len(parts) > f.maxDepth {
+		return false
+	}
+	if f.exclude.Match(parts, isDir) {
+		return false
+	}
+	if f.include != nil && !isDir {
+		return f.include.Match(parts, false)
+	}
+	return true
+}
+
+// Hidden reports whether hidden files and directories should be included
+func (f *Filter) Hidden() bool {
+	return f.hidden
+}
+
+// MaxDepth returns how many directory levels below the start path are listed, 0 for no limit
+func (f *Filter) MaxDepth() int {
+	return f.maxDepth
+}
+
+// IgnoreFiles returns the names of the ignore files to honor
+func (f *Filter) IgnoreFiles() []string {
+	if f.gitIgnore {
+		return []string{IgnoreFile, GitIgnoreFile}
+	}
+	return []string{IgnoreFile}
+}
+
+// Ignores reads the ignore files of a local directory tree as it is walked. The
+// ignore files of every directory between the root and a path apply to it, deeper
+// ones taking precedence. It is safe for concurrent use.
+type Ignores struct {
+	root  string
+	names []string
+
+	mu sync.Mutex
+	// patterns caches the patterns of each directory read so far, nil if it has none
+	patterns map[string][]gitignore.Pattern
+}
+
+// NewIgnores creates the ignore rules of the tree at root, reading the named ignore files
+func NewIgnores(root string, names []string) *Ignores {
+	return &Ignores{
+		root:     root,
+		names:    names,
+		patterns: make(map[string][]gitignore.Pattern),
+	}
+}
+
+// Ignored reports whether the file or directory at fullPath, below the root, is
+// excluded by an ignore file
+func (i *Ignores) Ignored(fullPath string, isDir bool) bool {
+	relPath, err := filepath.Rel(i.root, fullPath)
+	if err != nil || relPath == "." || strings.HasPrefix(relPath, "..") {
+		return false
+	}
+	parts := splitPath(filepath.ToSlash(relPath))
+
+	// Patterns of the root first, then of each directory down to the parent
+	var patterns []gitignore.Pattern
+	for depth := 0; depth < len(parts); depth++ {
+		patterns = append(patterns, i.dirPatterns(parts[:depth])...)
+	}
+	if len(patterns) == 0 {
+		return false
+	}
+	return gitignore.NewMatcher(patterns).Match(parts, isDir)
+}
+
+// dirPatterns returns the patterns of the ignore files in the directory at parts below the root
+func (i *Ignores) dirPatterns(parts []string) []gitignore.Pattern {
+	dir := filepath.Join(append([]string{i.root}, parts...)...)
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if patterns, ok := i.patterns[dir]; ok {
+		return patterns
+	}
+
+	var patterns []gitignore.Pattern
+	for _, name := range i.names {
+		patterns = append(patterns, readPatterns(filepath.Join(dir, name), parts)...)
+	}
+	i.patterns[dir] = patterns
+	return patterns
+}
+
+// readPatterns reads an ignore file, returning nothing if it does not exist or cannot be read
+func readPatterns(path string, domain []string) []gitignore.Pattern {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return parsePatterns(lines, domain)
+}
+
+// parsePatterns parses patterns, skipping blank lines and comments
+func parsePatterns(lines []string, domain []string) []gitignore.Pattern {
+	var patterns []gitignore.Pattern
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, gitignore.ParsePattern(line, domain))
+	}
+	return patterns
+}
+
+// splitPath splits a slash separated relative path into its components
+func splitPath(relPath string) []string {
+	relPath = strings.Trim(relPath, "/")
+	if relPath == "" || relPath == "." {
+		return nil
+	}
+	return strings.Split(relPath, "/")
+}
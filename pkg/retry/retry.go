@@ -0,0 +1,258 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/adaptive-scale/superscan/pkg/logger"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	// DefaultMaxAttempts is how often a request is tried before giving up
+	DefaultMaxAttempts = 6
+	// DefaultBaseDelay is the backoff before the first retry, doubled for every retry after it
+	DefaultBaseDelay = 500 * time.Millisecond
+	// DefaultMaxDelay caps the backoff between two attempts
+	DefaultMaxDelay = 30 * time.Second
+)
+
+// Error codes of S3 and Drive that mean a request should be slowed down and tried again
+var (
+	s3RetryCodes = map[string]bool{
+		"SlowDown":                 true,
+		"Throttling":               true,
+		"ThrottlingException":      true,
+		"RequestLimitExceeded":     true,
+		"RequestTimeout":           true,
+		"InternalError":            true,
+		"ServiceUnavailable":       true,
+		"TooManyRequestsException": true,
+	}
+	driveRetryReasons = map[string]bool{
+		"userRateLimitExceeded": true,
+		"rateLimitExceeded":     true,
+		"backendError":          true,
+	}
+)
+
+// Policy retries failed requests to a cloud API with exponential backoff and jitter,
+// and optionally limits how many requests per second are made
+type Policy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+
+	limiter *limiter
+	log     *logger.Logger
+}
+
+// DefaultPolicy returns a policy with the default backoff and no rate limit
+func DefaultPolicy() *Policy {
+	return &Policy{
+		MaxAttempts: DefaultMaxAttempts,
+		BaseDelay:   DefaultBaseDelay,
+		MaxDelay:    DefaultMaxDelay,
+		log:         logger.New(logger.INFO),
+	}
+}
+
+// SetQPS limits requests to qps per second across all goroutines; 0 removes the limit
+func (p *Policy) SetQPS(qps float64) {
+	if qps <= 0 {
+		p.limiter = nil
+		return
+	}
+	p.limiter = &limiter{interval: time.Duration(float64(time.Second) / qps)}
+}
+
+// Do calls fn until it succeeds, fails with an error that is not transient, runs out
+// of attempts or ctx is cancelled. op names the request in log messages.
+func (p *Policy) Do(ctx context.Context, op string, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		if p.limiter != nil {
+			if err := p.limiter.wait(ctx); err != nil {
+				return err
+			}
+		}
+
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		retryable, after := Retryable(err)
+		if !retryable || attempt >= p.MaxAttempts || ctx.Err() != nil {
+			return err
+		}
+
+		delay := p.backoff(attempt)
+		if after > delay {
+			delay = after
+		}
+		p.log.Info("%s failed, retrying in %s (attempt %d of %d): %v", op, delay.Round(time.Millisecond), attempt+1, p.MaxAttempts, err)
+		if err := sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// backoff returns a random delay of up to BaseDelay doubled for every earlier attempt
+func (p *Policy) backoff(attempt int) time.Duration {
+	ceiling := p.MaxDelay
+	if shift := attempt - 1; shift < 32 {
+		if d := p.BaseDelay << shift; d > 0 && d < ceiling {
+			ceiling = d
+		}
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	// Full jitter spreads out clients that failed at the same time
+	return time.Duration(rand.Int63n(int64(ceiling))) + 1
+}
+
+// Retryable reports whether err is transient: throttling, a server error or a
+// dropped connection. If the server said when to try again, that delay is returned.
+func Retryable(err error) (bool, time.Duration) {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false, 0
+	}
+
+	// Google APIs
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) {
+		after := retryAfter(gerr.Header)
+		if gerr.Code == http.StatusTooManyRequests || gerr.Code >= 500 {
+			return true, after
+		}
+		if gerr.Code == http.StatusForbidden {
+			for _, item := range gerr.Errors {
+				if driveRetryReasons[item.Reason] {
+					return true, after
+				}
+			}
+		}
+		return false, 0
+	}
+
+	// AWS APIs, which name throttling errors even when the status is generic
+	var after time.Duration
+	var rerr *smithyhttp.ResponseError
+	if errors.As(err, &rerr) && rerr.Response != nil {
+		after = retryAfter(rerr.Response.Header)
+		if code := rerr.HTTPStatusCode(); code == http.StatusTooManyRequests || code >= 500 {
+			return true, after
+		}
+	}
+	var aerr smithy.APIError
+	if errors.As(err, &aerr) {
+		return s3RetryCodes[aerr.ErrorCode()], after
+	}
+
+	// Other HTTP servers
+	var serr *StatusError
+	if errors.As(err, &serr) {
+		code := serr.StatusCode
+		return code == http.StatusTooManyRequests || code == http.StatusBadGateway ||
+			code == http.StatusServiceUnavailable || code == http.StatusGatewayTimeout, serr.RetryAfter
+	}
+
+	// Network failures
+	var nerr net.Error
+	if errors.As(err, &nerr) && nerr.Timeout() {
+		return true, 0
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.ErrUnexpectedEOF) {
+		return true, 0
+	}
+	return false, 0
+}
+
+// StatusError is an HTTP response with an unexpected status, for sources that talk
+// to HTTP servers directly
+type StatusError struct {
+	StatusCode int
+	RetryAfter time.Duration
+	Err        error
+}
+
+// NewStatusError wraps err, describing resp, with the status and Retry-After of resp
+func NewStatusError(resp *http.Response, err error) *StatusError {
+	return &StatusError{
+		StatusCode: resp.StatusCode,
+		RetryAfter: retryAfter(resp.Header),
+		Err:        err,
+	}
+}
+
+func (e *StatusError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
+// retryAfter parses a Retry-After header given in seconds or as an HTTP date
+func retryAfter(header http.Header) time.Duration {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// sleep waits for d or until ctx is cancelled
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// limiter spaces requests at least interval apart
+type limiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// wait blocks until the next request may be made
+func (l *limiter) wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	at := l.next
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+
+	if d := time.Until(at); d > 0 {
+		return sleep(ctx, d)
+	}
+	return nil
+}
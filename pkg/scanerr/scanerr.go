@@ -0,0 +1,239 @@
+package scanerr
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/adaptive-scale/superscan/pkg/logger"
+	"github.com/adaptive-scale/superscan/pkg/retry"
+	"github.com/aws/smithy-go"
+	"google.golang.org/api/googleapi"
+)
+
+// Category groups errors by what the user can do about them
+type Category string
+
+const (
+	// PermissionDenied means the credentials in use may not read the path
+	PermissionDenied Category = "permission denied"
+	// NotFound means the path disappeared between listing and reading it
+	NotFound Category = "not found"
+	// Throttled means the provider kept rate limiting requests after every retry
+	Throttled Category = "throttled"
+	// DecodeFailure means the content was read but could not be parsed
+	DecodeFailure Category = "decode failure"
+	// Other is any other error, such as a server or network failure
+	Other Category = "other"
+)
+
+// categories is the order in which categories are reported
+var categories = []Category{PermissionDenied, NotFound, Throttled, DecodeFailure, Other}
+
+// maxListed bounds how many paths are listed per category in a summary
+const maxListed = 20
+
+// Error codes of S3 and Drive that deny access or name a missing object
+var (
+	s3DeniedCodes   = map[string]bool{"AccessDenied": true, "AllAccessDisabled": true, "InvalidAccessKeyId": true, "SignatureDoesNotMatch": true}
+	s3NotFoundCodes = map[string]bool{"NoSuchKey": true, "NoSuchBucket": true, "NotFound": true}
+	s3ThrottleCodes = map[string]bool{"SlowDown": true, "Throttling": true, "ThrottlingException": true, "RequestLimitExceeded": true, "TooManyRequestsException": true}
+	driveThrottled  = map[string]bool{"userRateLimitExceeded": true, "rateLimitExceeded": true}
+)
+
+// PathError is a path that could not be listed, read or decoded
+type PathError struct {
+	Path     string   `json:"path"`
+	Op       string   `json:"op"`
+	Category Category `json:"category"`
+	Message  string   `json:"message"`
+}
+
+func (e PathError) String() string {
+	return fmt.Sprintf("%s: failed to %s: %s", e.Path, e.Op, e.Message)
+}
+
+// Log collects the errors of a scan per path. It is safe for concurrent use.
+type Log struct {
+	mu     sync.Mutex
+	errors []PathError
+	// unlisted holds the paths, relative to the start path, below which files may be
+	// missing from a walk
+	unlisted []string
+	log      *logger.Logger
+}
+
+// NewLog creates an empty error log
+func NewLog() *Log {
+	return &Log{
+		log: logger.New(logger.INFO),
+	}
+}
+
+// Add records that op failed for path with err, classifying the error
+func (l *Log) Add(path, op string, err error) {
+	l.add(PathError{
+		Path:     path,
+		Op:       op,
+		Category: Classify(err),
+		Message:  err.Error(),
+	})
+}
+
+// AddUnlisted records that op failed for a directory, folder or prefix at path with
+// err, so that the files below relPath, its path relative to the start path, may be
+// missing from the walk. relPath is "" if any file of the walk may be missing.
+func (l *Log) AddUnlisted(path, relPath, op string, err error) {
+	l.Add(path, op, err)
+	l.mu.Lock()
+	l.unlisted = append(l.unlisted, relPath)
+	l.mu.Unlock()
+}
+
+func (l *Log) add(e PathError) {
+	l.log.Error("Failed to %s %s (%s): %s", e.Op, e.Path, e.Category, e.Message)
+	l.mu.Lock()
+	l.errors = append(l.errors, e)
+	l.mu.Unlock()
+}
+
+// Errors returns the errors recorded so far
+func (l *Log) Errors() []PathError {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]PathError(nil), l.errors...)
+}
+
+// Unlisted returns the relative paths recorded by AddUnlisted so far, in order
+func (l *Log) Unlisted() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.unlisted...)
+}
+
+// Len returns the number of errors recorded so far
+func (l *Log) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.errors)
+}
+
+// decodeError marks content that was read but could not be parsed
+type decodeError struct {
+	err error
+}
+
+func (e *decodeError) Error() string {
+	return e.err.Error()
+}
+
+func (e *decodeError) Unwrap() error {
+	return e.err
+}
+
+// Decode marks err as a failure to parse content, so it is classified as DecodeFailure
+func Decode(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &decodeError{err: err}
+}
+
+// Classify returns the category of an error returned by a source or the detector
+func Classify(err error) Category {
+	var derr *decodeError
+	if errors.As(err, &derr) {
+		return DecodeFailure
+	}
+
+	// Google APIs
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) {
+		switch gerr.Code {
+		case http.StatusUnauthorized:
+			return PermissionDenied
+		case http.StatusNotFound:
+			return NotFound
+		case http.StatusTooManyRequests:
+			return Throttled
+		case http.StatusForbidden:
+			for _, item := range gerr.Errors {
+				if driveThrottled[item.Reason] {
+					return Throttled
+				}
+			}
+			return PermissionDenied
+		}
+		return Other
+	}
+
+	// AWS APIs
+	var aerr smithy.APIError
+	if errors.As(err, &aerr) {
+		code := aerr.ErrorCode()
+		switch {
+		case s3DeniedCodes[code]:
+			return PermissionDenied
+		case s3NotFoundCodes[code]:
+			return NotFound
+		case s3ThrottleCodes[code]:
+			return Throttled
+		}
+		return Other
+	}
+
+	// Other HTTP servers
+	var serr *retry.StatusError
+	if errors.As(err, &serr) {
+		switch serr.StatusCode {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return PermissionDenied
+		case http.StatusNotFound, http.StatusGone:
+			return NotFound
+		case http.StatusTooManyRequests:
+			return Throttled
+		}
+		return Other
+	}
+
+	// Local files and SMB shares
+	switch {
+	case errors.Is(err, fs.ErrPermission):
+		return PermissionDenied
+	case errors.Is(err, fs.ErrNotExist):
+		return NotFound
+	}
+	return Other
+}
+
+// Display prints how many paths failed per category, listing the first of each
+func Display(errs []PathError) {
+	if len(errs) == 0 {
+		return
+	}
+
+	byCategory := make(map[Category][]PathError)
+	for _, e := range errs {
+		byCategory[e.Category] = append(byCategory[e.Category], e)
+	}
+
+	fmt.Printf("\n⚠️  %d path(s) could not be listed, read or decoded; coverage is incomplete\n", len(errs))
+	for _, category := range categories {
+		list := byCategory[category]
+		if len(list) == 0 {
+			continue
+		}
+		sort.SliceStable(list, func(i, j int) bool { return list[i].Path < list[j].Path })
+		fmt.Printf("  %s: %d\n", category, len(list))
+		for i, e := range list {
+			if i == maxListed {
+				fmt.Printf("    ... and %d more\n", len(list)-maxListed)
+				break
+			}
+			fmt.Printf("    %s\n", e)
+		}
+	}
+}
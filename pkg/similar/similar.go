@@ -0,0 +1,192 @@
+package similar
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+
+	"github.com/adaptive-scale/superscan/pkg/computation"
+	"github.com/adaptive-scale/superscan/pkg/logger"
+	"github.com/adaptive-scale/superscan/pkg/source"
+)
+
+// Target is a source and start path to search for similar files
+type Target struct {
+	// Label prefixes the paths of the target's files in the report, e.g. "s3:logs"
+	Label     string
+	Source    source.Source
+	StartPath string
+}
+
+// File is a file found in one of the targets
+type File struct {
+	Label string
+	source.FileInfo
+	// Type is the type detected from the file's content, if it was read
+	Type string
+}
+
+// String returns the labelled path of the file
+func (f *File) String() string {
+	if f.RelPath != "" {
+		return path.Join(f.Label, f.RelPath)
+	}
+	return path.Join(f.Label, f.Path)
+}
+
+// Member is a file of a cluster with its similarity to the representative
+type Member struct {
+	File  *File
+	Score float64
+}
+
+// Cluster is a group of near duplicate files. The first member is the representative.
+type Cluster struct {
+	Members []Member
+}
+
+// Finder clusters near duplicate files by content, or by metadata alone
+type Finder struct {
+	threshold    float64
+	metadataOnly bool
+	images       bool
+	log          *logger.Logger
+}
+
+// NewFinder creates a finder grouping files at least threshold similar. With
+// metadataOnly, files are not read and are compared by type, extension and size.
+func NewFinder(threshold float64, metadataOnly bool) *Finder {
+	return &Finder{
+		threshold:    threshold,
+		metadataOnly: metadataOnly,
+		log:          logger.New(logger.INFO),
+	}
+}
+
+// SetImages makes the finder compare JPEG, PNG, GIF and WebP images by perceptual
+// hash, so resized or recompressed copies of a picture are clustered together.
+// Images are read for this even when comparing other files by metadata only.
+func (s *Finder) SetImages(enabled bool) {
+	s.images = enabled
+}
+
+// Find lists every target and clusters its files, largest cluster first. Sources
+// that cannot read file contents are clustered by metadata. If ctx is cancelled, the
+// files listed so far are clustered and returned along with its error.
+func (s *Finder) Find(ctx context.Context, targets []Target) ([]Cluster, error) {
+	var files []*File
+	var items []computation.Item
+	for _, t := range targets {
+		if ctx.Err() != nil {
+			break
+		}
+		walker, ok := t.Source.(source.Walker)
+		if !ok {
+			return nil, fmt.Errorf("source %s cannot be searched for similar files", t.Source.GetName())
+		}
+		reader, canRead := t.Source.(source.ContentReader)
+		if !canRead && !s.metadataOnly {
+			s.log.Info("Source %s cannot read files, comparing by metadata", t.Source.GetName())
+		}
+
+		s.log.Info("Listing %s", t.Label)
+		err := walker.Walk(ctx, t.StartPath, func(info source.FileInfo) error {
+			f := &File{Label: t.Label, FileInfo: info}
+			name := info.RelPath
+			if name == "" {
+				name = info.Path
+			}
+			item := computation.Item{File: computation.File{Name: name, Size: info.Size}}
+			switch {
+			case !canRead || info.Size == 0:
+			case s.images && computation.IsImageFile(name):
+				h, err := hashImage(ctx, reader, info.Path)
+				if err != nil {
+					if ctx.Err() != nil {
+						return ctx.Err()
+					}
+					t.Source.Errors().Add(f.String(), "hash image", err)
+				} else {
+					item.Image = &h
+				}
+			case !s.metadataOnly:
+				content, err := readHead(ctx, reader, info.Path)
+				if err != nil {
+					if ctx.Err() != nil {
+						return ctx.Err()
+					}
+					t.Source.Errors().Add(f.String(), "read file", err)
+				} else {
+					f.Type = computation.DetectType(content[:min(len(content), computation.SniffSize)])
+					item.File.Type = f.Type
+					item.Signature = computation.ContentSignature(content)
+				}
+			}
+			files = append(files, f)
+			items = append(items, item)
+			return nil
+		})
+		if err != nil && ctx.Err() == nil {
+			return nil, fmt.Errorf("failed to list %s: %v", t.Label, err)
+		}
+	}
+
+	var clusters []Cluster
+	for _, c := range computation.ClusterItems(items, s.threshold) {
+		cluster := Cluster{Members: make([]Member, len(c.Members))}
+		for i, m := range c.Members {
+			cluster.Members[i] = Member{File: files[m.Index], Score: m.Score}
+		}
+		clusters = append(clusters, cluster)
+	}
+	return clusters, ctx.Err()
+}
+
+// readHead reads the part of a file used for its signature
+func readHead(ctx context.Context, reader source.ContentReader, filePath string) ([]byte, error) {
+	rc, err := reader.ReadFile(ctx, filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(io.LimitReader(rc, computation.SignatureBytes))
+}
+
+// hashImage computes the perceptual hash of an image file
+func hashImage(ctx context.Context, reader source.ContentReader, filePath string) (computation.ImageHash, error) {
+	rc, err := reader.ReadFile(ctx, filePath)
+	if err != nil {
+		return computation.ImageHash{}, err
+	}
+	defer rc.Close()
+	return computation.HashImage(rc)
+}
+
+// Display prints every cluster of more than one file with its representative first
+func Display(clusters []Cluster) {
+	shown := 0
+	files := 0
+	for _, c := range clusters {
+		if len(c.Members) < 2 {
+			continue
+		}
+		if shown == 0 {
+			fmt.Printf("\n🧬 Similar files\n")
+		}
+		shown++
+		files += len(c.Members)
+
+		fmt.Printf("\n  Cluster %d: %d files\n", shown, len(c.Members))
+		fmt.Printf("    ★ %s\n", c.Members[0].File)
+		for _, m := range c.Members[1:] {
+			fmt.Printf("      %s (%.0f%% similar)\n", m.File, m.Score*100)
+		}
+	}
+
+	if shown == 0 {
+		fmt.Println("\n✅ No similar files found")
+		return
+	}
+	fmt.Printf("\n  %d cluster(s) covering %d files\n", shown, files)
+}
@@ -1,27 +1,70 @@
 package source
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"github.com/adaptive-scale/superscan/pkg/archive"
+	"github.com/adaptive-scale/superscan/pkg/computation"
+	"github.com/adaptive-scale/superscan/pkg/filter"
 	"github.com/adaptive-scale/superscan/pkg/logger"
+	"github.com/adaptive-scale/superscan/pkg/scanerr"
 )
 
+// Traversal controls how the filesystem source crosses symlinks and mount points
+type Traversal struct {
+	// FollowSymlinks scans the targets of symlinks instead of skipping them
+	FollowSymlinks bool
+	// OneFileSystem stays on the filesystem of the start path
+	OneFileSystem bool
+	// AllFileSystems descends into virtual and network filesystems
+	AllFileSystems bool
+}
+
 // FileSystemSource implements Source interface for local filesystem
 type FileSystemSource struct {
-	log *logger.Logger
+	archiveLimits archive.Limits
+	filter        *filter.Filter
+	traversal     Traversal
+	errors        *scanerr.Log
+	log           *logger.Logger
 }
 
 // NewFileSystemSource creates a new filesystem source
 func NewFileSystemSource() *FileSystemSource {
 	return &FileSystemSource{
-		log: logger.New(logger.INFO),
+		archiveLimits: archive.DefaultLimits(),
+		filter:        filter.New(filter.Options{}),
+		errors:        scanerr.NewLog(),
+		log:           logger.New(logger.INFO),
 	}
 }
 
-// ListFiles lists files in the filesystem
-func (fs *FileSystemSource) ListFiles(startPath string) error {
+// SetArchiveLimits sets how deep and how much archive content is expanded
+func (fs *FileSystemSource) SetArchiveLimits(limits archive.Limits) {
+	fs.archiveLimits = limits
+}
+
+// SetFilter sets which files and directories are listed and scanned. Hidden files
+// are skipped unless the filter includes them, and .superscanignore files are honored.
+func (fs *FileSystemSource) SetFilter(f *filter.Filter) {
+	fs.filter = f
+}
+
+// SetTraversal sets whether symlinks are followed and which mount points are crossed
+func (fs *FileSystemSource) SetTraversal(t Traversal) {
+	fs.traversal = t
+}
+
+// ListFiles lists files in the filesystem. If ctx is cancelled, the files listed so
+// far are displayed.
+func (fs *FileSystemSource) ListFiles(ctx context.Context, startPath string) error {
 	fs.log.Info("Starting filesystem scan from path: %s", startPath)
 
 	// Get current directory if startPath is empty
@@ -61,9 +104,10 @@ func (fs *FileSystemSource) ListFiles(startPath string) error {
 	}{
 		{absPath, root},
 	}
+	w := fs.newWalk(absPath)
 
 	// Process directories iteratively
-	for len(stack) > 0 {
+	for len(stack) > 0 && ctx.Err() == nil {
 		// Pop from stack
 		current := stack[len(stack)-1]
 		stack = stack[:len(stack)-1]
@@ -71,40 +115,48 @@ func (fs *FileSystemSource) ListFiles(startPath string) error {
 		// Read directory
 		entries, err := os.ReadDir(current.path)
 		if err != nil {
-			fs.log.Error("Failed to read directory %s: %v", current.path, err)
+			fs.errors.Add(current.path, "read directory", err)
+			addNote(current.parent, fmt.Sprintf("not listed: %s", scanerr.Classify(err)))
 			continue
 		}
 
 		// Process each entry
 		for _, entry := range entries {
-			// Skip hidden files and directories
-			if entry.Name()[0] == '.' {
-				continue
-			}
-
 			// Get full path
 			fullPath := filepath.Join(current.path, entry.Name())
 
-			// Get file info
-			info, err := entry.Info()
-			if err != nil {
-				fs.log.Error("Failed to get file info for %s: %v", fullPath, err)
+			// Follow symlinks if enabled, skipping filtered entries
+			e, ok := fs.visit(w, fullPath, entry)
+			if !ok {
 				continue
 			}
 
 			// Create node
 			node := &FileNode{
 				Name:  entry.Name(),
-				IsDir: entry.IsDir(),
-				Size:  info.Size(),
+				IsDir: e.isDir,
+				Size:  e.info.Size(),
 			}
+			addNote(node, e.note)
 
 			// Add to parent's children
 			current.parent.Children = append(current.parent.Children, node)
 
+			// Detect the content type from magic bytes and flag misleading extensions
+			if e.regular {
+				fs.sniffType(fullPath, node)
+			}
+
+			// Descend into archives, listing their entries as virtual children
+			if e.regular && archive.IsArchive(entry.Name()) {
+				fs.expandArchive(fullPath, node)
+			}
+
 			// If directory, add to stack
-			if entry.IsDir() {
+			if e.isDir {
 				node.Children = make([]*FileNode, 0)
+			}
+			if e.descend {
 				stack = append(stack, struct {
 					path   string
 					parent *FileNode
@@ -115,14 +167,327 @@ func (fs *FileSystemSource) ListFiles(startPath string) error {
 
 	// Display the tree
 	fsdisplayTree(root, 0)
+	return ctx.Err()
+}
+
+// expandArchive attaches the entries of an archive file to its node
+func (fs *FileSystemSource) expandArchive(fullPath string, node *FileNode) {
+	if fs.archiveLimits.MaxDepth <= 0 {
+		return
+	}
+
+	f, err := os.Open(fullPath)
+	if err != nil {
+		fs.errors.Add(fullPath, "open archive", err)
+		return
+	}
+	defer f.Close()
+
+	root, err := archive.Expand(fullPath, f, node.Size, fs.archiveLimits)
+	if err != nil {
+		// Archives over the limits are skipped on purpose and only noted in the tree
+		if !errors.Is(err, archive.ErrLimitExceeded) {
+			fs.errors.Add(fullPath, "expand archive", scanerr.Decode(err))
+		}
+		addNote(node, fmt.Sprintf("expansion stopped: %v", err))
+	}
+	node.Children = archiveNodes(root.Children)
+}
+
+// sniffType reads the first bytes of a file to detect its type
+func (fs *FileSystemSource) sniffType(fullPath string, node *FileNode) {
+	f, err := os.Open(fullPath)
+	if err != nil {
+		fs.errors.Add(fullPath, "open file", err)
+		addNote(node, fmt.Sprintf("not read: %s", scanerr.Classify(err)))
+		return
+	}
+	defer f.Close()
+
+	header := make([]byte, computation.SniffSize)
+	n, err := io.ReadFull(f, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		fs.errors.Add(fullPath, "read file", err)
+		return
+	}
+	node.Type = computation.DetectType(header[:n])
+	addNote(node, computation.ExtensionMismatch(node.Name, node.Type))
+}
+
+// Walk calls fn for every regular file below startPath that passes the filter
+func (fs *FileSystemSource) Walk(ctx context.Context, startPath string, fn WalkFunc) error {
+	return fs.WalkFrom(ctx, startPath, "", fn, nil)
+}
+
+// fsCursor is the position of a filesystem walk: the directories still to be read
+type fsCursor struct {
+	Stack []string `json:"stack"`
+}
+
+// WalkFrom walks like Walk, continuing from a cursor. A checkpoint is made after every
+// directory.
+func (fs *FileSystemSource) WalkFrom(ctx context.Context, startPath, cursor string, fn WalkFunc, checkpoint CheckpointFunc) error {
+	if startPath == "" {
+		startPath = "."
+	}
+	absPath, err := filepath.Abs(startPath)
+	if err != nil {
+		fs.log.Error("Failed to convert path to absolute: %v", err)
+		return fmt.Errorf("failed to convert path to absolute: %v", err)
+	}
+	if _, err := os.Stat(absPath); err != nil {
+		fs.log.Error("Failed to stat start path %s: %v", absPath, err)
+		return fmt.Errorf("failed to stat start path %s: %v", absPath, err)
+	}
+
+	// Create a stack for iterative traversal
+	stack := []string{absPath}
+	w := fs.newWalk(absPath)
+	if cursor != "" {
+		var c fsCursor
+		if err := json.Unmarshal([]byte(cursor), &c); err != nil {
+			return fmt.Errorf("invalid filesystem cursor: %v", err)
+		}
+		stack = c.Stack
+	}
+	for len(stack) > 0 {
+		// Pop from stack
+		current := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if err := fs.walkDir(ctx, w, current, &stack, fn); err != nil {
+			return err
+		}
+		if checkpoint != nil {
+			data, err := json.Marshal(fsCursor{Stack: stack})
+			if err != nil {
+				return fmt.Errorf("failed to encode cursor: %v", err)
+			}
+			if err := checkpoint(string(data)); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
 
+// walkDir calls fn for the files of one directory and pushes its subdirectories on the stack
+func (fs *FileSystemSource) walkDir(ctx context.Context, w *fsWalk, current string, stack *[]string, fn WalkFunc) error {
+	entries, err := os.ReadDir(current)
+	if err != nil {
+		relPath, _ := filepath.Rel(w.root, current)
+		if relPath == "." {
+			relPath = ""
+		}
+		fs.errors.AddUnlisted(current, filepath.ToSlash(relPath), "read directory", err)
+		return nil
+	}
+
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		fullPath := filepath.Join(current, entry.Name())
+		e, ok := fs.visit(w, fullPath, entry)
+		if !ok {
+			continue
+		}
+		if e.isDir {
+			if e.descend {
+				*stack = append(*stack, fullPath)
+			} else {
+				fs.log.Info("Skipping %s: %s", fullPath, e.note)
+			}
+			continue
+		}
+		if !e.regular {
+			continue
+		}
+
+		relPath, _ := filepath.Rel(w.root, fullPath)
+		if err := fn(FileInfo{
+			Path:    fullPath,
+			RelPath: filepath.ToSlash(relPath),
+			Size:    e.info.Size(),
+			ModTime: e.info.ModTime(),
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fsWalk is what a walk of one start path needs to decide which entries to list and
+// which directories to descend into
+type fsWalk struct {
+	root    string
+	ignores *filter.Ignores
+	// mounts maps mount points to their filesystem type
+	mounts map[string]string
+	// rootDev is the device of the start path, if known
+	rootDev   uint64
+	hasDevice bool
+}
+
+// newWalk prepares a walk of the tree at root
+func (fs *FileSystemSource) newWalk(root string) *fsWalk {
+	w := &fsWalk{
+		root:    root,
+		ignores: filter.NewIgnores(root, fs.filter.IgnoreFiles()),
+	}
+	mounts, err := readMounts()
+	if err != nil {
+		fs.log.Error("Failed to read mount points, virtual and network filesystems will not be skipped: %v", err)
+	}
+	w.mounts = mounts
+	if info, err := os.Stat(root); err == nil {
+		w.rootDev, w.hasDevice = deviceID(info)
+	}
+	return w
+}
+
+// fsEntry is a directory entry as the walk treats it, after following a symlink
+type fsEntry struct {
+	// info describes the entry, or the target of a followed symlink
+	info os.FileInfo
+	// isDir and regular are set for directories and regular files, and for symlinks to
+	// them that are followed
+	isDir   bool
+	regular bool
+	// descend is set for directories that are walked
+	descend bool
+	// note says why a symlink was not followed or a directory was not descended into
+	note string
+}
+
+// visit resolves an entry below the walk's root, reporting false if it is filtered
+// out or cannot be read
+func (fs *FileSystemSource) visit(w *fsWalk, fullPath string, entry os.DirEntry) (fsEntry, bool) {
+	info, err := entry.Info()
+	if err != nil {
+		fs.errors.Add(fullPath, "get file info", err)
+		return fsEntry{}, false
+	}
+	e := fsEntry{info: info}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		e.note = fs.followSymlink(fullPath, &e)
+	}
+	e.isDir = e.info.IsDir()
+	e.regular = e.info.Mode().IsRegular()
+	if fs.skip(w, fullPath, entry.Name(), e.isDir) {
+		return e, false
+	}
+	if e.isDir && e.note == "" {
+		e.note = fs.boundary(w, fullPath, e.info)
+		e.descend = e.note == ""
+	}
+	return e, true
+}
+
+// followSymlink resolves a symlink if symlinks are followed, setting e.info to its
+// target. It returns why the symlink is not followed, or "" if it is.
+func (fs *FileSystemSource) followSymlink(fullPath string, e *fsEntry) string {
+	target, _ := os.Readlink(fullPath)
+	if !fs.traversal.FollowSymlinks {
+		return fmt.Sprintf("symlink to %s, not followed", target)
+	}
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return fmt.Sprintf("broken symlink to %s", target)
+	}
+	e.info = info
+	if info.IsDir() {
+		if ancestor := loopAncestor(filepath.Dir(fullPath), info); ancestor != "" {
+			return fmt.Sprintf("symlink to %s, not followed: loops back to %s", target, ancestor)
+		}
+	}
+	return ""
+}
+
+// loopAncestor returns the directory among dir and its parents that is the same as
+// info, or "" if there is none, so that a symlink to it is not followed forever
+func loopAncestor(dir string, info os.FileInfo) string {
+	for {
+		if ancestor, err := os.Stat(dir); err == nil && os.SameFile(ancestor, info) {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// boundary returns why a directory below the walk's root is not descended into: a
+// virtual or network filesystem, another filesystem if the walk stays on one, or the
+// depth limit. It returns "" if the directory is walked.
+func (fs *FileSystemSource) boundary(w *fsWalk, fullPath string, info os.FileInfo) string {
+	// Mount points are listed by their real path
+	mountPoint := fullPath
+	if fs.traversal.FollowSymlinks {
+		if real, err := filepath.EvalSymlinks(fullPath); err == nil {
+			mountPoint = real
+		}
+	}
+	fsType, isMount := w.mounts[mountPoint]
+	if kind := mountKind(fsType); isMount && kind != "" && !fs.traversal.AllFileSystems {
+		return fmt.Sprintf("not descended: %s (%s)", kind, fsType)
+	}
+
+	if fs.traversal.OneFileSystem && w.hasDevice {
+		if dev, ok := deviceID(info); ok && dev != w.rootDev {
+			if isMount {
+				return fmt.Sprintf("not descended: other filesystem (%s)", fsType)
+			}
+			return "not descended: other filesystem"
+		}
+	}
+
+	relPath, err := filepath.Rel(w.root, fullPath)
+	if maxDepth := fs.filter.MaxDepth(); err == nil && maxDepth > 0 && len(strings.Split(relPath, string(filepath.Separator))) >= maxDepth {
+		return fmt.Sprintf("not descended: depth limit %d", maxDepth)
+	}
+	return ""
+}
+
+// skip reports whether an entry below the walk's root is filtered out: hidden unless
+// the filter includes hidden files, excluded by a pattern or ignored by an ignore file
+func (fs *FileSystemSource) skip(w *fsWalk, fullPath, name string, isDir bool) bool {
+	if name[0] == '.' && !fs.filter.Hidden() {
+		return true
+	}
+	relPath, err := filepath.Rel(w.root, fullPath)
+	if err == nil && !fs.filter.Match(filepath.ToSlash(relPath), isDir) {
+		return true
+	}
+	return w.ignores.Ignored(fullPath, isDir)
+}
+
+// ReadFile opens a local file for reading
+func (fs *FileSystemSource) ReadFile(ctx context.Context, path string) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	return f, nil
+}
+
 // GetName returns the source name
 func (fs *FileSystemSource) GetName() string {
 	return "filesystem"
 }
 
+// Errors returns the paths that could not be listed or read
+func (fs *FileSystemSource) Errors() *scanerr.Log {
+	return fs.errors
+}
+
 // fsdisplayTree recursively displays the file tree
 func fsdisplayTree(node *FileNode, level int) {
 	// Print current node
@@ -146,7 +511,10 @@ func fsdisplayTree(node *FileNode, level int) {
 	if node.IsDir {
 		fmt.Printf("%s%s%s%s/\n", prefix, connector, icon, node.Name)
 	} else {
-		fmt.Printf("%s%s%s%s (%d bytes)\n", prefix, connector, icon, node.Name, node.Size)
+		fmt.Printf("%s%s%s%s (%d bytes)%s\n", prefix, connector, icon, node.Name, node.Size, typeLabel(node))
+	}
+	if node.Note != "" {
+		fmt.Printf("%s│   ⚠️  %s\n", prefix, node.Note)
 	}
 
 	// Display children
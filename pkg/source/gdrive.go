@@ -4,38 +4,100 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
+	"net/http"
 	"os"
+	"path"
+	"time"
 
+	"github.com/adaptive-scale/superscan/pkg/filter"
 	"github.com/adaptive-scale/superscan/pkg/logger"
+	"github.com/adaptive-scale/superscan/pkg/retry"
+	"github.com/adaptive-scale/superscan/pkg/scanerr"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/drive/v3"
 	"google.golang.org/api/option"
 )
 
+// driveFolderMimeType is the MIME type of Drive folders
+const driveFolderMimeType = "application/vnd.google-apps.folder"
+
+// driveFileFields are the fields of a file needed to walk and scan it
+const driveFileFields = "id, name, mimeType, size, md5Checksum, modifiedTime"
+
+// driveExportTypes maps native Google Workspace types to the text format they are exported as
+var driveExportTypes = map[string]string{
+	"application/vnd.google-apps.document":     "text/plain",
+	"application/vnd.google-apps.spreadsheet":  "text/csv",
+	"application/vnd.google-apps.presentation": "text/plain",
+}
+
 // GoogleDriveSource implements the Source interface for Google Drive
 type GoogleDriveSource struct {
 	service *drive.Service
+	retry   *retry.Policy
+	filter  *filter.Filter
+	errors  *scanerr.Log
 	log     *logger.Logger
 }
 
 // NewGoogleDriveSource creates a new GoogleDriveSource
 func NewGoogleDriveSource() *GoogleDriveSource {
 	return &GoogleDriveSource{
-		log: logger.New(logger.INFO),
+		retry:  retry.DefaultPolicy(),
+		filter: filter.New(filter.Options{}),
+		errors: scanerr.NewLog(),
+		log:    logger.New(logger.INFO),
 	}
 }
 
+// SetFilter sets which files and folders are listed and scanned, matched against
+// paths built from file names
+func (gds *GoogleDriveSource) SetFilter(f *filter.Filter) {
+	gds.filter = f
+}
+
+// SetRetryPolicy sets how throttled and failed Drive API requests are retried
+func (gds *GoogleDriveSource) SetRetryPolicy(policy *retry.Policy) {
+	gds.retry = policy
+}
+
 func (gds *GoogleDriveSource) GetName() string {
 //TODO
 	return "Google Drive"
 }
 
+// Errors returns the folders that could not be listed and files that could not be read
+func (gds *GoogleDriveSource) Errors() *scanerr.Log {
+	return gds.errors
+}
+
 // ListFiles implements the Source interface for Google Drive
-func (gds *GoogleDriveSource) ListFiles(startPath string) error {
+func (gds *GoogleDriveSource) ListFiles(ctx context.Context, startPath string) error {
 	gds.log.Debug("Starting Google Drive scan with path: %s", startPath)
-	ctx := context.Background()
+	if err := gds.connect(ctx); err != nil {
+		return err
+	}
+
+	// If no start path is provided, use root
+	if startPath == "" {
+		startPath = "root"
+		gds.log.Debug("Using root as start path")
+	}
+
+	// List files
+	gds.log.Info("Starting Google Drive scan from: %s", startPath)
+	return gds.listFiles(ctx, startPath, "")
+}
+
+// connect authenticates and creates the Drive service on first use. ctx is also used
+// to refresh the token.
+func (gds *GoogleDriveSource) connect(ctx context.Context) error {
+	if gds.service != nil {
+		return nil
+	}
 
 	// Get credentials file path from environment or use default
 	credentialsFile := os.Getenv("SUPERSCAN_CONFIG_GOOGLE")
@@ -80,7 +142,7 @@ func (gds *GoogleDriveSource) ListFiles(startPath string) error {
 	tok, err := getTokenFromFile(tokenFile, config)
 	if err != nil {
 		gds.log.Info("Token not found in file, requesting new token")
-		tok, err = getTokenFromWeb(config)
+		tok, err = getTokenFromWeb(ctx, config)
 		if err != nil {
 			gds.log.Error("Unable to get token: %v", err)
 			return fmt.Errorf("unable to get token: %v", err)
@@ -100,38 +162,49 @@ func (gds *GoogleDriveSource) ListFiles(startPath string) error {
 	gds.log.Debug("Successfully created Drive service")
 
 	gds.service = service
-
-	// If no start path is provided, use root
-	if startPath == "" {
-		startPath = "root"
-		gds.log.Debug("Using root as start path")
-	}
-
-	// List files
-	gds.log.Info("Starting Google Drive scan from: %s", startPath)
-	return gds.listFiles(startPath)
+	return nil
 }
 
-// listFiles lists files and folders in Google Drive
-func (gds *GoogleDriveSource) listFiles(folderId string) error {
+// listFiles lists files and folders in Google Drive; relPath is the path of the folder
+// below the start folder
+func (gds *GoogleDriveSource) listFiles(ctx context.Context, folderId, relPath string) error {
 	gds.log.Debug("Listing files in folder: %s", folderId)
 	query := fmt.Sprintf("'%s' in parents and trashed = false", folderId)
-	r, err := gds.service.Files.List().
-		Q(query).
-		Fields("files(id, name, mimeType, size)").
-		Do()
+	var r *drive.FileList
+	err := gds.retry.Do(ctx, "Listing folder "+folderId, func() error {
+		var err error
+		r, err = gds.service.Files.List().
+			Q(query).
+			Fields("files(id, name, mimeType, size)").
+			SupportsAllDrives(true).
+			IncludeItemsFromAllDrives(true).
+			Context(ctx).
+			Do()
+		return err
+	})
 	if err != nil {
-		gds.log.Error("Unable to retrieve files: %v", err)
-		return fmt.Errorf("unable to retrieve files: %v", err)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("unable to retrieve files: %w", err)
 	}
 
 	for _, file := range r.Files {
-		if file.MimeType == "application/vnd.google-apps.folder" {
+		filePath := path.Join(relPath, file.Name)
+		isFolder := file.MimeType == driveFolderMimeType
+		if !gds.filter.Match(filePath, isFolder) {
+			continue
+		}
+		if isFolder {
 			gds.log.Info("Found directory: %s/", file.Name)
 			fmt.Printf("📁 %s/\n", file.Name)
-			// Recursively list files in subfolder
-			if err := gds.listFiles(file.Id); err != nil {
-				return err
+			// Recursively list files in subfolder, skipping folders that cannot be listed
+			if err := gds.listFiles(ctx, file.Id, filePath); err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				gds.errors.Add(file.Name+"/", "list folder", err)
+				fmt.Printf("⚠️  %s/ not listed: %s\n", file.Name, scanerr.Classify(err))
 			}
 		} else {
 			gds.log.Info("Found file: %s (%d bytes)", file.Name, file.Size)
@@ -142,6 +215,183 @@ func (gds *GoogleDriveSource) listFiles(folderId string) error {
 	return nil
 }
 
+// Walk calls fn for every file below the startPath folder ID. Paths are Drive file IDs;
+// RelPath is built from file names.
+func (gds *GoogleDriveSource) Walk(ctx context.Context, startPath string, fn WalkFunc) error {
+	return gds.WalkFrom(ctx, startPath, "", fn, nil)
+}
+
+// driveFolder is a folder still to be listed by a walk
+type driveFolder struct {
+	ID      string `json:"id"`
+	RelPath string `json:"rel_path"`
+}
+
+// driveCursor is the position of a Drive walk: the folders still to be listed and,
+// if a folder was listed partially, that folder and the token of its next page
+type driveCursor struct {
+	Stack     []driveFolder `json:"stack"`
+	Folder    *driveFolder  `json:"folder,omitempty"`
+	PageToken string        `json:"page_token,omitempty"`
+}
+
+// WalkFrom walks like Walk, continuing from a cursor. A checkpoint is made after every
+// page of a folder listing.
+func (gds *GoogleDriveSource) WalkFrom(ctx context.Context, startPath, cursor string, fn WalkFunc, checkpoint CheckpointFunc) error {
+	if err := gds.connect(ctx); err != nil {
+		return err
+	}
+	if startPath == "" {
+		startPath = "root"
+	}
+
+	// Create a stack for iterative traversal
+	c := driveCursor{Stack: []driveFolder{{ID: startPath}}}
+	if cursor != "" {
+		c = driveCursor{}
+		if err := json.Unmarshal([]byte(cursor), &c); err != nil {
+			return fmt.Errorf("invalid Google Drive cursor: %v", err)
+		}
+	}
+	return gds.walk(ctx, c, func(change Change) error {
+		if change.Folder {
+			return nil
+		}
+		return fn(change.File)
+	}, checkpoint)
+}
+
+// walk lists the folders of a cursor and the folders below them, calling fn for their
+// files and subfolders. Only the first folder, at an empty relative path, must be
+// listed; subfolders that cannot be listed are skipped.
+func (gds *GoogleDriveSource) walk(ctx context.Context, c driveCursor, fn ChangeFunc, checkpoint CheckpointFunc) error {
+	for c.Folder != nil || len(c.Stack) > 0 {
+		// Pop from stack unless a folder was listed partially
+		if c.Folder == nil {
+			folder := c.Stack[len(c.Stack)-1]
+			c.Stack = c.Stack[:len(c.Stack)-1]
+			c.Folder = &folder
+			c.PageToken = ""
+		}
+		current := *c.Folder
+
+		query := fmt.Sprintf("'%s' in parents and trashed = false", current.ID)
+		var r *drive.FileList
+		err := gds.retry.Do(ctx, "Listing folder "+current.ID, func() error {
+			var err error
+			r, err = gds.service.Files.List().
+				Q(query).
+				Fields("nextPageToken, files(" + driveFileFields + ")").
+				SupportsAllDrives(true).
+				IncludeItemsFromAllDrives(true).
+				PageToken(c.PageToken).
+				Context(ctx).
+				Do()
+			return err
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if current.RelPath == "" {
+				gds.log.Error("Unable to retrieve files: %v", err)
+				return fmt.Errorf("unable to retrieve files: %v", err)
+			}
+			// Skip the rest of a subfolder that cannot be listed
+			gds.errors.AddUnlisted(current.RelPath+"/", current.RelPath, "list folder", err)
+			c.Folder = nil
+			continue
+		}
+
+		for _, file := range r.Files {
+			relPath := path.Join(current.RelPath, file.Name)
+			if !gds.filter.Match(relPath, file.MimeType == driveFolderMimeType) {
+				continue
+			}
+			if file.MimeType == driveFolderMimeType {
+				c.Stack = append(c.Stack, driveFolder{ID: file.Id, RelPath: relPath})
+				if err := fn(Change{File: FileInfo{Path: file.Id, RelPath: relPath}, Folder: true}); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if err := fn(Change{File: driveFileInfo(file, relPath)}); err != nil {
+				return err
+			}
+		}
+
+		c.PageToken = r.NextPageToken
+		if c.PageToken == "" {
+			c.Folder = nil
+		}
+		if checkpoint != nil {
+			data, err := json.Marshal(c)
+			if err != nil {
+				return fmt.Errorf("failed to encode cursor: %v", err)
+			}
+			if err := checkpoint(string(data)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// driveFileInfo describes a Drive file at relPath below the start folder
+func driveFileInfo(file *drive.File, relPath string) FileInfo {
+	info := FileInfo{
+		Path:    file.Id,
+		RelPath: relPath,
+		Size:    file.Size,
+		ETag:    file.Md5Checksum,
+		MD5:     file.Md5Checksum,
+	}
+	if modTime, err := time.Parse(time.RFC3339, file.ModifiedTime); err == nil {
+		info.ModTime = modTime
+	}
+	return info
+}
+
+// ReadFile downloads a file by ID. Google Docs, Sheets and Slides have no binary
+// content and are exported as text instead.
+func (gds *GoogleDriveSource) ReadFile(ctx context.Context, fileID string) (io.ReadCloser, error) {
+	if err := gds.connect(ctx); err != nil {
+		return nil, err
+	}
+
+	var file *drive.File
+	err := gds.retry.Do(ctx, "Getting file "+fileID, func() error {
+		var err error
+		file, err = gds.service.Files.Get(fileID).Fields("mimeType").SupportsAllDrives(true).Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("unable to get file %s: %w", fileID, err)
+	}
+
+	var resp *http.Response
+	err = gds.retry.Do(ctx, "Downloading file "+fileID, func() error {
+		var err error
+		if exportType, ok := driveExportTypes[file.MimeType]; ok {
+			resp, err = gds.service.Files.Export(fileID, exportType).Context(ctx).Download()
+		} else {
+			resp, err = gds.service.Files.Get(fileID).SupportsAllDrives(true).Context(ctx).Download()
+		}
+		return err
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("unable to download file %s: %w", fileID, err)
+	}
+	return resp.Body, nil
+}
+
 // getTokenFromFile retrieves a token from a local file
 func getTokenFromFile(file string, config *oauth2.Config) (*oauth2.Token, error) {
 	f, err := os.Open(file)
@@ -155,7 +405,7 @@ func getTokenFromFile(file string, config *oauth2.Config) (*oauth2.Token, error)
 }
 
 // getTokenFromWeb requests a token from the web
-func getTokenFromWeb(config *oauth2.Config) (*oauth2.Token, error) {
+func getTokenFromWeb(ctx context.Context, config *oauth2.Config) (*oauth2.Token, error) {
 	authURL := config.AuthCodeURL("state-token", oauth2.AccessTypeOffline)
 	fmt.Printf("Go to the following link in your browser then type the authorization code: \n%v\n", authURL)
 
@@ -164,7 +414,7 @@ func getTokenFromWeb(config *oauth2.Config) (*oauth2.Token, error) {
 		return nil, fmt.Errorf("unable to read authorization code: %v", err)
 	}
 
-	tok, err := config.Exchange(context.TODO(), authCode)
+	tok, err := config.Exchange(ctx, authCode)
 	if err != nil {
 		return nil, fmt.Errorf("unable to retrieve token from web: %v", err)
 	}
@@ -0,0 +1,235 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// driveRoot is the start folder of a Drive change feed
+type driveRoot struct {
+	// id is the folder ID, resolved from aliases such as "root"
+	id string
+	// driveID is the shared drive holding the folder, "" for My Drive
+	driveID string
+}
+
+// driveLocation is where a folder is relative to the start folder
+type driveLocation struct {
+	relPath string
+	inside  bool
+}
+
+// FeedID identifies the Drive change feed of startPath by account and shared drive,
+// as tokens of one account or drive cannot list the changes of another
+func (gds *GoogleDriveSource) FeedID(ctx context.Context, startPath string) (string, error) {
+	root, err := gds.resolveRoot(ctx, startPath)
+	if err != nil {
+		return "", err
+	}
+
+	var about *drive.About
+	err = gds.retry.Do(ctx, "Getting account", func() error {
+		var err error
+		about, err = gds.service.About.Get().Fields("user(emailAddress)").Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		gds.log.Error("Unable to get account: %v", err)
+		return "", fmt.Errorf("unable to get account: %w", err)
+	}
+
+	driveID := root.driveID
+	if driveID == "" {
+		driveID = "my-drive"
+	}
+	return about.User.EmailAddress + "/" + driveID, nil
+}
+
+// StartToken returns the Drive page token from which changes made from now on are listed
+func (gds *GoogleDriveSource) StartToken(ctx context.Context, startPath string) (string, error) {
+	root, err := gds.resolveRoot(ctx, startPath)
+	if err != nil {
+		return "", err
+	}
+
+	var r *drive.StartPageToken
+	err = gds.retry.Do(ctx, "Getting start page token", func() error {
+		call := gds.service.Changes.GetStartPageToken().SupportsAllDrives(true).Context(ctx)
+		if root.driveID != "" {
+			call = call.DriveId(root.driveID)
+		}
+		var err error
+		r, err = call.Do()
+		return err
+	})
+	if err != nil {
+		gds.log.Error("Unable to get start page token: %v", err)
+		return "", fmt.Errorf("unable to get start page token: %w", err)
+	}
+	return r.StartPageToken, nil
+}
+
+// Snapshot walks every file and folder below startPath
+func (gds *GoogleDriveSource) Snapshot(ctx context.Context, startPath string, fn ChangeFunc) error {
+	root, err := gds.resolveRoot(ctx, startPath)
+	if err != nil {
+		return err
+	}
+	return gds.walk(ctx, driveCursor{Stack: []driveFolder{{ID: root.id}}}, fn, nil)
+}
+
+// Changes lists the files changed since token with the Drive Changes API. Changed files
+// and folders below startPath are passed to fn; those deleted, trashed or moved
+// elsewhere are passed as removed. Folders created or moved below startPath are
+// walked, as their files are not listed as changes.
+func (gds *GoogleDriveSource) Changes(ctx context.Context, startPath, token string, fn ChangeFunc) (string, error) {
+	root, err := gds.resolveRoot(ctx, startPath)
+	if err != nil {
+		return "", err
+	}
+	locations := map[string]driveLocation{root.id: {inside: true}}
+
+	for {
+		var r *drive.ChangeList
+		err := gds.retry.Do(ctx, "Listing changes", func() error {
+			call := gds.service.Changes.List(token).
+				Fields("nextPageToken, newStartPageToken, changes(changeType, fileId, removed, file(" + driveFileFields + ", parents, trashed))").
+				IncludeRemoved(true).
+				SupportsAllDrives(true).
+				PageSize(1000).
+				Context(ctx)
+			if root.driveID != "" {
+				call = call.DriveId(root.driveID).IncludeItemsFromAllDrives(true)
+			}
+			var err error
+			r, err = call.Do()
+			return err
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return "", ctx.Err()
+			}
+			gds.log.Error("Unable to list changes: %v", err)
+			return "", fmt.Errorf("unable to list changes: %w", err)
+		}
+
+		for _, change := range r.Changes {
+			if change.ChangeType != "" && change.ChangeType != "file" {
+				// Changes to shared drives themselves, such as a rename
+				continue
+			}
+			if change.FileId == root.id {
+				// The start folder itself was renamed or moved, which changes no paths below it
+				continue
+			}
+			if err := gds.change(ctx, change, locations, fn); err != nil {
+				return "", err
+			}
+		}
+
+		if r.NewStartPageToken != "" {
+			return r.NewStartPageToken, nil
+		}
+		token = r.NextPageToken
+	}
+}
+
+// change passes one change to fn, walking folders that are now below the start folder.
+// Removed folders are passed as removed like files; the files below them are not
+// listed as changes, so fn must forget those it recorded.
+func (gds *GoogleDriveSource) change(ctx context.Context, change *drive.Change, locations map[string]driveLocation, fn ChangeFunc) error {
+	removed := Change{File: FileInfo{Path: change.FileId}, Removed: true}
+	file := change.File
+	if change.Removed || file == nil || file.Trashed {
+		delete(locations, change.FileId)
+		removed.Folder = file != nil && file.MimeType == driveFolderMimeType
+		return fn(removed)
+	}
+
+	// Files no longer below the start folder may have been moved out of it
+	relPath, inside := "", false
+	if len(file.Parents) > 0 {
+		parent, err := gds.locate(ctx, file.Parents[0], locations)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			gds.errors.Add(file.Name, "locate changed file", err)
+			return nil
+		}
+		relPath, inside = path.Join(parent.relPath, file.Name), parent.inside
+	}
+	isFolder := file.MimeType == driveFolderMimeType
+	if !inside || !gds.filter.Match(relPath, isFolder) {
+		if isFolder {
+			locations[file.Id] = driveLocation{relPath: relPath}
+		}
+		removed.Folder = isFolder
+		return fn(removed)
+	}
+
+	if isFolder {
+		// Files already in a folder moved here are not listed as changes. Unchanged files
+		// of a renamed folder are walked too, but not rescanned.
+		locations[file.Id] = driveLocation{relPath: relPath, inside: true}
+		if err := fn(Change{File: FileInfo{Path: file.Id, RelPath: relPath}, Folder: true}); err != nil {
+			return err
+		}
+		return gds.walk(ctx, driveCursor{Folder: &driveFolder{ID: file.Id, RelPath: relPath}}, fn, nil)
+	}
+	return fn(Change{File: driveFileInfo(file, relPath)})
+}
+
+// locate returns where a folder is relative to the start folder, looking up its
+// parents until the start folder or the top of its drive is reached
+func (gds *GoogleDriveSource) locate(ctx context.Context, folderID string, locations map[string]driveLocation) (driveLocation, error) {
+	if loc, ok := locations[folderID]; ok {
+		return loc, nil
+	}
+
+	var folder *drive.File
+	err := gds.retry.Do(ctx, "Getting folder "+folderID, func() error {
+		var err error
+		folder, err = gds.service.Files.Get(folderID).Fields("id, name, parents").SupportsAllDrives(true).Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		return driveLocation{}, fmt.Errorf("unable to get folder %s: %w", folderID, err)
+	}
+
+	var loc driveLocation
+	if len(folder.Parents) > 0 {
+		parent, err := gds.locate(ctx, folder.Parents[0], locations)
+		if err != nil {
+			return driveLocation{}, err
+		}
+		loc = driveLocation{relPath: path.Join(parent.relPath, folder.Name), inside: parent.inside}
+	}
+	locations[folderID] = loc
+	return loc, nil
+}
+
+// resolveRoot returns the folder ID of startPath and the shared drive holding it
+func (gds *GoogleDriveSource) resolveRoot(ctx context.Context, startPath string) (driveRoot, error) {
+	if err := gds.connect(ctx); err != nil {
+		return driveRoot{}, err
+	}
+	if startPath == "" {
+		startPath = "root"
+	}
+
+	var folder *drive.File
+	err := gds.retry.Do(ctx, "Getting folder "+startPath, func() error {
+		var err error
+		folder, err = gds.service.Files.Get(startPath).Fields("id, driveId").SupportsAllDrives(true).Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		gds.log.Error("Unable to get start folder %s: %v", startPath, err)
+		return driveRoot{}, fmt.Errorf("unable to get start folder %s: %w", startPath, err)
+	}
+	return driveRoot{id: folder.Id, driveID: folder.DriveId}, nil
+}
@@ -0,0 +1,283 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/adaptive-scale/superscan/pkg/detector"
+	"github.com/adaptive-scale/superscan/pkg/filter"
+	"github.com/adaptive-scale/superscan/pkg/logger"
+	"github.com/adaptive-scale/superscan/pkg/scanerr"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// GitSource implements Source interface for the full history of a git repository
+type GitSource struct {
+	engine *detector.Engine
+	filter *filter.Filter
+	errors *scanerr.Log
+	log    *logger.Logger
+}
+
+// NewGitSource creates a new git history source
+func NewGitSource() *GitSource {
+	return &GitSource{
+		engine: detector.NewEngine(),
+		filter: filter.New(filter.Options{}),
+		errors: scanerr.NewLog(),
+		log:    logger.New(logger.INFO),
+	}
+}
+
+// ListFiles walks every commit reachable from any branch, tag or HEAD of the repository
+// at startPath, scans each distinct blob once and reports the commit that introduced it.
+// If ctx is cancelled, the blobs scanned so far are reported.
+func (g *GitSource) ListFiles(ctx context.Context, startPath string) error {
+	g.log.Info("Starting git history scan of repository: %s", startPath)
+
+	// Use current directory if startPath is empty
+	if startPath == "" {
+		var err error
+		startPath, err = os.Getwd()
+		if err != nil {
+			g.log.Error("Failed to get current directory: %v", err)
+			return fmt.Errorf("failed to get current directory: %v", err)
+		}
+	}
+
+	// Open working copy, falling back to a bare repository
+	repo, err := git.PlainOpenWithOptions(startPath, &git.PlainOpenOptions{DetectDotGit: true})
+	if err == git.ErrRepositoryNotExists {
+		repo, err = git.PlainOpen(startPath)
+	}
+	if err != nil {
+		g.log.Error("Failed to open git repository %s: %v", startPath, err)
+		return fmt.Errorf("failed to open git repository %s: %v", startPath, err)
+	}
+
+	commits, err := g.collectCommits(repo)
+	if err != nil {
+		return err
+	}
+	g.log.Info("Found %d commits across all refs", len(commits))
+
+	// Create root node
+	root := &FileNode{
+		Name:     startPath,
+		IsDir:    true,
+		Children: make([]*FileNode, 0),
+	}
+
+	// Process oldest commits first so each blob is attributed to the commit that introduced it
+	seen := make(map[plumbing.Hash]bool)
+	var findings []detector.Finding
+	for _, commit := range commits {
+		if ctx.Err() != nil {
+			break
+		}
+		changes, err := g.introducedFiles(commit)
+		if err != nil {
+			g.errors.Add(commit.Hash.String(), "diff commit", err)
+			continue
+		}
+
+		for _, change := range changes {
+			if seen[change.hash] || !g.filter.Match(change.path, false) {
+				continue
+			}
+			seen[change.hash] = true
+
+			blob, err := repo.BlobObject(change.hash)
+			if err != nil {
+				g.errors.Add(fmt.Sprintf("%s (blob %s)", change.path, change.hash), "read blob", err)
+				continue
+			}
+			insertPath(root, change.path, blob.Size)
+
+			// Content that could not be fully decoded still reports what was found in it
+			blobFindings, err := g.scanBlob(blob, change.path)
+			if err != nil {
+				g.errors.Add(fmt.Sprintf("%s (blob %s)", change.path, change.hash), "scan blob", err)
+			}
+			for i := range blobFindings {
+				// Keep what the detector recorded, such as the sampling seed
+				if blobFindings[i].Metadata == nil {
+					blobFindings[i].Metadata = make(map[string]string)
+				}
+				blobFindings[i].Metadata["commit"] = commit.Hash.String()
+				blobFindings[i].Metadata["author"] = fmt.Sprintf("%s <%s>", commit.Author.Name, commit.Author.Email)
+				blobFindings[i].Metadata["date"] = commit.Author.When.UTC().Format(time.RFC3339)
+			}
+			findings = append(findings, blobFindings...)
+		}
+	}
+	g.log.Info("Scanned %d distinct blobs", len(seen))
+
+	// Display the tree and findings
+	displayTree(root, 0)
+	displayFindings(findings)
+	return ctx.Err()
+}
+
+// SetFilter sets which files are scanned, matched against their path in the repository
+func (g *GitSource) SetFilter(f *filter.Filter) {
+	g.filter = f
+}
+
+// SetSeed sets the seed used to sample structured data, 0 keeps a random seed
+func (g *GitSource) SetSeed(seed int64) {
+	if seed != 0 {
+		g.engine.SetSeed(seed)
+	}
+}
+
+// GetName returns the source name
+func (g *GitSource) GetName() string {
+	return "git"
+}
+
+// Errors returns the commits and blobs that could not be read or scanned
+func (g *GitSource) Errors() *scanerr.Log {
+	return g.errors
+}
+
+// collectCommits returns every commit reachable from any reference, oldest first
+func (g *GitSource) collectCommits(repo *git.Repository) ([]*object.Commit, error) {
+	refs, err := repo.References()
+	if err != nil {
+		g.log.Error("Failed to list references: %v", err)
+		return nil, fmt.Errorf("failed to list references: %v", err)
+	}
+
+	// Resolve branch, tag and HEAD references to their commits
+	var tips []*object.Commit
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() != plumbing.HashReference {
+			return nil
+		}
+		commit, err := resolveCommit(repo, ref.Hash())
+		if err != nil {
+			g.log.Debug("Skipping reference %s: %v", ref.Name(), err)
+			return nil
+		}
+		tips = append(tips, commit)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve references: %v", err)
+	}
+	if head, err := repo.Head(); err == nil {
+		if commit, err := resolveCommit(repo, head.Hash()); err == nil {
+			tips = append(tips, commit)
+		}
+	}
+
+	// Walk the ancestry of every tip
+	seen := make(map[plumbing.Hash]bool)
+	var commits []*object.Commit
+	stack := tips
+	for len(stack) > 0 {
+		commit := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if seen[commit.Hash] {
+			continue
+		}
+		seen[commit.Hash] = true
+		commits = append(commits, commit)
+
+		err := commit.Parents().ForEach(func(parent *object.Commit) error {
+			if !seen[parent.Hash] {
+				stack = append(stack, parent)
+			}
+			return nil
+		})
+		if err != nil {
+			g.log.Error("Failed to read parents of %s: %v", commit.Hash, err)
+		}
+	}
+
+	sort.SliceStable(commits, func(i, j int) bool {
+		return commits[i].Committer.When.Before(commits[j].Committer.When)
+	})
+	return commits, nil
+}
+
+// gitChange is a file blob introduced by a commit
+type gitChange struct {
+	path string
+	hash plumbing.Hash
+}
+
+// introducedFiles returns the file blobs added or modified by a commit relative to its first parent
+func (g *GitSource) introducedFiles(commit *object.Commit) ([]gitChange, error) {
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []gitChange
+
+	// A root commit introduces every file in its tree
+	if commit.NumParents() == 0 {
+		err := tree.Files().ForEach(func(f *object.File) error {
+			// The blob of a symlink is its target path
+			if f.Mode != filemode.Symlink {
+				result = append(result, gitChange{path: f.Name, hash: f.Hash})
+			}
+			return nil
+		})
+		return result, err
+	}
+
+	parent, err := commit.Parent(0)
+	if err != nil {
+		return nil, err
+	}
+	parentTree, err := parent.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := object.DiffTree(parentTree, tree)
+	if err != nil {
+		return nil, err
+	}
+	for _, change := range changes {
+		// Skip deletions, submodules and symlinks, which IsFile counts as files
+		to := change.To
+		if to.Name == "" || !to.TreeEntry.Mode.IsFile() || to.TreeEntry.Mode == filemode.Symlink {
+			continue
+		}
+		result = append(result, gitChange{path: to.Name, hash: to.TreeEntry.Hash})
+	}
+	return result, nil
+}
+
+// scanBlob runs the detection engine over a blob's content
+func (g *GitSource) scanBlob(blob *object.Blob, path string) ([]detector.Finding, error) {
+	r, err := blob.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return g.engine.Scan(path, r)
+}
+
+// resolveCommit returns the commit a hash points to, peeling annotated tags
+func resolveCommit(repo *git.Repository, hash plumbing.Hash) (*object.Commit, error) {
+	if commit, err := repo.CommitObject(hash); err == nil {
+		return commit, nil
+	}
+	tag, err := repo.TagObject(hash)
+	if err != nil {
+		return nil, fmt.Errorf("%s is neither a commit nor a tag", hash)
+	}
+	return tag.Commit()
+}
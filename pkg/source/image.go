@@ -0,0 +1,530 @@
+package source
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/adaptive-scale/superscan/pkg/detector"
+	"github.com/adaptive-scale/superscan/pkg/filter"
+	"github.com/adaptive-scale/superscan/pkg/logger"
+	"github.com/adaptive-scale/superscan/pkg/scanerr"
+)
+
+const (
+	// whiteoutPrefix marks a file deleted from a lower layer
+	whiteoutPrefix = ".wh."
+	// whiteoutOpaque marks a directory whose lower layer contents are hidden
+	whiteoutOpaque = ".wh..wh..opq"
+	// maxIndexDepth is how deeply nested OCI indexes are followed
+	maxIndexDepth = 4
+)
+
+// dockerManifest is an entry of manifest.json in a docker save tarball
+type dockerManifest struct {
+	Config   string   `json:"Config"`
+	RepoTags []string `json:"RepoTags"`
+	Layers   []string `json:"Layers"`
+}
+
+// ociIndex is the index.json of an OCI image layout
+type ociIndex struct {
+	Manifests []ociDescriptor `json:"manifests"`
+}
+
+// ociManifest is an OCI image manifest, or a nested index of the manifests of a
+// multi-platform image
+type ociManifest struct {
+	Config    ociDescriptor   `json:"config"`
+	Layers    []ociDescriptor `json:"layers"`
+	Manifests []ociDescriptor `json:"manifests"`
+}
+
+// ociDescriptor points at a content addressed blob
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Annotations map[string]string `json:"annotations"`
+	Platform    *ociPlatform      `json:"platform"`
+}
+
+// ociPlatform is the platform an image manifest of an index was built for
+type ociPlatform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+}
+
+// imageConfig holds the parts of an image config needed for attribution
+type imageConfig struct {
+	RootFS struct {
+		DiffIDs []string `json:"diff_ids"`
+	} `json:"rootfs"`
+	History []struct {
+		CreatedBy  string `json:"created_by"`
+		EmptyLayer bool   `json:"empty_layer"`
+	} `json:"history"`
+}
+
+// imageLayer is a layer blob along with what created it
+type imageLayer struct {
+	blob      string
+	digest    string
+	createdBy string
+}
+
+// image is one image found in a tarball or layout
+type image struct {
+	name   string
+	layers []imageLayer
+}
+
+// layerFile is a file of the merged image filesystem
+type layerFile struct {
+	size  int64
+	layer int
+}
+
+// ImageSource implements Source interface for docker save tarballs and OCI image layouts
+type ImageSource struct {
+	engine *detector.Engine
+	filter *filter.Filter
+	errors *scanerr.Log
+	log    *logger.Logger
+}
+
+// NewImageSource creates a new container image source
+func NewImageSource() *ImageSource {
+	return &ImageSource{
+		engine: detector.NewEngine(),
+		filter: filter.New(filter.Options{}),
+		errors: scanerr.NewLog(),
+		log:    logger.New(logger.INFO),
+	}
+}
+
+// ListFiles reads the image tarball or OCI layout directory at startPath, walks every
+// layer and attributes findings to the layer and the history command that created it.
+// If ctx is cancelled, the findings so far are reported.
+func (is *ImageSource) ListFiles(ctx context.Context, startPath string) error {
+	is.log.Info("Starting container image scan of: %s", startPath)
+
+	info, err := os.Stat(startPath)
+	if err != nil {
+		is.log.Error("Failed to stat image %s: %v", startPath, err)
+		return fmt.Errorf("failed to stat image %s: %v", startPath, err)
+	}
+
+	// Blobs are opened by their path inside the tarball or layout directory
+	var open func(name string) (io.ReadCloser, error)
+	if info.IsDir() {
+		open = func(name string) (io.ReadCloser, error) {
+			return os.Open(filepath.Join(startPath, filepath.FromSlash(name)))
+		}
+	} else {
+		tb, err := openTarball(startPath)
+		if err != nil {
+			is.log.Error("Failed to read image tarball %s: %v", startPath, err)
+			return fmt.Errorf("failed to read image tarball %s: %v", startPath, err)
+		}
+		defer tb.Close()
+		open = tb.open
+	}
+
+	images, err := is.readImages(open)
+	if err != nil {
+		is.log.Error("Failed to read image metadata: %v", err)
+		return err
+	}
+
+	var findings []detector.Finding
+	for _, img := range images {
+		if ctx.Err() != nil {
+			break
+		}
+		imageFindings, err := is.scanImage(ctx, img, open)
+		if err != nil {
+			is.errors.Add(img.name, "scan image", err)
+			continue
+		}
+		findings = append(findings, imageFindings...)
+	}
+
+	displayFindings(findings)
+	return ctx.Err()
+}
+
+// SetFilter sets which files of the image filesystem are scanned
+func (is *ImageSource) SetFilter(f *filter.Filter) {
+	is.filter = f
+}
+
+// SetSeed sets the seed used to sample structured data, 0 keeps a random seed
+func (is *ImageSource) SetSeed(seed int64) {
+	if seed != 0 {
+		is.engine.SetSeed(seed)
+	}
+}
+
+// GetName returns the source name
+func (is *ImageSource) GetName() string {
+	return "image"
+}
+
+// Errors returns the layers and files that could not be read or scanned
+func (is *ImageSource) Errors() *scanerr.Log {
+	return is.errors
+}
+
+// readImages reads the images described by manifest.json (docker save) or index.json (OCI)
+func (is *ImageSource) readImages(open func(string) (io.ReadCloser, error)) ([]image, error) {
+	var manifests []dockerManifest
+	if err := readJSON(open, "manifest.json", &manifests); err == nil {
+		is.log.Debug("Reading docker save manifest")
+		images := make([]image, 0, len(manifests))
+		for _, m := range manifests {
+			var cfg imageConfig
+			if err := readJSON(open, m.Config, &cfg); err != nil {
+				return nil, fmt.Errorf("failed to read image config %s: %v", m.Config, err)
+			}
+			name := strings.TrimSuffix(path.Base(m.Config), ".json")
+			if len(m.RepoTags) > 0 {
+				name = m.RepoTags[0]
+			}
+			images = append(images, image{name: name, layers: attributeLayers(m.Layers, nil, cfg)})
+		}
+		return images, nil
+	}
+
+	var index ociIndex
+	if err := readJSON(open, "index.json", &index); err != nil {
+		return nil, fmt.Errorf("neither manifest.json nor index.json found: %v", err)
+	}
+	is.log.Debug("Reading OCI image layout index")
+
+	images := make([]image, 0, len(index.Manifests))
+	for _, desc := range index.Manifests {
+		m, err := is.readManifest(open, desc, 0)
+		if err != nil {
+			return nil, err
+		}
+		if m == nil {
+			is.errors.Add(desc.Digest, "read manifest", fmt.Errorf("no image manifest for %s/%s", runtime.GOOS, runtime.GOARCH))
+			continue
+		}
+
+		var cfg imageConfig
+		if err := readJSON(open, blobPath(m.Config.Digest), &cfg); err != nil {
+			return nil, fmt.Errorf("failed to read image config %s: %v", m.Config.Digest, err)
+		}
+
+		blobs := make([]string, 0, len(m.Layers))
+		digests := make([]string, 0, len(m.Layers))
+		for _, layer := range m.Layers {
+			blobs = append(blobs, blobPath(layer.Digest))
+			digests = append(digests, layer.Digest)
+		}
+
+		name := desc.Annotations["org.opencontainers.image.ref.name"]
+		if name == "" {
+			name = desc.Digest
+		}
+		images = append(images, image{name: name, layers: attributeLayers(blobs, digests, cfg)})
+	}
+	return images, nil
+}
+
+// readManifest reads the image manifest desc points at. Nested indexes of multi-platform
+// images are followed to the manifest of the host platform, or else of the first
+// platform whose blobs are present; nil is returned if an index holds no image manifest.
+func (is *ImageSource) readManifest(open func(string) (io.ReadCloser, error), desc ociDescriptor, depth int) (*ociManifest, error) {
+	var m ociManifest
+	if err := readJSON(open, blobPath(desc.Digest), &m); err != nil {
+		return nil, fmt.Errorf("failed to read manifest %s: %v", desc.Digest, err)
+	}
+	if len(m.Layers) > 0 {
+		return &m, nil
+	}
+	if len(m.Manifests) == 0 || depth >= maxIndexDepth {
+		is.log.Debug("Skipping manifest %s without layers", desc.Digest)
+		return nil, nil
+	}
+
+	is.log.Debug("Following nested index %s", desc.Digest)
+	candidates := make([]ociDescriptor, 0, len(m.Manifests))
+	for _, nested := range m.Manifests {
+		switch {
+		case nested.Platform == nil:
+			candidates = append(candidates, nested)
+		case nested.Platform.OS == runtime.GOOS && nested.Platform.Architecture == runtime.GOARCH:
+			candidates = append([]ociDescriptor{nested}, candidates...)
+		case nested.Platform.OS != "unknown":
+			// Attestations are listed with an unknown platform
+			candidates = append(candidates, nested)
+		}
+	}
+	for _, nested := range candidates {
+		// Layouts exported for one platform keep the index but not the other platforms' blobs
+		manifest, err := is.readManifest(open, nested, depth+1)
+		if err != nil {
+			is.log.Debug("Skipping manifest %s: %v", nested.Digest, err)
+			continue
+		}
+		if manifest != nil {
+			return manifest, nil
+		}
+	}
+	return nil, nil
+}
+
+// scanImage walks the layers of an image in order, scanning every file and building
+// the merged filesystem with whiteouts applied
+func (is *ImageSource) scanImage(ctx context.Context, img image, open func(string) (io.ReadCloser, error)) ([]detector.Finding, error) {
+	is.log.Info("Scanning image %s (%d layers)", img.name, len(img.layers))
+
+	merged := make(map[string]layerFile)
+	var findings []detector.Finding
+
+	for i, layer := range img.layers {
+		layerFindings, err := is.scanLayer(ctx, i, layer, open, merged)
+		if err != nil {
+			findings = append(findings, layerFindings...)
+			if ctx.Err() != nil {
+				break
+			}
+			// Keep the findings of the files read before the layer broke off
+			is.errors.Add(img.name+" layer "+layer.digest, "read layer", err)
+			continue
+		}
+		findings = append(findings, layerFindings...)
+	}
+
+	// Files removed or replaced by a later layer are still present in the image
+	for i := range findings {
+		f, ok := merged[findings[i].Path]
+		if !ok || img.layers[f.layer].digest != findings[i].Metadata["layer"] {
+			findings[i].Metadata["in_final_fs"] = "false"
+		}
+	}
+
+	// Display the merged filesystem and the layers that produced it
+	root := &FileNode{
+		Name:     img.name,
+		IsDir:    true,
+		Children: make([]*FileNode, 0),
+	}
+	paths := make([]string, 0, len(merged))
+	for p := range merged {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		insertPath(root, p, merged[p].size)
+	}
+	displayTree(root, 0)
+
+	fmt.Printf("\n📦 %d layer(s)\n", len(img.layers))
+	for i, layer := range img.layers {
+		fmt.Printf("  %d. %s %s\n", i+1, layer.digest, layer.createdBy)
+	}
+
+	return findings, nil
+}
+
+// scanLayer reads one layer tar, applying its whiteouts to merged and scanning its files
+func (is *ImageSource) scanLayer(ctx context.Context, index int, layer imageLayer, open func(string) (io.ReadCloser, error), merged map[string]layerFile) ([]detector.Finding, error) {
+	rc, err := open(layer.blob)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	// Layers may be stored compressed or not
+	br := bufio.NewReader(rc)
+	var r io.Reader = br
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, scanerr.Decode(fmt.Errorf("failed to decompress layer: %v", err))
+		}
+		defer gr.Close()
+		r = gr
+	}
+
+	var findings []detector.Finding
+	tr := tar.NewReader(r)
+	for {
+		if err := ctx.Err(); err != nil {
+			return findings, err
+		}
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return findings, scanerr.Decode(fmt.Errorf("failed to read layer tar: %v", err))
+		}
+
+		name := strings.TrimPrefix(path.Clean("/"+hdr.Name), "/")
+		dir, base := path.Split(name)
+		dir = strings.TrimSuffix(dir, "/")
+
+		// Apply whiteouts to what lower layers contributed
+		if base == whiteoutOpaque {
+			removeLower(merged, dir, index, true)
+			continue
+		}
+		if strings.HasPrefix(base, whiteoutPrefix) {
+			removeLower(merged, path.Join(dir, strings.TrimPrefix(base, whiteoutPrefix)), index, false)
+			continue
+		}
+
+		if hdr.Typeflag != tar.TypeReg || !is.filter.Match(name, false) {
+			continue
+		}
+		merged["/"+name] = layerFile{size: hdr.Size, layer: index}
+
+		fileFindings, err := is.engine.Scan("/"+name, tr)
+		if err != nil {
+			is.errors.Add("/"+name+" in layer "+layer.digest, "scan file", err)
+		}
+		for i := range fileFindings {
+			// Keep what the detector recorded, such as the sampling seed
+			if fileFindings[i].Metadata == nil {
+				fileFindings[i].Metadata = make(map[string]string)
+			}
+			fileFindings[i].Metadata["layer"] = layer.digest
+			fileFindings[i].Metadata["created_by"] = layer.createdBy
+		}
+		findings = append(findings, fileFindings...)
+	}
+	return findings, nil
+}
+
+// removeLower deletes a path, or only its contents if opaque, contributed by layers below index
+func removeLower(merged map[string]layerFile, p string, index int, opaque bool) {
+	p = "/" + strings.TrimPrefix(p, "/")
+	prefix := strings.TrimSuffix(p, "/") + "/"
+	for name, f := range merged {
+		if f.layer >= index {
+			continue
+		}
+		if (!opaque && name == p) || strings.HasPrefix(name, prefix) {
+			delete(merged, name)
+		}
+	}
+}
+
+// attributeLayers pairs layer blobs with their digests and the non-empty history
+// entries of the image config, which appear in the same order as the layers
+func attributeLayers(blobs, digests []string, cfg imageConfig) []imageLayer {
+	var createdBy []string
+	for _, h := range cfg.History {
+		if !h.EmptyLayer {
+			createdBy = append(createdBy, strings.TrimSpace(strings.TrimPrefix(h.CreatedBy, "/bin/sh -c")))
+		}
+	}
+
+	layers := make([]imageLayer, 0, len(blobs))
+	for i, blob := range blobs {
+		layer := imageLayer{blob: blob, digest: blob}
+		// Prefer the uncompressed diff ID, which is stable across registries
+		if i < len(cfg.RootFS.DiffIDs) {
+			layer.digest = cfg.RootFS.DiffIDs[i]
+		} else if i < len(digests) {
+			layer.digest = digests[i]
+		}
+		if i < len(createdBy) {
+			layer.createdBy = createdBy[i]
+		}
+		layers = append(layers, layer)
+	}
+	return layers
+}
+
+// blobPath returns the path of a blob in an OCI layout
+func blobPath(digest string) string {
+	algorithm, hex, _ := strings.Cut(digest, ":")
+	return path.Join("blobs", algorithm, hex)
+}
+
+// readJSON decodes a JSON file from the image
+func readJSON(open func(string) (io.ReadCloser, error), name string, v interface{}) error {
+	rc, err := open(name)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return json.NewDecoder(rc).Decode(v)
+}
+
+// imageTarball gives random access to the members of an image tarball
+type imageTarball struct {
+	file    *os.File
+	members map[string]*io.SectionReader
+}
+
+// openTarball indexes the members of a tarball by recording where each one's data starts
+func openTarball(tarPath string) (*imageTarball, error) {
+	f, err := os.Open(tarPath)
+	if err != nil {
+		return nil, err
+	}
+
+	cr := &countingReader{r: f}
+	tr := tar.NewReader(cr)
+	members := make(map[string]*io.SectionReader)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			// After Next the underlying reader is positioned at the member's data
+			name := strings.TrimPrefix(path.Clean("/"+hdr.Name), "/")
+			members[name] = io.NewSectionReader(f, cr.n, hdr.Size)
+		}
+	}
+
+	return &imageTarball{file: f, members: members}, nil
+}
+
+// open returns a reader for a member of the tarball
+func (t *imageTarball) open(name string) (io.ReadCloser, error) {
+	sr, ok := t.members[strings.TrimPrefix(path.Clean("/"+name), "/")]
+	if !ok {
+		return nil, fmt.Errorf("%s not found in image tarball", name)
+	}
+	return io.NopCloser(io.NewSectionReader(sr, 0, sr.Size())), nil
+}
+
+// Close closes the tarball
+func (t *imageTarball) Close() error {
+	return t.file.Close()
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+// Read implements io.Reader
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,369 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/adaptive-scale/superscan/pkg/detector"
+	"github.com/adaptive-scale/superscan/pkg/logger"
+	"github.com/adaptive-scale/superscan/pkg/state"
+)
+
+// incremental is the state of one incremental scan
+type incremental struct {
+	ctx    context.Context
+	src    Source
+	reader ContentReader
+	store  *state.Store
+	key    string
+	engine *detector.Engine
+	log    *logger.Logger
+
+	findings                  []detector.Finding
+	added, changed, unchanged int
+	// seen holds the files listed by this run
+	seen map[string]bool
+}
+
+// IncrementalScan scans the files of a source that are new or changed since the
+// last run recorded in store, reuses the findings of unchanged files and reports
+// files that were deleted. Sources with a change feed only list what changed since
+// the last complete run. If ctx is cancelled, the files scanned so far are recorded
+// and reported, and no files are reported deleted. Tabular data is sampled with seed;
+// 0 picks a new seed.
+func IncrementalScan(ctx context.Context, src Source, startPath string, store *state.Store, seed int64) error {
+	log := logger.New(logger.INFO)
+
+	walker, ok := src.(Walker)
+	if !ok {
+		return fmt.Errorf("source %s does not support incremental scanning", src.GetName())
+	}
+	reader, ok := src.(ContentReader)
+	if !ok {
+		return fmt.Errorf("source %s does not support incremental scanning", src.GetName())
+	}
+
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	inc := &incremental{
+		ctx:    ctx,
+		src:    src,
+		reader: reader,
+		store:  store,
+		key:    stateKey(src, startPath),
+		engine: detector.NewEngine(),
+		log:    log,
+		seen:   make(map[string]bool),
+	}
+	inc.engine.SetSeed(seed)
+	log.Info("Incremental scan of %s (seed %d)", inc.key, seed)
+	errorsBefore := src.Errors().Len()
+
+	// A change feed token is kept per start path and feed, e.g. per Drive account and
+	// shared drive, once a complete run has recorded every file
+	feed, hasFeed := src.(ChangeFeed)
+	var tokenKey, startToken string
+	if hasFeed {
+		feedID, err := feed.FeedID(ctx, startPath)
+		if err != nil {
+			return err
+		}
+		tokenKey = inc.key + "@" + feedID
+		token, err := store.Token(tokenKey)
+		if err != nil {
+			return err
+		}
+		if token != "" {
+			return inc.changes(feed, startPath, tokenKey, token, errorsBefore)
+		}
+		// Changes made while walking are listed by the next run
+		if startToken, err = feed.StartToken(ctx, startPath); err != nil {
+			return err
+		}
+	}
+
+	unlistedBefore := len(src.Errors().Unlisted())
+	var err error
+	if hasFeed {
+		err = feed.Snapshot(ctx, startPath, inc.change)
+	} else {
+		err = walker.Walk(ctx, startPath, inc.visit)
+	}
+	if err != nil && ctx.Err() == nil {
+		return err
+	}
+
+	// Files recorded before but not seen now were deleted, which can only be told
+	// apart from files not listed yet after a complete walk. Files below directories
+	// that could not be listed are kept, as they may still exist.
+	var deleted []string
+	if ctx.Err() == nil {
+		unlisted := src.Errors().Unlisted()[unlistedBefore:]
+		kept := 0
+		if err := store.Paths(inc.key, func(path string) error {
+			if inc.seen[path] {
+				return nil
+			}
+			if len(unlisted) > 0 {
+				record, _, err := store.Get(inc.key, path)
+				if err != nil {
+					return err
+				}
+				if record.RelPath == "" || below(record.RelPath, unlisted) {
+					kept++
+					return nil
+				}
+			}
+			deleted = append(deleted, path)
+			return nil
+		}); err != nil {
+			return err
+		}
+		if kept > 0 {
+			log.Info("Keeping the records of %d file(s) below %d path(s) that could not be listed", kept, len(unlisted))
+		}
+	}
+	deletedNames, err := inc.forget(deleted)
+	if err != nil {
+		return err
+	}
+	if err := store.Flush(); err != nil {
+		return err
+	}
+	if hasFeed && ctx.Err() == nil {
+		if src.Errors().Len() > errorsBefore {
+			// The changes after the new token would not list the files that failed
+			log.Info("Not saving the change feed token, as %d path(s) could not be scanned", src.Errors().Len()-errorsBefore)
+		} else if err := store.SetToken(tokenKey, startToken); err != nil {
+			return err
+		}
+	}
+
+	inc.display(deletedNames, "")
+	return ctx.Err()
+}
+
+// changes scans the files listed by a change feed since token, and saves the token
+// of the next run once every change was handled without errors beyond errorsBefore
+func (inc *incremental) changes(feed ChangeFeed, startPath, tokenKey, token string, errorsBefore int) error {
+	var removed []string
+	next, err := feed.Changes(inc.ctx, startPath, token, func(change Change) error {
+		if change.Removed {
+			delete(inc.seen, change.File.Path)
+			removed = append(removed, change.File.Path)
+			return nil
+		}
+		return inc.change(change)
+	})
+	if err != nil && inc.ctx.Err() == nil {
+		return err
+	}
+
+	// Only files and folders that were recorded are reported deleted, as removed ones
+	// may never have been below the start path
+	var deleted, folders []string
+	gone := make(map[string]bool)
+	for _, path := range removed {
+		record, found, err := inc.store.Get(inc.key, path)
+		if err != nil {
+			return err
+		}
+		if !found || inc.seen[path] || gone[path] {
+			continue
+		}
+		gone[path] = true
+		deleted = append(deleted, path)
+		if record.Folder && record.RelPath != "" {
+			folders = append(folders, record.RelPath)
+		}
+	}
+	// The files below removed folders are not listed as changes, so the records below
+	// them are deleted too, unless they were listed again elsewhere
+	if len(folders) > 0 {
+		if err := inc.store.Paths(inc.key, func(path string) error {
+			if inc.seen[path] || gone[path] {
+				return nil
+			}
+			record, _, err := inc.store.Get(inc.key, path)
+			if err == nil && below(record.RelPath, folders) {
+				deleted = append(deleted, path)
+			}
+			return err
+		}); err != nil {
+			return err
+		}
+	}
+	deletedNames, err := inc.forget(deleted)
+	if err != nil {
+		return err
+	}
+
+	// Files that did not change keep their findings
+	if err := inc.store.Paths(inc.key, func(path string) error {
+		if inc.seen[path] {
+			return nil
+		}
+		record, _, err := inc.store.Get(inc.key, path)
+		if record.Folder {
+			return err
+		}
+		inc.unchanged++
+		inc.findings = append(inc.findings, record.Findings...)
+		return err
+	}); err != nil {
+		return err
+	}
+	if err := inc.store.Flush(); err != nil {
+		return err
+	}
+
+	// An interrupted run, or one that could not list, locate or scan some files, lists
+	// the same changes again next time; unchanged files are not rescanned
+	if inc.ctx.Err() == nil {
+		if n := inc.src.Errors().Len() - errorsBefore; n > 0 {
+			inc.log.Info("Not saving the change feed token, as %d path(s) could not be scanned", n)
+		} else if err := inc.store.SetToken(tokenKey, next); err != nil {
+			return err
+		}
+	}
+
+	inc.display(deletedNames, "from the change feed")
+	return inc.ctx.Err()
+}
+
+// visit scans a file listed by a walk or change feed, unless it is unchanged since it
+// was recorded, and records it
+func (inc *incremental) visit(f FileInfo) error {
+	inc.seen[f.Path] = true
+
+	record, found, err := inc.store.Get(inc.key, f.Path)
+	if err != nil {
+		return err
+	}
+	if found && !record.Changed(f.Size, f.ModTime, f.ETag) {
+		inc.unchanged++
+		inc.findings = append(inc.findings, record.Findings...)
+		if record.RelPath != f.RelPath {
+			// Renamed, or moved with its folder, without changing
+			record.RelPath = f.RelPath
+			return inc.store.Put(inc.key, f.Path, record)
+		}
+		return nil
+	}
+
+	fileFindings, err := scanFile(inc.ctx, inc.engine, inc.reader, inc.src.Errors(), f)
+	if err != nil {
+		if inc.ctx.Err() != nil {
+			return inc.ctx.Err()
+		}
+		// Leave the file unrecorded so the next run tries again; a change feed token is
+		// not saved after such a run, so the file is listed again
+		return nil
+	}
+	if found {
+		inc.changed++
+	} else {
+		inc.added++
+	}
+	inc.findings = append(inc.findings, fileFindings...)
+	return inc.store.Put(inc.key, f.Path, state.Record{
+		RelPath:   f.RelPath,
+		Size:      f.Size,
+		ModTime:   f.ModTime,
+		ETag:      f.ETag,
+		ScannedAt: time.Now(),
+		Findings:  fileFindings,
+	})
+}
+
+// change records a folder listed by a change feed, or scans a file like visit
+func (inc *incremental) change(change Change) error {
+	if !change.Folder {
+		return inc.visit(change.File)
+	}
+	f := change.File
+	inc.seen[f.Path] = true
+	record, found, err := inc.store.Get(inc.key, f.Path)
+	if err != nil || (found && record.Folder && record.RelPath == f.RelPath) {
+		return err
+	}
+	return inc.store.Put(inc.key, f.Path, state.Record{RelPath: f.RelPath, Folder: true})
+}
+
+// forget deletes the records of deleted files and folders, returning the names of the
+// files for the report
+func (inc *incremental) forget(deleted []string) ([]string, error) {
+	names := make([]string, 0, len(deleted))
+	for _, path := range deleted {
+		name := path
+		record, found, err := inc.store.Get(inc.key, path)
+		if err != nil {
+			return nil, err
+		}
+		if found && record.RelPath != "" {
+			name = record.RelPath
+		}
+		if !record.Folder {
+			names = append(names, name)
+		}
+		if err := inc.store.Delete(inc.key, path); err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// display prints what an incremental scan found; via says how changes were listed, if
+// not by walking every file
+func (inc *incremental) display(deletedNames []string, via string) {
+	fmt.Printf("\n🔁 Incremental scan of %s", inc.key)
+	if via != "" {
+		fmt.Printf(" %s", via)
+	}
+	fmt.Println()
+	fmt.Printf("  New:       %d\n", inc.added)
+	fmt.Printf("  Changed:   %d\n", inc.changed)
+	fmt.Printf("  Unchanged: %d (not rescanned)\n", inc.unchanged)
+	fmt.Printf("  Deleted:   %d\n", len(deletedNames))
+	for _, name := range deletedNames {
+		fmt.Printf("    🗑  %s\n", name)
+	}
+	if len(inc.findings) > 0 {
+		displayFindings(inc.findings)
+	}
+}
+
+// below reports whether relPath is at or below one of the relative paths in dirs, ""
+// standing for every path
+func below(relPath string, dirs []string) bool {
+	for _, dir := range dirs {
+		if dir == "" || relPath == dir || strings.HasPrefix(relPath, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// stateKey identifies a source and start path in the state store, so that scans of
+// different folders or buckets are tracked separately
+func stateKey(src Source, startPath string) string {
+	switch s := src.(type) {
+	case *FileSystemSource:
+		if abs, err := filepath.Abs(startPath); err == nil {
+			startPath = abs
+		}
+	case *S3Source:
+		return fmt.Sprintf("s3://%s/%s", s.bucket, startPath)
+	case *GoogleDriveSource:
+		if startPath == "" {
+			startPath = "root"
+		}
+	}
+	return src.GetName() + ":" + startPath
+}
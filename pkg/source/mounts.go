@@ -0,0 +1,35 @@
+package source
+
+import (
+	"strings"
+)
+
+// virtualFSTypes are filesystems whose files are generated by the kernel rather than
+// stored, so scanning them is slow, endless or meaningless
+var virtualFSTypes = map[string]bool{
+	"proc": true, "sysfs": true, "devtmpfs": true, "devpts": true, "devfs": true,
+	"cgroup": true, "cgroup2": true, "debugfs": true, "tracefs": true, "securityfs": true,
+	"pstore": true, "bpf": true, "configfs": true, "fusectl": true, "mqueue": true,
+	"hugetlbfs": true, "autofs": true, "binfmt_misc": true, "efivarfs": true,
+	"selinuxfs": true, "rpc_pipefs": true, "nsfs": true,
+}
+
+// networkFSTypes are filesystems served by another host, which may be slow to walk
+// and are usually scanned through their own source instead
+var networkFSTypes = map[string]bool{
+	"nfs": true, "nfs4": true, "cifs": true, "smb3": true, "smbfs": true, "ncpfs": true,
+	"afs": true, "9p": true, "ceph": true, "glusterfs": true, "lustre": true, "gpfs": true,
+	"davfs": true, "fuse.sshfs": true, "fuse.rclone": true, "fuse.s3fs": true, "fuse.gcsfuse": true,
+}
+
+// mountKind returns "virtual filesystem" or "network filesystem" for the types that are
+// skipped by default, and "" for any other
+func mountKind(fsType string) string {
+	switch {
+	case virtualFSTypes[fsType]:
+		return "virtual filesystem"
+	case networkFSTypes[fsType], strings.HasPrefix(fsType, "nfs"):
+		return "network filesystem"
+	}
+	return ""
+}
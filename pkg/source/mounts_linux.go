@@ -0,0 +1,52 @@
+package source
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// readMounts returns the filesystem type of every mount point, from /proc/self/mountinfo
+func readMounts() (map[string]string, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// Lines look like "36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw",
+	// with the mount point fifth and the type after the separator
+	mounts := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		for i := 6; i < len(fields)-1; i++ {
+			if fields[i] == "-" {
+				// Later mounts on the same point hide earlier ones
+				mounts[unescapeMount(fields[4])] = fields[i+1]
+				break
+			}
+		}
+	}
+	return mounts, scanner.Err()
+}
+
+// unescapeMount decodes the octal escapes of spaces, tabs, newlines and backslashes in mountinfo paths
+func unescapeMount(path string) string {
+	if !strings.Contains(path, `\`) {
+		return path
+	}
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		if path[i] == '\\' && i+3 < len(path) {
+			if c, err := strconv.ParseUint(path[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(path[i])
+	}
+	return b.String()
+}
@@ -3,13 +3,26 @@ package source
 import (
 	"fmt"
 	"strings"
+	"time"
+
+	"github.com/adaptive-scale/superscan/pkg/archive"
+	"github.com/adaptive-scale/superscan/pkg/computation"
+	"github.com/adaptive-scale/superscan/pkg/detector"
 )
 
 // FileNode represents a file or directory in the tree
 type FileNode struct {
-	Name     string
-	IsDir    bool
-	Size     int64
+	Name    string
+	IsDir   bool
+	Size    int64
+	ModTime time.Time
+	ETag    string
+	// Type is the content type detected from the file's magic bytes, if it was sniffed
+	Type string
+	// SecurityDescriptor holds the NT security descriptor in SDDL form, if known
+	SecurityDescriptor string
+	// Note explains anything unusual about the node, such as an archive that was not expanded
+	Note     string
 	Children []*FileNode
 }
 
@@ -22,7 +35,13 @@ func displayTree(node *FileNode, level int) {
 	if node.IsDir {
 		fmt.Printf("%s📁 %s/\n", indent, node.Name)
 	} else {
-		fmt.Printf("%s📄 %s (%d bytes)\n", indent, node.Name, node.Size)
+		fmt.Printf("%s📄 %s (%d bytes)%s\n", indent, node.Name, node.Size, typeLabel(node))
+	}
+	if node.Note != "" {
+		fmt.Printf("%s  ⚠️  %s\n", indent, node.Note)
+	}
+	if node.SecurityDescriptor != "" {
+		fmt.Printf("%s  🔒 %s\n", indent, node.SecurityDescriptor)
 	}
 
 	// Print children
@@ -30,3 +49,92 @@ func displayTree(node *FileNode, level int) {
 		displayTree(child, level+1)
 	}
 }
+
+// insertPath adds a file at a slash separated path below root, creating directories as needed
+func insertPath(root *FileNode, path string, size int64) *FileNode {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	current := root
+	for _, part := range parts[:len(parts)-1] {
+		// Find or create directory node
+		var dirNode *FileNode
+		for _, child := range current.Children {
+			if child.Name == part && child.IsDir {
+				dirNode = child
+				break
+			}
+		}
+		if dirNode == nil {
+			dirNode = &FileNode{
+				Name:     part,
+				IsDir:    true,
+				Children: make([]*FileNode, 0),
+			}
+			current.Children = append(current.Children, dirNode)
+		}
+		current = dirNode
+	}
+
+	// Reuse an existing file node for a path seen before
+	name := parts[len(parts)-1]
+	for _, child := range current.Children {
+		if child.Name == name && !child.IsDir {
+			child.Size = size
+			return child
+		}
+	}
+	fileNode := &FileNode{
+		Name: name,
+		Size: size,
+	}
+	current.Children = append(current.Children, fileNode)
+	return fileNode
+}
+
+// displayFindings prints detector findings below the tree
+func displayFindings(findings []detector.Finding) {
+	fmt.Printf("\n🔍 %d finding(s)\n", len(findings))
+	for _, f := range findings {
+		fmt.Printf("  🔑 %s\n", f)
+	}
+}
+
+// archiveNodes converts the entries of an expanded archive into virtual tree nodes
+func archiveNodes(entries []*archive.Entry) []*FileNode {
+	nodes := make([]*FileNode, 0, len(entries))
+	for _, entry := range entries {
+		node := &FileNode{
+			Name:     entry.Name,
+			IsDir:    entry.IsDir,
+			Size:     entry.Size,
+			Type:     entry.Type,
+			Children: archiveNodes(entry.Children),
+		}
+		if !entry.IsDir {
+			addNote(node, computation.ExtensionMismatch(entry.Name, entry.Type))
+		}
+		if entry.Err != nil {
+			addNote(node, fmt.Sprintf("expansion stopped: %v", entry.Err))
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+// addNote appends a note to a node, keeping any note already present
+func addNote(node *FileNode, note string) {
+	if note == "" {
+		return
+	}
+	if node.Note != "" {
+		node.Note += "; "
+	}
+	node.Note += note
+}
+
+// typeLabel formats the detected content type of a file for display
+func typeLabel(node *FileNode) string {
+	if node.Type == "" {
+		return ""
+	}
+	return fmt.Sprintf(" [%s]", node.Type)
+}
@@ -0,0 +1,473 @@
+package source
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/adaptive-scale/superscan/pkg/detector"
+)
+
+// Severity ranks posture findings by how exposed a file is
+type Severity int
+
+const (
+	// SeverityLow is worth reviewing, such as an ACL granting extra access
+	SeverityLow Severity = iota
+	// SeverityMedium weakens the system, such as a world-writable file
+	SeverityMedium
+	// SeverityHigh exposes data or lets others tamper with files, such as a secret readable by anyone
+	SeverityHigh
+	// SeverityCritical lets others gain privileges, such as a setuid program anyone can modify
+	SeverityCritical
+)
+
+// String returns the name of the severity
+func (s Severity) String() string {
+	switch s {
+	case SeverityCritical:
+		return "critical"
+	case SeverityHigh:
+		return "high"
+	case SeverityMedium:
+		return "medium"
+	default:
+		return "low"
+	}
+}
+
+// Posture rules
+const (
+	RuleWorldReadableSecret = "world-readable-secret"
+	RuleWritableSetuid      = "writable-setuid"
+	RuleSetuid              = "setuid"
+	RuleSetgid              = "setgid"
+	RuleWorldWritable       = "world-writable"
+	RuleWorldWritableDir    = "world-writable-dir"
+	RuleUnknownOwner        = "unknown-owner"
+	RuleUnknownGroup        = "unknown-group"
+	RuleExtendedACL         = "extended-acl"
+	RuleFileCapabilities    = "file-capabilities"
+)
+
+// Extended attributes holding POSIX ACLs and file capabilities
+const (
+	aclAccessXattr  = "system.posix_acl_access"
+	aclDefaultXattr = "system.posix_acl_default"
+	capabilityXattr = "security.capability"
+)
+
+// POSIX ACL entry tags, as stored in the ACL extended attributes
+const (
+	aclUser  = 0x02
+	aclGroup = 0x08
+	aclMask  = 0x10
+)
+
+// PostureFinding is a risky permission, ownership or attribute of a file or directory
+type PostureFinding struct {
+	Rule     string
+	Severity Severity
+	// Path is relative to the start path
+	Path  string
+	Mode  os.FileMode
+	Owner string
+	Group string
+	// Detail explains the finding, e.g. the secrets found or the ACL entries
+	Detail string
+}
+
+// String returns a single line description of the finding
+func (f PostureFinding) String() string {
+	s := fmt.Sprintf("%s: %s (%s %s:%s)", f.Rule, f.Path, lsMode(f.Mode), f.Owner, f.Group)
+	if f.Detail != "" {
+		s += " " + f.Detail
+	}
+	return s
+}
+
+// Auditor is implemented by sources that can audit the permissions and ownership of their files
+type Auditor interface {
+	Audit(ctx context.Context, startPath string) error
+}
+
+// audit is the state of one posture audit
+type audit struct {
+	fs       *FileSystemSource
+	engine   *detector.Engine
+	findings []PostureFinding
+	files    int
+	dirs     int
+	scanned  int
+	// users and groups cache names by ID, "" for IDs that do not exist
+	users  map[uint32]string
+	groups map[uint32]string
+}
+
+// auditDir is a directory still to be audited
+type auditDir struct {
+	path string
+	// reachable is set if others may traverse every directory down to it
+	reachable bool
+}
+
+// Audit reads the owner, mode bits, ACLs and extended attributes of every file and
+// directory below startPath and reports risky ones: setuid and setgid programs,
+// world-writable files and directories, owners that do not exist, extended ACLs, file
+// capabilities, and world-readable files containing secrets. If ctx is cancelled, the
+// findings so far are reported.
+func (fs *FileSystemSource) Audit(ctx context.Context, startPath string) error {
+	fs.log.Info("Starting posture audit from path: %s", startPath)
+
+	if startPath == "" {
+		startPath = "."
+	}
+	absPath, err := filepath.Abs(startPath)
+	if err != nil {
+		fs.log.Error("Failed to convert path to absolute: %v", err)
+		return fmt.Errorf("failed to convert path to absolute: %v", err)
+	}
+	info, err := os.Stat(absPath)
+	if err != nil {
+		fs.log.Error("Failed to stat start path %s: %v", absPath, err)
+		return fmt.Errorf("failed to stat start path %s: %v", absPath, err)
+	}
+	if _, _, ok := fileOwner(info); !ok {
+		return fmt.Errorf("posture audits need a filesystem with unix owners and permissions")
+	}
+
+	a := &audit{
+		fs:     fs,
+		engine: detector.NewEngine(),
+		users:  make(map[uint32]string),
+		groups: make(map[uint32]string),
+	}
+	w := fs.newWalk(absPath)
+	a.check(ctx, absPath, ".", info, reachable(filepath.Dir(absPath)))
+
+	stack := []auditDir{{absPath, reachable(absPath)}}
+	for len(stack) > 0 && ctx.Err() == nil {
+		current := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		entries, err := os.ReadDir(current.path)
+		if err != nil {
+			fs.errors.Add(current.path, "read directory", err)
+			continue
+		}
+		for _, entry := range entries {
+			if ctx.Err() != nil {
+				break
+			}
+			fullPath := filepath.Join(current.path, entry.Name())
+			e, ok := fs.visit(w, fullPath, entry)
+			if !ok || e.info.Mode()&os.ModeSymlink != 0 {
+				// Symlinks have no permissions of their own
+				continue
+			}
+
+			relPath, _ := filepath.Rel(absPath, fullPath)
+			a.check(ctx, fullPath, filepath.ToSlash(relPath), e.info, current.reachable)
+			if e.descend {
+				stack = append(stack, auditDir{fullPath, current.reachable && e.info.Mode()&0o001 != 0})
+			} else if e.isDir {
+				fs.log.Info("Skipping %s: %s", fullPath, e.note)
+			}
+		}
+	}
+
+	a.display(absPath)
+	return ctx.Err()
+}
+
+// check audits one file or directory. reachable is set if others may traverse the
+// directories leading to it.
+func (a *audit) check(ctx context.Context, fullPath, relPath string, info os.FileInfo, reachable bool) {
+	mode := info.Mode()
+	perm := mode.Perm()
+	uid, gid, _ := fileOwner(info)
+	owner, ownerKnown := a.userName(uid)
+	group, groupKnown := a.groupName(gid)
+	add := func(rule string, severity Severity, detail string) {
+		a.findings = append(a.findings, PostureFinding{
+			Rule:     rule,
+			Severity: severity,
+			Path:     relPath,
+			Mode:     mode,
+			Owner:    owner,
+			Group:    group,
+			Detail:   detail,
+		})
+	}
+
+	if mode.IsDir() {
+		a.dirs++
+		// The sticky bit stops others from deleting and replacing files, as in /tmp
+		if perm&0o002 != 0 && mode&os.ModeSticky == 0 {
+			add(RuleWorldWritableDir, SeverityHigh, "anyone can delete and replace its files")
+		}
+	} else if mode.IsRegular() {
+		a.files++
+		switch {
+		case mode&(os.ModeSetuid|os.ModeSetgid) != 0 && perm&0o022 != 0:
+			add(RuleWritableSetuid, SeverityCritical, "privileged program writable by "+writers(perm))
+		case mode&os.ModeSetuid != 0 && !ownerKnown:
+			add(RuleSetuid, SeverityHigh, "runs as a user that does not exist")
+		case mode&os.ModeSetuid != 0:
+			add(RuleSetuid, SeverityMedium, "runs as "+owner)
+		case mode&os.ModeSetgid != 0:
+			add(RuleSetgid, SeverityMedium, "runs with group "+group)
+		}
+		if perm&0o002 != 0 && mode&(os.ModeSetuid|os.ModeSetgid) == 0 {
+			if perm&0o111 != 0 {
+				add(RuleWorldWritable, SeverityHigh, "executable anyone can modify")
+			} else {
+				add(RuleWorldWritable, SeverityMedium, "")
+			}
+		}
+		if perm&0o004 != 0 {
+			a.checkSecrets(ctx, fullPath, relPath, info, reachable, add)
+		}
+	}
+
+	if !ownerKnown {
+		add(RuleUnknownOwner, SeverityMedium, fmt.Sprintf("uid %d has no user", uid))
+	}
+	if !groupKnown {
+		add(RuleUnknownGroup, SeverityLow, fmt.Sprintf("gid %d has no group", gid))
+	}
+	a.checkXattrs(fullPath, add)
+}
+
+// checkSecrets scans a world-readable file and reports the secrets it contains
+func (a *audit) checkSecrets(ctx context.Context, fullPath, relPath string, info os.FileInfo, reachable bool, add func(string, Severity, string)) {
+	a.scanned++
+	findings, err := scanFile(ctx, a.engine, a.fs, a.fs.errors, FileInfo{
+		Path:    fullPath,
+		RelPath: relPath,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	})
+	if err != nil || len(findings) == 0 {
+		return
+	}
+
+	rules := make(map[string]bool)
+	for _, f := range findings {
+		rules[f.Rule] = true
+	}
+	names := make([]string, 0, len(rules))
+	for rule := range rules {
+		names = append(names, rule)
+	}
+	sort.Strings(names)
+	detail := "contains " + strings.Join(names, ", ")
+
+	// A closed parent directory keeps others out, but only until its mode changes
+	if !reachable {
+		add(RuleWorldReadableSecret, SeverityMedium, detail+"; a parent directory keeps others out")
+		return
+	}
+	add(RuleWorldReadableSecret, SeverityHigh, detail)
+}
+
+// checkXattrs reports extended ACL entries and file capabilities
+func (a *audit) checkXattrs(fullPath string, add func(string, Severity, string)) {
+	names, err := listXattrs(fullPath)
+	if err != nil {
+		a.fs.errors.Add(fullPath, "list extended attributes", err)
+		return
+	}
+
+	var entries []string
+	for _, name := range names {
+		switch name {
+		case aclAccessXattr, aclDefaultXattr:
+			value, err := getXattr(fullPath, name)
+			if err != nil {
+				a.fs.errors.Add(fullPath, "read ACL", err)
+				continue
+			}
+			prefix := ""
+			if name == aclDefaultXattr {
+				prefix = "default:"
+			}
+			for _, entry := range a.parseACL(value) {
+				entries = append(entries, prefix+entry)
+			}
+		case capabilityXattr:
+			add(RuleFileCapabilities, SeverityMedium, "grants capabilities to whoever runs it")
+		}
+	}
+	if len(entries) > 0 {
+		add(RuleExtendedACL, SeverityLow, strings.Join(entries, ","))
+	}
+}
+
+// parseACL returns the named user and group entries and the mask of a POSIX ACL in
+// its extended attribute encoding: a version followed by tag, permissions and ID
+// triplets. The owner, group and other entries repeat the mode bits and are omitted.
+func (a *audit) parseACL(value []byte) []string {
+	if len(value) < 4 {
+		return nil
+	}
+	var entries []string
+	for b := value[4:]; len(b) >= 8; b = b[8:] {
+		tag := binary.LittleEndian.Uint16(b[0:2])
+		perm := os.FileMode(binary.LittleEndian.Uint16(b[2:4]))
+		id := binary.LittleEndian.Uint32(b[4:8])
+		rwx := perm.String()[7:]
+		switch tag {
+		case aclUser:
+			name, _ := a.userName(id)
+			entries = append(entries, fmt.Sprintf("user:%s:%s", name, rwx))
+		case aclGroup:
+			name, _ := a.groupName(id)
+			entries = append(entries, fmt.Sprintf("group:%s:%s", name, rwx))
+		case aclMask:
+			entries = append(entries, "mask::"+rwx)
+		}
+	}
+	// A mask alone is not an extended ACL
+	if len(entries) == 1 && strings.HasPrefix(entries[0], "mask:") {
+		return nil
+	}
+	return entries
+}
+
+// userName returns the name of a user, or its ID and false if no such user exists
+func (a *audit) userName(uid uint32) (string, bool) {
+	id := strconv.FormatUint(uint64(uid), 10)
+	name, ok := a.users[uid]
+	if !ok {
+		u, err := user.LookupId(id)
+		var unknown user.UnknownUserIdError
+		switch {
+		case errors.As(err, &unknown):
+			name = ""
+		case err != nil:
+			// Users that cannot be looked up are not reported as missing
+			name = id
+		default:
+			name = u.Username
+		}
+		a.users[uid] = name
+	}
+	if name == "" {
+		return id, false
+	}
+	return name, true
+}
+
+// groupName returns the name of a group, or its ID and false if no such group exists
+func (a *audit) groupName(gid uint32) (string, bool) {
+	id := strconv.FormatUint(uint64(gid), 10)
+	name, ok := a.groups[gid]
+	if !ok {
+		g, err := user.LookupGroupId(id)
+		var unknown user.UnknownGroupIdError
+		switch {
+		case errors.As(err, &unknown):
+			name = ""
+		case err != nil:
+			name = id
+		default:
+			name = g.Name
+		}
+		a.groups[gid] = name
+	}
+	if name == "" {
+		return id, false
+	}
+	return name, true
+}
+
+// lsMode formats mode bits as ls does, e.g. -rwsr-xr-x for a setuid program
+func lsMode(mode os.FileMode) string {
+	b := []byte("-rwxrwxrwx")
+	if mode.IsDir() {
+		b[0] = 'd'
+	}
+	for i := 0; i < 9; i++ {
+		if mode&(1<<uint(8-i)) == 0 {
+			b[i+1] = '-'
+		}
+	}
+
+	// Special bits replace the execute bit, in upper case if it is not set
+	special := func(i int, set bool, c byte) {
+		if !set {
+			return
+		}
+		if b[i] == '-' {
+			c -= 'a' - 'A'
+		}
+		b[i] = c
+	}
+	special(3, mode&os.ModeSetuid != 0, 's')
+	special(6, mode&os.ModeSetgid != 0, 's')
+	special(9, mode&os.ModeSticky != 0, 't')
+	return string(b)
+}
+
+// writers names who besides the owner may write a file
+func writers(perm os.FileMode) string {
+	switch {
+	case perm&0o022 == 0o022:
+		return "group and others"
+	case perm&0o002 != 0:
+		return "others"
+	default:
+		return "group"
+	}
+}
+
+// reachable reports whether others may traverse dir and every directory above it
+func reachable(dir string) bool {
+	for {
+		info, err := os.Stat(dir)
+		if err != nil || info.Mode().Perm()&0o001 == 0 {
+			return false
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return true
+		}
+		dir = parent
+	}
+}
+
+// display prints what was audited and the findings, most severe first
+func (a *audit) display(root string) {
+	fmt.Printf("\n🛡  Posture audit of %s\n", root)
+	fmt.Printf("  Checked: %d files, %d directories\n", a.files, a.dirs)
+	fmt.Printf("  Scanned: %d world-readable files for secrets\n", a.scanned)
+
+	if len(a.findings) == 0 {
+		fmt.Printf("\n✅ No risky permissions or ownership found\n")
+		return
+	}
+
+	sort.SliceStable(a.findings, func(i, j int) bool {
+		if a.findings[i].Severity != a.findings[j].Severity {
+			return a.findings[i].Severity > a.findings[j].Severity
+		}
+		return a.findings[i].Path < a.findings[j].Path
+	})
+	counts := make(map[Severity]int)
+	for _, f := range a.findings {
+		counts[f.Severity]++
+	}
+	fmt.Printf("\n⚠️  %d posture finding(s): %d critical, %d high, %d medium, %d low\n", len(a.findings),
+		counts[SeverityCritical], counts[SeverityHigh], counts[SeverityMedium], counts[SeverityLow])
+	for _, f := range a.findings {
+		fmt.Printf("  [%s] %s\n", f.Severity, f)
+	}
+}
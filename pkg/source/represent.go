@@ -0,0 +1,304 @@
+package source
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/adaptive-scale/superscan/pkg/computation"
+	"github.com/adaptive-scale/superscan/pkg/config"
+	"github.com/adaptive-scale/superscan/pkg/detector"
+	"github.com/adaptive-scale/superscan/pkg/logger"
+)
+
+const (
+	// maxClustersShown limits the per-cluster table of a representative scan
+	maxClustersShown = 20
+
+	// DefaultSignatures is how many files of each extension and size bucket are read
+	// to cluster them by content
+	DefaultSignatures = 32
+
+	// headCacheBytes bounds the content of small files kept after reading them for
+	// their signature, so that representatives among them are not downloaded twice
+	headCacheBytes = 64 << 20
+)
+
+// RepresentativeOptions controls a representative-only scan
+type RepresentativeOptions struct {
+	// PerCluster is how many files of each cluster are scanned
+	PerCluster int
+	// Threshold is the minimum similarity of a file to its cluster's representative
+	Threshold float64
+	// MetadataOnly clusters by extension and size instead of reading any file
+	MetadataOnly bool
+	// Signatures is how many files of each extension and size bucket are read to
+	// cluster them by content. The other files of a bucket are not read and are
+	// assumed to be spread over clusters like the files read.
+	Signatures int
+	// Seed makes the choice of extra representatives reproducible; 0 picks a new seed
+	Seed int64
+}
+
+// DefaultRepresentativeOptions returns the default options: two files per cluster
+// of files at least 80% similar by content, read from up to 32 files per bucket
+func DefaultRepresentativeOptions() RepresentativeOptions {
+	return RepresentativeOptions{
+		PerCluster: 2,
+		Threshold:  computation.DefaultSimilarity,
+		Signatures: DefaultSignatures,
+	}
+}
+
+// RepresentativeOptionsFromConfig returns the default options with any configured overrides
+func RepresentativeOptionsFromConfig(cfg *config.Config) RepresentativeOptions {
+	opts := DefaultRepresentativeOptions()
+	if cfg == nil {
+		return opts
+	}
+
+	opts.Seed = cfg.Sampling.Seed
+	opts.MetadataOnly = cfg.Clustering.MetadataOnly
+	if cfg.Clustering.Representatives > 0 {
+		opts.PerCluster = cfg.Clustering.Representatives
+	}
+	if cfg.Clustering.Threshold > 0 && cfg.Clustering.Threshold <= 1 {
+		opts.Threshold = cfg.Clustering.Threshold
+	}
+	if cfg.Clustering.Signatures > 0 {
+		opts.Signatures = cfg.Clustering.Signatures
+	}
+	return opts
+}
+
+// clusterResult is the outcome of scanning the representatives of one cluster
+type clusterResult struct {
+	representative string
+	// files is how many files the cluster is estimated to hold, counting those of
+	// its buckets that were not read
+	files   float64
+	scanned int
+	// hits counts scanned files with at least one finding, per rule
+	hits map[string]int
+}
+
+// RepresentativeScan clusters the files of a source by similarity and scans only a
+// few representatives of each cluster, extrapolating their findings to the rest of
+// the cluster. Only a sample of each extension and size bucket is read and clustered
+// by content, each file read standing for its share of the bucket. If ctx is
+// cancelled while scanning, only the clusters scanned so far are reported.
+func RepresentativeScan(ctx context.Context, src Source, startPath string, opts RepresentativeOptions) error {
+	log := logger.New(logger.INFO)
+
+	walker, ok := src.(Walker)
+	if !ok {
+		return fmt.Errorf("source %s does not support representative scanning", src.GetName())
+	}
+	reader, ok := src.(ContentReader)
+	if !ok {
+		return fmt.Errorf("source %s does not support representative scanning", src.GetName())
+	}
+
+	if opts.Seed == 0 {
+		opts.Seed = time.Now().UnixNano()
+	}
+	if opts.PerCluster < 1 {
+		opts.PerCluster = 1
+	}
+	if opts.Signatures < 1 {
+		opts.Signatures = DefaultSignatures
+	}
+	sampler := computation.NewSampler(opts.Seed)
+	engine := detector.NewEngine()
+	engine.SetSeed(opts.Seed)
+
+	// List every file, keeping a sample of each extension and size bucket to read.
+	// Without reading, every file is clustered by its metadata.
+	log.Info("Listing files for clustering from path: %s", startPath)
+	var files []FileInfo
+	var weights []float64
+	listed := 0
+	bucket := computation.Strata(computation.ByExtension, computation.BySizeBucket)
+	strata := computation.NewStratifiedSampler(sampler.Derive("signatures"), opts.Signatures, func(f FileInfo) string {
+		return bucket(computation.File{Name: f.RelPath, Size: f.Size})
+	})
+	if err := walker.Walk(ctx, startPath, func(f FileInfo) error {
+		listed++
+		if opts.MetadataOnly {
+			files = append(files, f)
+			weights = append(weights, 1)
+		} else {
+			strata.Add(f)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, s := range strata.Strata() {
+		for _, f := range s.Sample {
+			files = append(files, f)
+			weights = append(weights, float64(s.Seen)/float64(len(s.Sample)))
+		}
+	}
+
+	// Sign the files sampled, keeping the content of small files read in full
+	items := make([]computation.Item, len(files))
+	heads := &cachedReader{ContentReader: reader, heads: make(map[string][]byte)}
+	for i, f := range files {
+		items[i] = computation.Item{File: computation.File{Name: f.RelPath, Size: f.Size}}
+		if opts.MetadataOnly || f.Size == 0 {
+			continue
+		}
+		head, err := readHead(ctx, reader, f.Path)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			src.Errors().Add(f.RelPath, "read file", err)
+			continue
+		}
+		items[i].File.Type = computation.DetectType(head[:min(len(head), computation.SniffSize)])
+		items[i].Signature = computation.ContentSignature(head)
+		heads.keep(f, head)
+	}
+
+	// Scan the representatives of each cluster
+	clusters := computation.ClusterItems(items, opts.Threshold)
+	log.Info("Clustered %d files into %d clusters", len(files), len(clusters))
+
+	var findings []detector.Finding
+	var results []clusterResult
+	for _, c := range clusters {
+		if ctx.Err() != nil {
+			break
+		}
+		rep := files[c.Representative()]
+
+		// The representative itself, then others picked at random
+		others := make([]int, 0, len(c.Members)-1)
+		for _, m := range c.Members[1:] {
+			others = append(others, m.Index)
+		}
+		chosen := append([]int{c.Representative()}, computation.SelectRandomWith(sampler.Derive(rep.RelPath), others, opts.PerCluster-1)...)
+
+		result := clusterResult{
+			representative: rep.RelPath,
+			hits:           make(map[string]int),
+		}
+		for _, m := range c.Members {
+			result.files += weights[m.Index]
+		}
+		for _, i := range chosen {
+			fileFindings, err := scanFile(ctx, engine, heads, src.Errors(), files[i])
+			if err != nil {
+				if ctx.Err() != nil {
+					break
+				}
+				continue
+			}
+			result.scanned++
+			countRules(result.hits, fileFindings)
+			findings = append(findings, fileFindings...)
+		}
+		results = append(results, result)
+	}
+
+	// Clusters of buckets that were not read in full may stand for more files than
+	// they hold
+	sort.SliceStable(results, func(i, j int) bool { return results[i].files > results[j].files })
+	displayRepresentativeReport(results, listed, len(files), opts)
+	if len(findings) > 0 {
+		displayFindings(findings)
+	}
+	return ctx.Err()
+}
+
+// readHead reads the part of a file used for its similarity signature
+func readHead(ctx context.Context, reader ContentReader, path string) ([]byte, error) {
+	rc, err := reader.ReadFile(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(io.LimitReader(rc, computation.SignatureBytes))
+}
+
+// cachedReader serves the files read in full for their signature from memory
+type cachedReader struct {
+	ContentReader
+	heads map[string][]byte
+	size  int
+}
+
+// keep remembers the content of f if head holds all of it and the cache has room
+func (r *cachedReader) keep(f FileInfo, head []byte) {
+	if int64(len(head)) == f.Size && r.size+len(head) <= headCacheBytes {
+		r.heads[f.Path] = head
+		r.size += len(head)
+	}
+}
+
+// ReadFile returns the cached content of a file, or reads it from the source
+func (r *cachedReader) ReadFile(ctx context.Context, path string) (io.ReadCloser, error) {
+	if head, ok := r.heads[path]; ok {
+		return io.NopCloser(bytes.NewReader(head)), nil
+	}
+	return r.ContentReader.ReadFile(ctx, path)
+}
+
+// displayRepresentativeReport prints the largest clusters and the number of files
+// estimated to have each finding type
+func displayRepresentativeReport(results []clusterResult, listed, read int, opts RepresentativeOptions) {
+	scanned := 0
+	ruleSet := make(map[string]bool)
+	for _, r := range results {
+		scanned += r.scanned
+		for rule := range r.hits {
+			ruleSet[rule] = true
+		}
+	}
+
+	fmt.Printf("\n🧬 Representative scan (seed %d)\n", opts.Seed)
+	fmt.Printf("  Files listed:  %d in %d cluster(s) at %.0f%% similarity\n", listed, len(results), opts.Threshold*100)
+	if !opts.MetadataOnly {
+		fmt.Printf("  Files read:    %d to cluster (up to %d per extension and size)\n", read, opts.Signatures)
+	}
+	fmt.Printf("  Files scanned: %d (up to %d per cluster)\n", scanned, opts.PerCluster)
+
+	// Largest clusters
+	fmt.Printf("\n  %-48s %10s %10s %10s\n", "Representative", "Files", "Scanned", "With hits")
+	for i, r := range results {
+		if i == maxClustersShown {
+			fmt.Printf("  ... %d more cluster(s)\n", len(results)-maxClustersShown)
+			break
+		}
+		fmt.Printf("  %-48s %10.0f %10d %10d\n", r.representative, r.files, r.scanned, r.hits[anyFinding])
+	}
+
+	// Extrapolated files per rule, with files with any finding last
+	rules := make([]string, 0, len(ruleSet))
+	for rule := range ruleSet {
+		if rule != anyFinding {
+			rules = append(rules, rule)
+		}
+	}
+	sort.Strings(rules)
+	rules = append(rules, anyFinding)
+
+	fmt.Printf("\n  Estimated files with findings (each cluster assumed like its scanned files):\n")
+	for _, rule := range rules {
+		var estimate float64
+		hits := 0
+		for _, r := range results {
+			if r.scanned > 0 {
+				estimate += float64(r.hits[rule]) / float64(r.scanned) * r.files
+			}
+			hits += r.hits[rule]
+		}
+		fmt.Printf("  %-24s ≈ %d files  [%d of %d scanned]\n", rule, int64(math.Round(estimate)), hits, scanned)
+	}
+}
@@ -3,9 +3,13 @@ package source
 import (
 	"context"
 	"fmt"
+	"io"
 	"strings"
 
+	"github.com/adaptive-scale/superscan/pkg/filter"
 	"github.com/adaptive-scale/superscan/pkg/logger"
+	"github.com/adaptive-scale/superscan/pkg/retry"
+	"github.com/adaptive-scale/superscan/pkg/scanerr"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
@@ -15,33 +19,53 @@ import (
 type S3Source struct {
 	client *s3.Client
 	bucket string
+	retry  *retry.Policy
+	filter *filter.Filter
+	errors *scanerr.Log
 	log    *logger.Logger
 }
 
 // NewS3Source creates a new S3 source
-func NewS3Source(bucket string) (*S3Source, error) {
+func NewS3Source(ctx context.Context, bucket string) (*S3Source, error) {
 	log := logger.New(logger.INFO)
 	log.Info("Initializing S3 source for bucket: %s", bucket)
 
 	// Load AWS configuration
-	cfg, err := config.LoadDefaultConfig(context.TODO())
+	cfg, err := config.LoadDefaultConfig(ctx)
 	if err != nil {
 		log.Error("Failed to load AWS config: %v", err)
 		return nil, fmt.Errorf("failed to load AWS config: %v", err)
 	}
 
-	// Create S3 client
-	client := s3.NewFromConfig(cfg)
+	// Create S3 client. Requests are retried by the source's policy, which honors
+	// SlowDown and Retry-After, instead of the SDK.
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		o.Retryer = aws.NopRetryer{}
+	})
 
 	return &S3Source{
 		client: client,
 		bucket: bucket,
+		retry:  retry.DefaultPolicy(),
+		filter: filter.New(filter.Options{}),
+		errors: scanerr.NewLog(),
 		log:    log,
 	}, nil
 }
 
-// ListFiles lists files in the S3 bucket
-func (s *S3Source) ListFiles(startPath string) error {
+// SetRetryPolicy sets how throttled and failed S3 requests are retried
+func (s *S3Source) SetRetryPolicy(policy *retry.Policy) {
+	s.retry = policy
+}
+
+// SetFilter sets which objects are listed and scanned, matched against keys below the start prefix
+func (s *S3Source) SetFilter(f *filter.Filter) {
+	s.filter = f
+}
+
+// ListFiles lists files in the S3 bucket. If ctx is cancelled, the objects listed so
+// far are displayed.
+func (s *S3Source) ListFiles(ctx context.Context, startPath string) error {
 	s.log.Info("Starting S3 scan from path: %s", startPath)
 
 	// Ensure startPath doesn't start with /
@@ -61,11 +85,25 @@ func (s *S3Source) ListFiles(startPath string) error {
 	})
 
 	// Process each page of results
-	for paginator.HasMorePages() {
-		page, err := paginator.NextPage(context.TODO())
+	for pages := 0; paginator.HasMorePages(); pages++ {
+		var page *s3.ListObjectsV2Output
+		err := s.retry.Do(ctx, "Listing objects", func() error {
+			var err error
+			page, err = paginator.NextPage(ctx)
+			return err
+		})
 		if err != nil {
-			s.log.Error("Failed to list objects: %v", err)
-			return fmt.Errorf("failed to list objects: %v", err)
+			if ctx.Err() != nil {
+				break
+			}
+			if pages == 0 {
+				s.log.Error("Failed to list objects: %v", err)
+				return fmt.Errorf("failed to list objects: %v", err)
+			}
+			// Display the objects listed before the listing failed
+			s.errors.Add(startPath+"*", "list remaining objects", err)
+			addNote(root, fmt.Sprintf("listing incomplete: %s", scanerr.Classify(err)))
+			break
 		}
 
 		// Process each object
@@ -78,6 +116,9 @@ func (s *S3Source) ListFiles(startPath string) error {
 			// Get relative path from startPath
 			relPath := strings.TrimPrefix(*obj.Key, startPath)
 			relPath = strings.TrimPrefix(relPath, "/")
+			if !s.filter.Match(relPath, strings.HasSuffix(*obj.Key, "/")) {
+				continue
+			}
 
 			// Split path into components
 			parts := strings.Split(relPath, "/")
@@ -124,9 +165,113 @@ func (s *S3Source) ListFiles(startPath string) error {
 
 	// Display the tree
 	displayTree(root, 0)
-	return nil
+	return ctx.Err()
+}
+
+
+// Walk calls fn for every object below the startPath prefix
+func (s *S3Source) Walk(ctx context.Context, startPath string, fn WalkFunc) error {
+	return s.WalkFrom(ctx, startPath, "", fn, nil)
 }
 
+// WalkFrom walks like Walk, continuing from a cursor. The cursor is the continuation
+// token of the next page of the listing, with a checkpoint after every page.
+func (s *S3Source) WalkFrom(ctx context.Context, startPath, cursor string, fn WalkFunc, checkpoint CheckpointFunc) error {
+	startPath = strings.TrimPrefix(startPath, "/")
+
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(startPath),
+	}
+	if cursor != "" {
+		input.ContinuationToken = aws.String(cursor)
+	}
+	for pages := 0; ; pages++ {
+		var page *s3.ListObjectsV2Output
+		err := s.retry.Do(ctx, "Listing objects", func() error {
+			var err error
+			page, err = s.client.ListObjectsV2(ctx, input)
+			return err
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if pages == 0 {
+				s.log.Error("Failed to list objects: %v", err)
+				return fmt.Errorf("failed to list objects: %v", err)
+			}
+			// The listing cannot continue past a failed page, so the objects walked
+			// so far are kept and the rest of the prefix is reported as not covered
+			s.errors.AddUnlisted(startPath+"*", "", "list remaining objects", err)
+			return nil
+		}
+
+		for _, obj := range page.Contents {
+			// Skip folder placeholder objects
+			if strings.HasSuffix(*obj.Key, "/") {
+				continue
+			}
+
+			relPath := strings.TrimPrefix(strings.TrimPrefix(*obj.Key, startPath), "/")
+			if !s.filter.Match(relPath, false) {
+				continue
+			}
+
+			file := FileInfo{
+				Path:    *obj.Key,
+				RelPath: relPath,
+				Size:    aws.ToInt64(obj.Size),
+				ETag:    strings.Trim(aws.ToString(obj.ETag), `"`),
+			}
+			if obj.LastModified != nil {
+				file.ModTime = *obj.LastModified
+			}
+			// Multipart ETags ("<md5>-<parts>") are not the MD5 of the content
+			if len(file.ETag) == 32 && !strings.Contains(file.ETag, "-") {
+				file.MD5 = file.ETag
+			}
+			if err := fn(file); err != nil {
+				return err
+			}
+		}
+
+		if !aws.ToBool(page.IsTruncated) || page.NextContinuationToken == nil {
+			return nil
+		}
+		input.ContinuationToken = page.NextContinuationToken
+		if checkpoint != nil {
+			if err := checkpoint(*page.NextContinuationToken); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// ReadFile downloads an object
+func (s *S3Source) ReadFile(ctx context.Context, key string) (io.ReadCloser, error) {
+	var out *s3.GetObjectOutput
+	err := s.retry.Do(ctx, "Downloading "+key, func() error {
+		var err error
+		out, err = s.client.GetObject(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(s.bucket),
+			Key:    aws.String(key),
+		})
+		return err
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("failed to download %s: %w", key, err)
+	}
+	return out.Body, nil
+}
+
+// Errors returns the objects that could not be listed or read
+func (s *S3Source) Errors() *scanerr.Log {
+	return s.errors
+}
 
 // GetName returns the source name
 func (s *S3Source) GetName() string {
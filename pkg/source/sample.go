@@ -0,0 +1,265 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/adaptive-scale/superscan/pkg/computation"
+	"github.com/adaptive-scale/superscan/pkg/config"
+	"github.com/adaptive-scale/superscan/pkg/detector"
+	"github.com/adaptive-scale/superscan/pkg/logger"
+	"github.com/adaptive-scale/superscan/pkg/scanerr"
+)
+
+// anyFinding labels the prevalence of files with at least one finding of any rule
+const anyFinding = "any finding"
+
+// SampleOptions controls a sampling scan
+type SampleOptions struct {
+	// Seed makes the choice of files reproducible; 0 picks a new seed
+	Seed int64
+	// PrefixDepth is how many directory levels below the start path define a stratum
+	PrefixDepth int
+	// Margin and Confidence set the sample size of each prefix
+	Margin     float64
+	Confidence float64
+	// MaxPerPrefix caps how many files are scanned from one prefix, 0 for no cap
+	MaxPerPrefix int
+}
+
+// DefaultSampleOptions returns the default sampling options: one directory level,
+// a 5% margin of error at 95% confidence per prefix
+func DefaultSampleOptions() SampleOptions {
+	return SampleOptions{
+		PrefixDepth: 1,
+		Margin:      0.05,
+		Confidence:  0.95,
+	}
+}
+
+// SampleOptionsFromConfig returns the default sampling options with any configured overrides
+func SampleOptionsFromConfig(cfg *config.Config) SampleOptions {
+	opts := DefaultSampleOptions()
+	if cfg == nil {
+		return opts
+	}
+
+	opts.Seed = cfg.Sampling.Seed
+	if cfg.Sampling.PrefixDepth > 0 {
+		opts.PrefixDepth = cfg.Sampling.PrefixDepth
+	}
+	if cfg.Sampling.Margin > 0 && cfg.Sampling.Margin < 1 {
+		opts.Margin = cfg.Sampling.Margin
+	}
+	if cfg.Sampling.Confidence > 0 && cfg.Sampling.Confidence < 1 {
+		opts.Confidence = cfg.Sampling.Confidence
+	}
+	if cfg.Sampling.MaxPerPrefix > 0 {
+		opts.MaxPerPrefix = cfg.Sampling.MaxPerPrefix
+	}
+	return opts
+}
+
+// prefixResult is the outcome of scanning the sample of one prefix
+type prefixResult struct {
+	prefix  string
+	files   int64
+	scanned int
+	// hits counts sampled files with at least one finding, per rule
+	hits map[string]int
+}
+
+// SampleScan lists every file of a source but scans only a random sample from each
+// prefix, then estimates how common each finding type is across the whole source. If
+// ctx is cancelled, the prefixes listed so far are reported, with estimates made from
+// the files scanned so far.
+func SampleScan(ctx context.Context, src Source, startPath string, opts SampleOptions) error {
+	log := logger.New(logger.INFO)
+
+	walker, ok := src.(Walker)
+	if !ok {
+		return fmt.Errorf("source %s does not support sampling", src.GetName())
+	}
+	reader, ok := src.(ContentReader)
+	if !ok {
+		return fmt.Errorf("source %s does not support sampling", src.GetName())
+	}
+
+	if opts.Seed == 0 {
+		opts.Seed = time.Now().UnixNano()
+	}
+	sampler := computation.NewSampler(opts.Seed)
+	engine := detector.NewEngine()
+	engine.SetSeed(opts.Seed)
+
+	// Keep enough files per prefix for the largest possible population
+	reservoirSize := computation.SampleSize(math.MaxInt64, opts.Margin, opts.Confidence)
+	if opts.MaxPerPrefix > 0 && opts.MaxPerPrefix < reservoirSize {
+		reservoirSize = opts.MaxPerPrefix
+	}
+
+	// List every file, keeping a reservoir sample per prefix
+	log.Info("Listing files for sampling from path: %s (seed %d)", startPath, opts.Seed)
+	byPrefix := computation.ByPrefix(opts.PrefixDepth)
+	strata := computation.NewStratifiedSampler(sampler, reservoirSize, func(f FileInfo) string {
+		return byPrefix(computation.File{Name: f.RelPath, Size: f.Size})
+	})
+	var listed int64
+	if err := walker.Walk(ctx, startPath, func(f FileInfo) error {
+		listed++
+		strata.Add(f)
+		return nil
+	}); err != nil {
+		if ctx.Err() == nil {
+			return err
+		}
+		log.Info("Listing stopped after %d files, reporting the prefixes listed so far", listed)
+	}
+
+	// Scan the sample of each prefix. Prefixes not scanned before ctx was cancelled are
+	// reported with their file counts but left out of the estimates.
+	var findings []detector.Finding
+	var results []prefixResult
+	for _, stratum := range strata.Strata() {
+		result := prefixResult{
+			prefix: stratum.Key,
+			files:  stratum.Seen,
+			hits:   make(map[string]int),
+		}
+		if ctx.Err() != nil {
+			results = append(results, result)
+			continue
+		}
+		n := computation.SampleSize(stratum.Seen, opts.Margin, opts.Confidence)
+		if n > len(stratum.Sample) {
+			n = len(stratum.Sample)
+		}
+		sample := computation.SelectRandomWith(sampler.Derive(stratum.Key), stratum.Sample, n)
+
+		for _, f := range sample {
+			fileFindings, err := scanFile(ctx, engine, reader, src.Errors(), f)
+			if err != nil {
+				if ctx.Err() != nil {
+					break
+				}
+				continue
+			}
+			result.scanned++
+			countRules(result.hits, fileFindings)
+			findings = append(findings, fileFindings...)
+		}
+		results = append(results, result)
+	}
+
+	displaySampleReport(results, listed, opts)
+	if len(findings) > 0 {
+		displayFindings(findings)
+	}
+	return ctx.Err()
+}
+
+// scanFile reads a file from a source and scans it. Files that cannot be read are
+// recorded in errs and return an error; files that can only be decoded in part are
+// recorded too, but return the findings of the rest.
+func scanFile(ctx context.Context, engine *detector.Engine, reader ContentReader, errs *scanerr.Log, f FileInfo) ([]detector.Finding, error) {
+	rc, err := reader.ReadFile(ctx, f.Path)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		errs.Add(f.RelPath, "read file", err)
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	defer rc.Close()
+
+	findings, err := engine.Scan(f.RelPath, rc)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		errs.Add(f.RelPath, "scan file", err)
+		if scanerr.Classify(err) != scanerr.DecodeFailure {
+			return nil, err
+		}
+	}
+	return findings, nil
+}
+
+// countRules adds the findings of one file to per-rule hit counts, counting each
+// rule once per file, and anyFinding if there was any
+func countRules(hits map[string]int, findings []detector.Finding) {
+	rules := make(map[string]bool)
+	for _, finding := range findings {
+		rules[finding.Rule] = true
+	}
+	for rule := range rules {
+		hits[rule]++
+	}
+	if len(rules) > 0 {
+		hits[anyFinding]++
+	}
+}
+
+// displaySampleReport prints per-prefix coverage and the estimated prevalence of each finding type
+func displaySampleReport(results []prefixResult, listed int64, opts SampleOptions) {
+	scanned := 0
+	ruleSet := make(map[string]bool)
+	for _, r := range results {
+		scanned += r.scanned
+		for rule := range r.hits {
+			ruleSet[rule] = true
+		}
+	}
+
+	fmt.Printf("\n📊 Sample scan (seed %d)\n", opts.Seed)
+	fmt.Printf("  Files listed:  %d in %d prefix(es)\n", listed, len(results))
+	fmt.Printf("  Files scanned: %d (±%.1f%% at %.0f%% confidence per prefix)\n", scanned, opts.Margin*100, opts.Confidence*100)
+
+	// Per-prefix coverage
+	fmt.Printf("\n  %-40s %12s %10s %10s\n", "Prefix", "Files", "Scanned", "With hits")
+	for _, r := range results {
+		fmt.Printf("  %-40s %12d %10d %10d\n", displayPrefix(r.prefix), r.files, r.scanned, r.hits[anyFinding])
+	}
+
+	// Estimated prevalence per rule, with files with any finding last
+	rules := make([]string, 0, len(ruleSet))
+	for rule := range ruleSet {
+		if rule != anyFinding {
+			rules = append(rules, rule)
+		}
+	}
+	sort.Strings(rules)
+	rules = append(rules, anyFinding)
+
+	fmt.Printf("\n  Estimated share of files with findings (%.0f%% confidence interval):\n", opts.Confidence*100)
+	for _, rule := range rules {
+		counts := make([]computation.StratumCount, 0, len(results))
+		hits := 0
+		for _, r := range results {
+			counts = append(counts, computation.StratumCount{
+				Population: r.files,
+				Sampled:    r.scanned,
+				Hits:       r.hits[rule],
+			})
+			hits += r.hits[rule]
+		}
+		est := computation.EstimatePrevalence(counts, opts.Confidence)
+		fmt.Printf("  %-24s %7.3f%% (%.3f%%–%.3f%%)  ≈ %d files (%d–%d)  [%d of %d sampled]\n",
+			rule, est.Proportion*100, est.Low*100, est.High*100,
+			int64(math.Round(est.Proportion*float64(listed))),
+			int64(math.Floor(est.Low*float64(listed))),
+			int64(math.Ceil(est.High*float64(listed))),
+			hits, scanned)
+	}
+}
+
+// displayPrefix names the stratum of files directly below the start path
+func displayPrefix(prefix string) string {
+	if prefix == "." {
+		return "(top level)"
+	}
+	return prefix + "/"
+}
@@ -0,0 +1,151 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/adaptive-scale/superscan/pkg/detector"
+	"github.com/adaptive-scale/superscan/pkg/logger"
+	"github.com/adaptive-scale/superscan/pkg/scanerr"
+	"github.com/adaptive-scale/superscan/pkg/state"
+)
+
+// DefaultCheckpointInterval is the default minimum time between two checkpoints
+const DefaultCheckpointInterval = 30 * time.Second
+
+// ScanOptions control a full, resumable scan
+type ScanOptions struct {
+	// Dir is the directory checkpoints are saved to
+	Dir string
+	// Interval is the minimum time between two checkpoints
+	Interval time.Duration
+}
+
+// FullScan scans the content of every file of a source, continuing from cp if it
+// holds the progress of an earlier run. Progress is saved to cp periodically, when ctx
+// is cancelled and when the scan fails, so it can be resumed with the same checkpoint.
+// Paths that could not be scanned, in this run or an earlier one, are kept in cp.Errors.
+// Tabular data is sampled with cp.Seed, which is picked and saved if it is not set.
+func FullScan(ctx context.Context, src Source, cp *state.Checkpoint, opts ScanOptions) error {
+	log := logger.New(logger.INFO)
+
+	walker, ok := src.(Walker)
+	if !ok {
+		return fmt.Errorf("source %s does not support scanning", src.GetName())
+	}
+	reader, ok := src.(ContentReader)
+	if !ok {
+		return fmt.Errorf("source %s does not support scanning", src.GetName())
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultCheckpointInterval
+	}
+
+	// Errors of earlier runs, followed by those of this run
+	errs := src.Errors()
+	resumed := cp.Errors
+	pathErrors := func() []scanerr.PathError {
+		return append(resumed[:len(resumed):len(resumed)], errs.Errors()...)
+	}
+
+	// Files scanned since the last checkpoint are rescanned on resume, so their
+	// findings are only added to the checkpoint along with the cursor past them
+	var pending []detector.Finding
+	var pendingScanned, pendingFailed int
+	lastSave := time.Now()
+	checkpoint := func(cursor string) error {
+		cp.Cursor = cursor
+		cp.Errors = pathErrors()
+		cp.Findings = append(cp.Findings, pending...)
+		cp.Scanned += pendingScanned
+		cp.Failed += pendingFailed
+		pending, pendingScanned, pendingFailed = nil, 0, 0
+		if time.Since(lastSave) < opts.Interval {
+			return nil
+		}
+		lastSave = time.Now()
+		log.Info("Checkpoint of scan %s: %d files scanned", cp.ID, cp.Scanned)
+		return cp.Save(opts.Dir)
+	}
+
+	if cp.Seed == 0 {
+		cp.Seed = time.Now().UnixNano()
+	}
+	log.Info("Sampling tabular data of scan %s with seed %d", cp.ID, cp.Seed)
+	engine := detector.NewEngine()
+	engine.SetSeed(cp.Seed)
+	scan := func(f FileInfo) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		fileFindings, err := scanFile(ctx, engine, reader, errs, f)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			pendingFailed++
+			return nil
+		}
+		pendingScanned++
+		pending = append(pending, fileFindings...)
+		return nil
+	}
+
+	var err error
+	if resumable, ok := src.(ResumableWalker); ok {
+		err = resumable.WalkFrom(ctx, cp.StartPath, cp.Cursor, scan, checkpoint)
+	} else {
+		if cp.Cursor != "" {
+			return fmt.Errorf("source %s does not support resuming", src.GetName())
+		}
+		log.Info("Source %s cannot be resumed; an interrupted scan will start over", src.GetName())
+		err = walker.Walk(ctx, cp.StartPath, scan)
+	}
+
+	if err != nil {
+		if saveErr := cp.Save(opts.Dir); saveErr != nil {
+			log.Error("Failed to save checkpoint of scan %s: %v", cp.ID, saveErr)
+		}
+		if ctx.Err() != nil {
+			// Partial results include files scanned after the last checkpoint
+			displayScanReport(cp, cp.Scanned+pendingScanned, cp.Failed+pendingFailed, append(cp.Findings, pending...), pathErrors())
+			reason := "interrupted"
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				reason = "timed out"
+			}
+			fmt.Printf("\n⏸  Scan %s. Resume it with: superscan scan --resume %s\n", reason, cp.ID)
+			return ctx.Err()
+		}
+		fmt.Printf("\nResume scan with: superscan scan --resume %s\n", cp.ID)
+		return err
+	}
+
+	cp.Cursor = ""
+	cp.Errors = pathErrors()
+	cp.Findings = append(cp.Findings, pending...)
+	cp.Scanned += pendingScanned
+	cp.Failed += pendingFailed
+	cp.Done = true
+	if err := cp.Save(opts.Dir); err != nil {
+		return err
+	}
+	displayScanReport(cp, cp.Scanned, cp.Failed, cp.Findings, cp.Errors)
+	return nil
+}
+
+// displayScanReport prints the progress, findings and errors of a scan
+func displayScanReport(cp *state.Checkpoint, scanned, failed int, findings []detector.Finding, errs []scanerr.PathError) {
+	fmt.Printf("\n🧭 Scan %s of %s:%s\n", cp.ID, cp.SourceType, cp.StartPath)
+	fmt.Printf("  Scanned: %d files\n", scanned)
+	if failed > 0 {
+		fmt.Printf("  Failed:  %d files\n", failed)
+	}
+	fmt.Printf("  Elapsed: %s since %s\n", time.Since(cp.StartedAt).Round(time.Second), cp.StartedAt.Format(time.RFC3339))
+	if len(findings) > 0 {
+		displayFindings(findings)
+	}
+	scanerr.Display(errs)
+}
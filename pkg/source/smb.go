@@ -0,0 +1,406 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adaptive-scale/superscan/pkg/config"
+	"github.com/adaptive-scale/superscan/pkg/filter"
+	"github.com/adaptive-scale/superscan/pkg/logger"
+	"github.com/adaptive-scale/superscan/pkg/scanerr"
+	"github.com/cloudsoda/go-smb2"
+)
+
+// smbSecurityInfo requests the owner, group and DACL of each entry; the SACL needs extra privileges
+const smbSecurityInfo = smb2.OwnerSecurityInformation | smb2.GroupSecurityInformation | smb2.DACLSecurityInformation
+
+// smbCloseTimeout bounds unmounting shares and logging off, so an unreachable host
+// does not stop the command from exiting
+const smbCloseTimeout = 10 * time.Second
+
+// SMBSource implements Source interface for SMB2/3 (CIFS) network shares
+type SMBSource struct {
+	session *smb2.Session
+	host    string
+	share   string
+	shares  map[string]*smb2.Share
+	filter  *filter.Filter
+	errors  *scanerr.Log
+	log     *logger.Logger
+}
+
+// NewSMBSource creates a new SMB source and authenticates to the host using NTLM
+func NewSMBSource(ctx context.Context, cfg config.SMBConfig) (*SMBSource, error) {
+	log := logger.New(logger.INFO)
+	log.Info("Initializing SMB source for host: %s", cfg.Host)
+
+	port := cfg.Port
+	if port == 0 {
+		port = 445
+	}
+	address := net.JoinHostPort(cfg.Host, strconv.Itoa(port))
+
+	// Connect and authenticate
+	dialer := &smb2.Dialer{
+		Initiator: &smb2.NTLMInitiator{
+			User:     cfg.Username,
+			Password: cfg.Password,
+			Domain:   cfg.Domain,
+		},
+	}
+	session, err := dialer.Dial(ctx, address)
+	if err != nil {
+		log.Error("Failed to connect to SMB host %s: %v", address, err)
+		return nil, fmt.Errorf("failed to connect to SMB host %s: %v", address, err)
+	}
+
+	return &SMBSource{
+		session: session,
+		host:    cfg.Host,
+		share:   cfg.Share,
+		shares:  make(map[string]*smb2.Share),
+		filter:  filter.New(filter.Options{}),
+		errors:  scanerr.NewLog(),
+		log:     log,
+	}, nil
+}
+
+// SetFilter sets which files and directories are listed and scanned. Paths are relative
+// to the start path, and begin with the share name when every share is walked.
+func (s *SMBSource) SetFilter(f *filter.Filter) {
+	s.filter = f
+}
+
+// ListFiles lists files on the SMB host. The first component of startPath names the
+// share unless a share is configured; an empty path walks every non-administrative share.
+// If ctx is cancelled, the files listed so far are displayed.
+func (s *SMBSource) ListFiles(ctx context.Context, startPath string) error {
+	s.log.Info("Starting SMB scan from path: %s", startPath)
+
+	shareName, dirPath := s.splitPath(startPath)
+
+	// Create root node
+	root := &FileNode{
+		Name:     s.host,
+		IsDir:    true,
+		Children: make([]*FileNode, 0),
+	}
+
+	// Enumerate shares when none was given
+	var shareNames []string
+	if shareName == "" {
+		names, err := s.session.WithContext(ctx).ListSharenames()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			s.log.Error("Failed to enumerate shares: %v", err)
+			return fmt.Errorf("failed to enumerate shares: %v", err)
+		}
+		for _, name := range names {
+			// Skip IPC$, ADMIN$, C$ and other administrative shares
+			if strings.HasSuffix(name, "$") {
+				s.log.Debug("Skipping administrative share: %s", name)
+				continue
+			}
+			shareNames = append(shareNames, name)
+		}
+	} else {
+		shareNames = []string{shareName}
+	}
+
+	// Walk each share
+	for _, name := range shareNames {
+		if ctx.Err() != nil {
+			break
+		}
+		shareNode := &FileNode{
+			Name:     name,
+			IsDir:    true,
+			Children: make([]*FileNode, 0),
+		}
+		root.Children = append(root.Children, shareNode)
+
+		// Paths below the host include the share name, as in Walk
+		prefix := ""
+		if shareName == "" {
+			prefix = name
+		}
+		if err := s.walkShare(ctx, name, dirPath, prefix, shareNode); err != nil {
+			// Failing on an explicitly requested share aborts the scan
+			if shareName != "" {
+				return err
+			}
+			s.errors.Add(name+`\`, "walk share", err)
+			addNote(shareNode, fmt.Sprintf("not listed: %s", scanerr.Classify(err)))
+		}
+	}
+
+	// Display the tree
+	displayTree(root, 0)
+	return ctx.Err()
+}
+
+// walkShare walks a directory of a share iteratively, attaching entries to parent.
+// Entries are filtered by their path below dirPath, joined to prefix. It stops without
+// error when ctx is cancelled.
+func (s *SMBSource) walkShare(ctx context.Context, shareName, dirPath, prefix string, parent *FileNode) error {
+	share, err := s.mount(ctx, shareName)
+	if err != nil {
+		return err
+	}
+
+	// Create a stack for iterative traversal
+	stack := []struct {
+		path   string
+		parent *FileNode
+	}{
+		{dirPath, parent},
+	}
+
+	for len(stack) > 0 && ctx.Err() == nil {
+		// Pop from stack
+		current := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		// Read directory along with each entry's security descriptor
+		entries, err := share.ReadDirPlus(current.path, smbSecurityInfo)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if current.path == dirPath && current.parent == parent {
+				return fmt.Errorf("failed to read directory %s: %w", current.path, err)
+			}
+			s.errors.Add(shareName+`\`+current.path, "read directory", err)
+			addNote(current.parent, fmt.Sprintf("not listed: %s", scanerr.Classify(err)))
+			continue
+		}
+
+		for _, entry := range entries {
+			entryPath := path.Join(current.path, entry.Name())
+			relPath := path.Join(prefix, strings.TrimPrefix(strings.TrimPrefix(entryPath, dirPath), "/"))
+			if !s.filter.Match(relPath, entry.IsDir()) {
+				continue
+			}
+
+			node := &FileNode{
+				Name:    entry.Name(),
+				IsDir:   entry.IsDir(),
+				Size:    entry.Size(),
+				ModTime: entry.ModTime(),
+			}
+			if entry.Err != nil {
+				s.log.Debug("No security descriptor for %s: %v", entry.Name(), entry.Err)
+			} else if entry.SecurityDescriptor != nil {
+				node.SecurityDescriptor = entry.SecurityDescriptor.String()
+			}
+
+			// Add to parent's children
+			current.parent.Children = append(current.parent.Children, node)
+
+			// If directory, add to stack
+			if entry.IsDir() {
+				node.Children = make([]*FileNode, 0)
+				stack = append(stack, struct {
+					path   string
+					parent *FileNode
+				}{entryPath, node})
+			}
+		}
+	}
+
+	return nil
+}
+
+// Walk calls fn for every file below startPath, on every non-administrative share if none is given
+func (s *SMBSource) Walk(ctx context.Context, startPath string, fn WalkFunc) error {
+	shareName, dirPath := s.splitPath(startPath)
+
+	shareNames := []string{shareName}
+	if shareName == "" {
+		names, err := s.session.WithContext(ctx).ListSharenames()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			s.log.Error("Failed to enumerate shares: %v", err)
+			return fmt.Errorf("failed to enumerate shares: %v", err)
+		}
+		shareNames = shareNames[:0]
+		for _, name := range names {
+			if !strings.HasSuffix(name, "$") {
+				shareNames = append(shareNames, name)
+			}
+		}
+	}
+
+	for _, name := range shareNames {
+		share, err := s.mount(ctx, name)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if shareName != "" {
+				return err
+			}
+			s.errors.AddUnlisted(name+`\`, name, "mount share", err)
+			continue
+		}
+
+		stack := []string{dirPath}
+		for len(stack) > 0 {
+			// Pop from stack
+			current := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+
+			entries, err := share.ReadDir(current)
+			if err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				if current == dirPath && shareName != "" {
+					return fmt.Errorf("failed to read directory %s: %w", current, err)
+				}
+				relPath := strings.TrimPrefix(strings.TrimPrefix(current, dirPath), "/")
+				if shareName == "" {
+					relPath = path.Join(name, relPath)
+				}
+				s.errors.AddUnlisted(name+`\`+current, relPath, "read directory", err)
+				continue
+			}
+
+			for _, entry := range entries {
+				entryPath := path.Join(current, entry.Name())
+				relPath := strings.TrimPrefix(strings.TrimPrefix(entryPath, dirPath), "/")
+				if shareName == "" {
+					relPath = path.Join(name, relPath)
+				}
+				if !s.filter.Match(relPath, entry.IsDir()) {
+					continue
+				}
+				if entry.IsDir() {
+					stack = append(stack, entryPath)
+					continue
+				}
+
+				// Paths include the share unless one is configured, matching ReadFile
+				filePath := entryPath
+				if s.share == "" {
+					filePath = path.Join(name, entryPath)
+				}
+				if err := fn(FileInfo{
+					Path:    filePath,
+					RelPath: relPath,
+					Size:    entry.Size(),
+					ModTime: entry.ModTime(),
+				}); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// ReadFile opens a file for reading; filePath is resolved the same way as ListFiles' startPath
+func (s *SMBSource) ReadFile(ctx context.Context, filePath string) (io.ReadCloser, error) {
+	shareName, name := s.splitPath(filePath)
+	if shareName == "" || name == "" {
+		return nil, fmt.Errorf("invalid SMB file path: %s", filePath)
+	}
+
+	share, err := s.mount(ctx, shareName)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := share.Open(name)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("failed to open %s: %w", filePath, err)
+	}
+	return f, nil
+}
+
+// SecurityDescriptor returns the NT security descriptor of a file in SDDL form
+func (s *SMBSource) SecurityDescriptor(ctx context.Context, filePath string) (string, error) {
+	shareName, name := s.splitPath(filePath)
+	if shareName == "" {
+		return "", fmt.Errorf("invalid SMB file path: %s", filePath)
+	}
+
+	share, err := s.mount(ctx, shareName)
+	if err != nil {
+		return "", err
+	}
+
+	sd, err := share.SecurityInfo(name, smbSecurityInfo)
+	if err != nil {
+		return "", fmt.Errorf("failed to read security descriptor of %s: %v", filePath, err)
+	}
+	return sd.String(), nil
+}
+
+// GetName returns the source name
+func (s *SMBSource) GetName() string {
+	return "smb"
+}
+
+// Errors returns the shares and directories that could not be listed and files that could not be read
+func (s *SMBSource) Errors() *scanerr.Log {
+	return s.errors
+}
+
+// Close unmounts all shares and logs off the session. It does not depend on the
+// context of the scan, so that interrupted scans log off too.
+func (s *SMBSource) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), smbCloseTimeout)
+	defer cancel()
+	for name, share := range s.shares {
+		if err := share.WithContext(ctx).Umount(); err != nil {
+			s.log.Error("Failed to unmount share %s: %v", name, err)
+		}
+		delete(s.shares, name)
+	}
+	if err := s.session.WithContext(ctx).Logoff(); err != nil {
+		return fmt.Errorf("failed to log off from %s: %v", s.host, err)
+	}
+	return nil
+}
+
+// mount returns the mounted share bound to ctx, mounting it on first use
+func (s *SMBSource) mount(ctx context.Context, shareName string) (*smb2.Share, error) {
+	if share, ok := s.shares[shareName]; ok {
+		return share.WithContext(ctx), nil
+	}
+
+	share, err := s.session.WithContext(ctx).Mount(shareName)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("failed to mount share %s: %w", shareName, err)
+	}
+	s.shares[shareName] = share
+	return share.WithContext(ctx), nil
+}
+
+// splitPath splits a path into share name and path within the share
+func (s *SMBSource) splitPath(p string) (string, string) {
+	p = strings.Trim(strings.ReplaceAll(p, `\`, "/"), "/")
+	if s.share != "" {
+		return s.share, p
+	}
+
+	shareName, rest, _ := strings.Cut(p, "/")
+	return shareName, rest
+}
@@ -1,11 +1,18 @@
 package source
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
+	"time"
 
+	"github.com/adaptive-scale/superscan/pkg/archive"
 	"github.com/adaptive-scale/superscan/pkg/config"
+	"github.com/adaptive-scale/superscan/pkg/filter"
 	"github.com/adaptive-scale/superscan/pkg/logger"
+	"github.com/adaptive-scale/superscan/pkg/retry"
+	"github.com/adaptive-scale/superscan/pkg/scanerr"
 )
 
 // SourceType represents the type of source to scan
@@ -20,18 +27,99 @@ const (
 	S3Bucket SourceType = "s3"
 	// GoogleStorage represents Google Cloud Storage source
 	GoogleStorage SourceType = "gcs"
+	// WebDAV represents a WebDAV (or Nextcloud) server source
+	WebDAV SourceType = "webdav"
+	// SMB represents an SMB/CIFS network share source
+	SMB SourceType = "smb"
+	// Git represents the full history of a git repository
+	Git SourceType = "git"
+	// ContainerImage represents a docker save tarball or OCI image layout
+	ContainerImage SourceType = "image"
 )
 
-// Source defines the interface for different storage backends
+// Source defines the interface for different storage backends. Cancelling the context
+// given to a method stops its traversal and any request in flight.
 type Source interface {
-	ListFiles(startPath string) error
+	ListFiles(ctx context.Context, startPath string) error
 	GetName() string
+	// Errors returns the paths that could not be listed, read or decoded. Scans add
+	// the files they fail to scan, so it describes what a run did not cover.
+	Errors() *scanerr.Log
+}
+
+// ContentReader is implemented by sources that can download file content for scanning
+type ContentReader interface {
+	ReadFile(ctx context.Context, path string) (io.ReadCloser, error)
+}
+
+// FileInfo describes a file found by a Walker
+type FileInfo struct {
+	// Path identifies the file within the source and can be passed to ReadFile
+	Path string
+	// RelPath is the slash separated path of the file below the start path
+	RelPath string
+	Size    int64
+	ModTime time.Time
+	ETag    string
+	// MD5 is the hex MD5 of the content when the provider reports it, e.g. S3 ETags of
+	// single part uploads or Drive md5Checksum, so content does not have to be downloaded
+	MD5 string
+}
+
+// WalkFunc is called for every file found by a Walker; returning an error stops the walk
+type WalkFunc func(file FileInfo) error
+
+// Walker is implemented by sources that can enumerate their files without printing a tree
+type Walker interface {
+	Walk(ctx context.Context, startPath string, fn WalkFunc) error
+}
+
+// CheckpointFunc is called during a resumable walk with a cursor from which the walk
+// can continue; every file before the cursor has already been passed to the WalkFunc
+type CheckpointFunc func(cursor string) error
+
+// ResumableWalker is implemented by sources whose walks can continue after an interruption
+type ResumableWalker interface {
+	Walker
+	// WalkFrom walks like Walk, starting at a cursor given to checkpoint by an earlier
+	// walk of the same start path, or at the beginning if cursor is empty
+	WalkFrom(ctx context.Context, startPath, cursor string, fn WalkFunc, checkpoint CheckpointFunc) error
+}
+
+// Change is a file added, modified or removed since a change feed token was issued
+type Change struct {
+	// File is the file as it is now; only its Path is set if it was removed
+	File FileInfo
+	// Removed is set for files and folders deleted, trashed or moved out of the start path
+	Removed bool
+	// Folder is set if File is a folder. Folders are listed so that the files below
+	// them can be forgotten when they are removed, as feeds may not list those files.
+	Folder bool
+}
+
+// ChangeFunc is called for every change listed by a ChangeFeed; returning an error stops the listing
+type ChangeFunc func(change Change) error
+
+// ChangeFeed is implemented by sources that can list the files changed since an
+// earlier run without walking every file
+type ChangeFeed interface {
+	// FeedID identifies the feed covering startPath, e.g. an account and shared drive;
+	// a token issued by one feed cannot be used with another
+	FeedID(ctx context.Context, startPath string) (string, error)
+	// StartToken returns a token from which changes made from now on are listed
+	StartToken(ctx context.Context, startPath string) (string, error)
+	// Snapshot calls fn for every file and folder below startPath, as the baseline of
+	// later changes
+	Snapshot(ctx context.Context, startPath string, fn ChangeFunc) error
+	// Changes calls fn for every file and folder below startPath changed since token,
+	// and returns the token from which to list the next changes
+	Changes(ctx context.Context, startPath, token string, fn ChangeFunc) (string, error)
 }
 
 // Set validates and sets the source type
 func (st *SourceType) Set(value string) error {
 	switch SourceType(value) {
-	case GoogleDrive, FileSystem, S3Bucket, GoogleStorage:
+	case GoogleDrive, FileSystem, S3Bucket, GoogleStorage, WebDAV, SMB, Git, ContainerImage:
 		*st = SourceType(value)
 		return nil
 	default:
@@ -44,23 +132,160 @@ func (st SourceType) String() string {
 	return string(st)
 }
 
-// NewSource creates a new source based on the source type
-func NewSource(sourceType string, cfg *config.Config) (Source, error) {
+// NewSource creates a new source based on the source type. ctx bounds any connection
+// made while creating it.
+func NewSource(ctx context.Context, sourceType string, cfg *config.Config) (Source, error) {
 	log := logger.New(logger.INFO)
 	log.Info("Creating new source of type: %s", sourceType)
 
 	switch sourceType {
 	case "google-drive":
-		return NewGoogleDriveSource(), nil
+		gds := NewGoogleDriveSource()
+		gds.SetRetryPolicy(retryPolicy(cfg, sourceType))
+		gds.SetFilter(pathFilter(cfg))
+		return gds, nil
 	case "filesystem":
-		return NewFileSystemSource(), nil
+		fs := NewFileSystemSource()
+		fs.SetArchiveLimits(archiveLimits(cfg))
+		fs.SetFilter(pathFilter(cfg))
+		fs.SetTraversal(traversal(cfg))
+		return fs, nil
 	case "s3":
 		bucket := os.Getenv("AWS_S3_BUCKET")
 		if bucket == "" {
 			return nil, fmt.Errorf("AWS_S3_BUCKET environment variable is required for S3 source")
 		}
-		return NewS3Source(bucket)
+		s3src, err := NewS3Source(ctx, bucket)
+		if err != nil {
+			return nil, err
+		}
+		s3src.SetRetryPolicy(retryPolicy(cfg, sourceType))
+		s3src.SetFilter(pathFilter(cfg))
+		return s3src, nil
+	case "webdav":
+		if cfg == nil {
+			cfg = &config.Config{}
+			config.ApplyEnv(cfg)
+		}
+		if cfg.WebDAV.URL == "" {
+			return nil, fmt.Errorf("SUPERSCAN_WEBDAV_URL environment variable or webdav.url config is required for WebDAV source")
+		}
+		w, err := NewWebDAVSource(cfg.WebDAV)
+		if err != nil {
+			return nil, err
+		}
+		w.SetRetryPolicy(retryPolicy(cfg, sourceType))
+		w.SetFilter(pathFilter(cfg))
+		return w, nil
+	case "smb":
+		if cfg == nil {
+			cfg = &config.Config{}
+			config.ApplyEnv(cfg)
+		}
+		if cfg.SMB.Host == "" {
+			return nil, fmt.Errorf("SUPERSCAN_SMB_HOST environment variable or smb.host config is required for SMB source")
+		}
+		smb, err := NewSMBSource(ctx, cfg.SMB)
+		if err != nil {
+			return nil, err
+		}
+		smb.SetFilter(pathFilter(cfg))
+		return smb, nil
+	case "git":
+		g := NewGitSource()
+		g.SetSeed(samplingSeed(cfg))
+		g.SetFilter(pathFilter(cfg))
+		return g, nil
+	case "image":
+		is := NewImageSource()
+		is.SetSeed(samplingSeed(cfg))
+		is.SetFilter(pathFilter(cfg))
+		return is, nil
 	default:
 		return nil, fmt.Errorf("unsupported source type: %s", sourceType)
 	}
-}
\ No newline at end of file
+}
+
+// archiveLimits returns the archive expansion limits, applying any configured overrides
+func archiveLimits(cfg *config.Config) archive.Limits {
+	limits := archive.DefaultLimits()
+	if cfg == nil {
+		return limits
+	}
+
+	if cfg.Archives.Disabled {
+		limits.MaxDepth = 0
+	} else if cfg.Archives.MaxDepth > 0 {
+		limits.MaxDepth = cfg.Archives.MaxDepth
+	}
+	if cfg.Archives.MaxRatio > 0 {
+		limits.MaxRatio = cfg.Archives.MaxRatio
+	}
+	if cfg.Archives.MaxTotalSize > 0 {
+		limits.MaxTotalSize = cfg.Archives.MaxTotalSize
+	}
+	return limits
+}
+
+// retryPolicy returns the retry policy of a cloud source, applying any configured
+// overrides and the source's rate limit
+func retryPolicy(cfg *config.Config, sourceType string) *retry.Policy {
+	policy := retry.DefaultPolicy()
+	if cfg == nil {
+		return policy
+	}
+
+	if cfg.Retry.MaxAttempts > 0 {
+		policy.MaxAttempts = cfg.Retry.MaxAttempts
+	}
+	if cfg.Retry.BaseDelay > 0 {
+		policy.BaseDelay = cfg.Retry.BaseDelay
+	}
+	if cfg.Retry.MaxDelay > 0 {
+		policy.MaxDelay = cfg.Retry.MaxDelay
+	}
+	switch sourceType {
+	case "google-drive":
+		policy.SetQPS(cfg.GoogleDrive.QPS)
+	case "s3":
+		policy.SetQPS(cfg.S3.QPS)
+	case "webdav":
+		policy.SetQPS(cfg.WebDAV.QPS)
+	}
+	return policy
+}
+
+// pathFilter returns the configured include and exclude filter, or one that passes
+// every file if none is configured
+func pathFilter(cfg *config.Config) *filter.Filter {
+	if cfg == nil {
+		return filter.New(filter.Options{})
+	}
+	return filter.New(filter.Options{
+		Include:   cfg.Filters.Include,
+		Exclude:   cfg.Filters.Exclude,
+		Hidden:    cfg.Filters.Hidden,
+		GitIgnore: cfg.Filters.GitIgnore,
+		MaxDepth:  cfg.Filters.MaxDepth,
+	})
+}
+
+// traversal returns how the local filesystem is traversed
+func traversal(cfg *config.Config) Traversal {
+	if cfg == nil {
+		return Traversal{}
+	}
+	return Traversal{
+		FollowSymlinks: cfg.FileSystem.FollowSymlinks,
+		OneFileSystem:  cfg.FileSystem.OneFileSystem,
+		AllFileSystems: cfg.FileSystem.AllFileSystems,
+	}
+}
+
+// samplingSeed returns the configured sampling seed, or 0 if none is set
+func samplingSeed(cfg *config.Config) int64 {
+	if cfg == nil {
+		return 0
+	}
+	return cfg.Sampling.Seed
+}
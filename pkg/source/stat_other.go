@@ -0,0 +1,22 @@
+//go:build !unix
+
+package source
+
+import (
+	"os"
+)
+
+// deviceID reports no device where files do not have one, so --one-file-system has no effect
+func deviceID(info os.FileInfo) (uint64, bool) {
+	return 0, false
+}
+
+// fileOwner reports no owner where files are not owned by user and group IDs
+func fileOwner(info os.FileInfo) (uid, gid uint32, ok bool) {
+	return 0, 0, false
+}
+
+// fileID reports no identity where files have no inode, so renamed files are scanned again
+func fileID(info os.FileInfo) (dev, ino uint64, ok bool) {
+	return 0, 0, false
+}
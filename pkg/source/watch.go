@@ -0,0 +1,353 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/adaptive-scale/superscan/pkg/detector"
+	"github.com/fsnotify/fsnotify"
+)
+
+// DefaultDebounce is how long a file must stay unchanged before a watch scans it
+const DefaultDebounce = 2 * time.Second
+
+// WatchOptions control a watch
+type WatchOptions struct {
+	// Debounce is how long a file must stay unchanged before it is scanned, so that a
+	// burst of writes is scanned once
+	Debounce time.Duration
+	// ScanExisting scans every file once before watching for changes
+	ScanExisting bool
+	// Seed makes the sampling of tabular data reproducible; 0 picks a new seed
+	Seed int64
+}
+
+// Watcher is implemented by sources that can scan files as they are created and modified
+type Watcher interface {
+	Watch(ctx context.Context, startPath string, opts WatchOptions) error
+}
+
+// fileStamp is the size and modification time of a file when it was scanned
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+// scanJob is a settled file handed to the scan worker
+type scanJob struct {
+	file  FileInfo
+	key   string
+	stamp fileStamp
+}
+
+// scanResult is what the scan worker found in one file
+type scanResult struct {
+	job      scanJob
+	findings []detector.Finding
+	err      error
+}
+
+// watch is the state of one watch. It is only used by the event loop; files are
+// scanned by a worker that reports back on a channel.
+type watch struct {
+	fs      *FileSystemSource
+	w       *fsWalk
+	watcher *fsnotify.Watcher
+	engine  *detector.Engine
+	// watched holds the directories with a watch
+	watched map[string]bool
+	// pending maps files that changed to when they last changed
+	pending map[string]time.Time
+	// queue holds the settled files waiting for the worker
+	queue []scanJob
+	// busy holds the files queued or being scanned, which are not queued again until
+	// their scan is done
+	busy map[string]bool
+	// seen maps files, by inode where possible, to how they were when last scanned or
+	// listed, so that renamed files are not scanned again
+	seen     map[string]fileStamp
+	scanned  int
+	findings int
+}
+
+// Watch scans the files below startPath as they are created and modified, printing
+// findings as soon as they are found, until ctx is cancelled. Directories created or
+// moved below startPath are watched as they appear, and files that were only renamed
+// are not scanned again.
+func (fs *FileSystemSource) Watch(ctx context.Context, startPath string, opts WatchOptions) error {
+	if opts.Debounce <= 0 {
+		opts.Debounce = DefaultDebounce
+	}
+	if opts.Seed == 0 {
+		opts.Seed = time.Now().UnixNano()
+	}
+	absPath, err := filepath.Abs(startPath)
+	if err != nil {
+		fs.log.Error("Failed to convert path to absolute: %v", err)
+		return fmt.Errorf("failed to convert path to absolute: %v", err)
+	}
+	if info, err := os.Stat(absPath); err != nil || !info.IsDir() {
+		fs.log.Error("Start path %s is not a directory", absPath)
+		return fmt.Errorf("start path %s is not a directory", absPath)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		fs.log.Error("Failed to create watcher: %v", err)
+		return fmt.Errorf("failed to create watcher: %v", err)
+	}
+	defer watcher.Close()
+
+	wt := &watch{
+		fs:      fs,
+		w:       fs.newWalk(absPath),
+		watcher: watcher,
+		engine:  detector.NewEngine(),
+		watched: make(map[string]bool),
+		pending: make(map[string]time.Time),
+		busy:    make(map[string]bool),
+		seen:    make(map[string]fileStamp),
+	}
+	wt.engine.SetSeed(opts.Seed)
+	wt.addTree(absPath, opts.ScanExisting)
+	start := time.Now()
+	fs.log.Info("Sampling tabular data with seed %d", opts.Seed)
+	fmt.Printf("👁  Watching %s (%d directories). Press Ctrl-C to stop.\n", absPath, len(wt.watched))
+
+	// Scanning a large file must not hold up the events, which the kernel drops once
+	// its queue is full
+	workerCtx, cancel := context.WithCancel(ctx)
+	jobs := make(chan scanJob)
+	results := make(chan scanResult)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		wt.work(workerCtx, jobs, results)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	ticker := time.NewTicker(opts.Debounce / 4)
+	defer ticker.Stop()
+	for {
+		// Jobs are only offered while there is one to hand over
+		var send chan scanJob
+		var next scanJob
+		if len(wt.queue) > 0 {
+			send, next = jobs, wt.queue[0]
+		}
+
+		select {
+		case <-ctx.Done():
+			fmt.Printf("\n👁  Watched %s for %s: %d files scanned, %d finding(s)\n",
+				absPath, time.Since(start).Round(time.Second), wt.scanned, wt.findings)
+			return ctx.Err()
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			wt.handle(event)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				// Events were lost, so look for changes by walking the whole tree
+				fs.log.Error("Watch events were lost, rescanning %s for changes", absPath)
+				wt.addTree(absPath, true)
+				continue
+			}
+			fs.log.Error("Failed to watch %s: %v", absPath, err)
+		case now := <-ticker.C:
+			wt.flush(now, opts.Debounce)
+		case send <- next:
+			wt.queue = wt.queue[1:]
+		case result := <-results:
+			wt.record(result)
+		}
+	}
+}
+
+// handle records a change of a file, watches new directories and forgets moved ones
+func (wt *watch) handle(event fsnotify.Event) {
+	switch {
+	case event.Has(fsnotify.Create):
+		entry, err := lstatEntry(event.Name)
+		if err != nil {
+			return
+		}
+		e, ok := wt.fs.visit(wt.w, event.Name, entry)
+		switch {
+		case !ok:
+		case e.descend:
+			// A new or moved in directory, possibly already holding files and directories
+			wt.addTree(event.Name, true)
+		case e.isDir:
+			wt.fs.log.Info("Not watching %s: %s", event.Name, e.note)
+		default:
+			wt.pending[event.Name] = time.Now()
+		}
+	case event.Has(fsnotify.Write):
+		wt.pending[event.Name] = time.Now()
+	case event.Has(fsnotify.Rename), event.Has(fsnotify.Remove):
+		// A moved directory is watched again under its new name when it is created there
+		wt.unwatch(event.Name)
+		delete(wt.pending, event.Name)
+	}
+}
+
+// addTree watches dir and the directories below it. If queue is set, their files are
+// scanned unless they were scanned before.
+func (wt *watch) addTree(dir string, queue bool) {
+	stack := []string{dir}
+	for len(stack) > 0 {
+		current := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if wt.watched[current] {
+			if !queue {
+				continue
+			}
+		} else if err := wt.watcher.Add(current); err != nil {
+			wt.fs.errors.Add(current, "watch directory", err)
+			continue
+		}
+		wt.watched[current] = true
+
+		entries, err := os.ReadDir(current)
+		if err != nil {
+			wt.fs.errors.Add(current, "read directory", err)
+			continue
+		}
+		for _, entry := range entries {
+			fullPath := filepath.Join(current, entry.Name())
+			e, ok := wt.fs.visit(wt.w, fullPath, entry)
+			if !ok {
+				continue
+			}
+			switch {
+			case e.descend:
+				stack = append(stack, fullPath)
+			case e.isDir:
+				wt.fs.log.Info("Not watching %s: %s", fullPath, e.note)
+			case e.regular && queue:
+				wt.pending[fullPath] = time.Time{}
+			case e.regular:
+				wt.seen[fileKey(fullPath, e.info)] = fileStamp{e.info.Size(), e.info.ModTime()}
+			}
+		}
+	}
+}
+
+// unwatch removes the watches of path and the directories below it
+func (wt *watch) unwatch(path string) {
+	prefix := path + string(filepath.Separator)
+	for dir := range wt.watched {
+		if dir == path || strings.HasPrefix(dir, prefix) {
+			// The kernel may have removed the watch already
+			_ = wt.watcher.Remove(dir)
+			delete(wt.watched, dir)
+		}
+	}
+}
+
+// flush queues the files that have not changed for the debounce interval. Files still
+// being scanned stay pending until their scan is done.
+func (wt *watch) flush(now time.Time, debounce time.Duration) {
+	for path, changed := range wt.pending {
+		if now.Sub(changed) < debounce || wt.busy[path] {
+			continue
+		}
+		delete(wt.pending, path)
+		wt.enqueue(path)
+	}
+}
+
+// enqueue queues one changed file for the worker, unless it is filtered out or
+// unchanged since it was last scanned
+func (wt *watch) enqueue(path string) {
+	entry, err := lstatEntry(path)
+	if err != nil {
+		// Deleted before it settled
+		return
+	}
+	e, ok := wt.fs.visit(wt.w, path, entry)
+	if !ok || !e.regular {
+		return
+	}
+	key := fileKey(path, e.info)
+	stamp := fileStamp{e.info.Size(), e.info.ModTime()}
+	if prev, ok := wt.seen[key]; ok && prev.size == stamp.size && prev.modTime.Equal(stamp.modTime) {
+		return
+	}
+
+	relPath, _ := filepath.Rel(wt.w.root, path)
+	wt.busy[path] = true
+	wt.queue = append(wt.queue, scanJob{
+		file: FileInfo{
+			Path:    path,
+			RelPath: filepath.ToSlash(relPath),
+			Size:    stamp.size,
+			ModTime: stamp.modTime,
+		},
+		key:   key,
+		stamp: stamp,
+	})
+}
+
+// work scans the files handed over on jobs until ctx is cancelled, reporting each
+// result on results
+func (wt *watch) work(ctx context.Context, jobs <-chan scanJob, results chan<- scanResult) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-jobs:
+			findings, err := scanFile(ctx, wt.engine, wt.fs, wt.fs.errors, job.file)
+			select {
+			case results <- scanResult{job: job, findings: findings, err: err}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// record prints the findings of a scanned file and remembers how it was when scanned
+func (wt *watch) record(result scanResult) {
+	delete(wt.busy, result.job.file.Path)
+	if result.err != nil {
+		return
+	}
+	wt.seen[result.job.key] = result.job.stamp
+	wt.scanned++
+	wt.findings += len(result.findings)
+	for _, f := range result.findings {
+		fmt.Printf("  🔑 [%s] %s\n", time.Now().Format("15:04:05"), f)
+	}
+}
+
+// fileKey identifies a file by device and inode where possible, so it keeps its key
+// when it or a parent directory is renamed, and by path otherwise
+func fileKey(path string, info os.FileInfo) string {
+	if dev, ino, ok := fileID(info); ok {
+		return fmt.Sprintf("%d:%d", dev, ino)
+	}
+	return path
+}
+
+// lstatEntry returns the directory entry of a path, as listed in its parent directory
+func lstatEntry(path string) (iofs.DirEntry, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+	return iofs.FileInfoToDirEntry(info), nil
+}
@@ -0,0 +1,394 @@
+package source
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adaptive-scale/superscan/pkg/config"
+	"github.com/adaptive-scale/superscan/pkg/filter"
+	"github.com/adaptive-scale/superscan/pkg/logger"
+	"github.com/adaptive-scale/superscan/pkg/retry"
+	"github.com/adaptive-scale/superscan/pkg/scanerr"
+)
+
+// propfindBody requests only the properties needed to build the tree
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:">
+  <d:prop>
+    <d:resourcetype/>
+    <d:getcontentlength/>
+    <d:getetag/>
+    <d:getlastmodified/>
+  </d:prop>
+</d:propfind>`
+
+// davMultistatus is the body of a 207 Multi-Status PROPFIND response
+type davMultistatus struct {
+	Responses []davResponse `xml:"DAV: response"`
+}
+
+// davResponse describes a single resource in a multistatus response
+type davResponse struct {
+	Href      string        `xml:"DAV: href"`
+	Propstats []davPropstat `xml:"DAV: propstat"`
+}
+
+// davPropstat groups properties sharing the same status
+type davPropstat struct {
+	Prop   davProp `xml:"DAV: prop"`
+	Status string  `xml:"DAV: status"`
+}
+
+// davProp holds the requested resource properties
+type davProp struct {
+	ResourceType struct {
+		Collection *struct{} `xml:"DAV: collection"`
+	} `xml:"DAV: resourcetype"`
+	ContentLength string `xml:"DAV: getcontentlength"`
+	ETag          string `xml:"DAV: getetag"`
+	LastModified  string `xml:"DAV: getlastmodified"`
+}
+
+// WebDAVSource implements Source interface for WebDAV servers such as Nextcloud
+type WebDAVSource struct {
+	client   *http.Client
+	baseURL  *url.URL
+	username string
+	password string
+	token    string
+	retry    *retry.Policy
+	filter   *filter.Filter
+	errors   *scanerr.Log
+	log      *logger.Logger
+}
+
+// NewWebDAVSource creates a new WebDAV source
+func NewWebDAVSource(cfg config.WebDAVConfig) (*WebDAVSource, error) {
+	log := logger.New(logger.INFO)
+	log.Info("Initializing WebDAV source for: %s", cfg.URL)
+
+	baseURL, err := url.Parse(cfg.URL)
+	if err != nil {
+		log.Error("Invalid WebDAV URL: %v", err)
+		return nil, fmt.Errorf("invalid WebDAV URL: %v", err)
+	}
+	if baseURL.Scheme != "http" && baseURL.Scheme != "https" {
+		return nil, fmt.Errorf("invalid WebDAV URL scheme: %s", baseURL.Scheme)
+	}
+	if !strings.HasSuffix(baseURL.Path, "/") {
+		baseURL.Path += "/"
+	}
+
+	return &WebDAVSource{
+		client:   &http.Client{Timeout: 60 * time.Second},
+		baseURL:  baseURL,
+		username: cfg.Username,
+		password: cfg.Password,
+		token:    cfg.Token,
+		retry:    retry.DefaultPolicy(),
+		filter:   filter.New(filter.Options{}),
+		errors:   scanerr.NewLog(),
+		log:      log,
+	}, nil
+}
+
+// SetRetryPolicy sets how throttled and failed requests to the server are retried
+func (w *WebDAVSource) SetRetryPolicy(policy *retry.Policy) {
+	w.retry = policy
+}
+
+// SetFilter sets which files and collections are listed and scanned
+func (w *WebDAVSource) SetFilter(f *filter.Filter) {
+	w.filter = f
+}
+
+// ListFiles lists files on the WebDAV server. If ctx is cancelled, the files listed so
+// far are displayed.
+func (w *WebDAVSource) ListFiles(ctx context.Context, startPath string) error {
+	w.log.Info("Starting WebDAV scan from path: %s", startPath)
+
+	startPath = strings.Trim(startPath, "/")
+
+	// Create root node
+	rootName := path.Base(startPath)
+	if startPath == "" {
+		rootName = path.Base(strings.TrimSuffix(w.baseURL.Path, "/"))
+	}
+	root := &FileNode{
+		Name:     rootName,
+		IsDir:    true,
+		Children: make([]*FileNode, 0),
+	}
+
+	// Create a stack for iterative traversal
+	stack := []struct {
+		path   string
+		parent *FileNode
+	}{
+		{startPath, root},
+	}
+
+	// Process collections iteratively, one level per PROPFIND
+	for len(stack) > 0 && ctx.Err() == nil {
+		// Pop from stack
+		current := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		entries, err := w.propfind(ctx, current.path)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			// A failure on the start path means nothing can be listed
+			if current.parent == root && current.path == startPath {
+				w.log.Error("Failed to list start path: %v", err)
+				return err
+			}
+			w.errors.Add(current.path+"/", "list collection", err)
+			addNote(current.parent, fmt.Sprintf("not listed: %s", scanerr.Classify(err)))
+			continue
+		}
+
+		for _, entry := range entries {
+			node := entry.node
+			if !w.filter.Match(strings.TrimPrefix(strings.TrimPrefix(entry.path, startPath), "/"), node.IsDir) {
+				continue
+			}
+			current.parent.Children = append(current.parent.Children, node)
+
+			// If collection, add to stack
+			if node.IsDir {
+				node.Children = make([]*FileNode, 0)
+				stack = append(stack, struct {
+					path   string
+					parent *FileNode
+				}{entry.path, node})
+			}
+		}
+	}
+
+	// Display the tree
+	displayTree(root, 0)
+	return ctx.Err()
+}
+
+// davEntry pairs a listed node with its path relative to the base URL
+type davEntry struct {
+	path string
+	node *FileNode
+}
+
+// propfind lists the direct members of a collection using a Depth: 1 PROPFIND
+func (w *WebDAVSource) propfind(ctx context.Context, relPath string) ([]davEntry, error) {
+	target := w.resolve(relPath, true)
+	w.log.Debug("PROPFIND %s", target.String())
+
+	resp, err := w.do(ctx, "Listing "+target.Path, http.StatusMultiStatus, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "PROPFIND", target.String(), strings.NewReader(propfindBody))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create PROPFIND request: %v", err)
+		}
+		req.Header.Set("Depth", "1")
+		req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+		return req, nil
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("PROPFIND %s failed: %w", target.Path, err)
+	}
+	defer resp.Body.Close()
+
+	var ms davMultistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, scanerr.Decode(fmt.Errorf("failed to decode PROPFIND response: %v", err))
+	}
+
+	entries := make([]davEntry, 0, len(ms.Responses))
+	for _, r := range ms.Responses {
+		hrefPath, err := hrefToPath(r.Href)
+		if err != nil {
+			w.log.Error("Skipping invalid href %q: %v", r.Href, err)
+			continue
+		}
+
+		// Skip the collection itself, which is always part of a Depth: 1 response
+		if strings.TrimSuffix(hrefPath, "/") == strings.TrimSuffix(target.Path, "/") {
+			continue
+		}
+
+		// Keep only the properties the server returned successfully
+		var prop davProp
+		for _, ps := range r.Propstats {
+			if strings.Contains(ps.Status, " 200 ") {
+				prop = ps.Prop
+				break
+			}
+		}
+
+		node := &FileNode{
+			Name:  path.Base(strings.TrimSuffix(hrefPath, "/")),
+			IsDir: prop.ResourceType.Collection != nil,
+			ETag:  strings.Trim(prop.ETag, `"`),
+		}
+		if prop.ContentLength != "" {
+			if size, err := strconv.ParseInt(prop.ContentLength, 10, 64); err == nil {
+				node.Size = size
+			}
+		}
+		if prop.LastModified != "" {
+			if modTime, err := http.ParseTime(prop.LastModified); err == nil {
+				node.ModTime = modTime
+			}
+		}
+
+		entries = append(entries, davEntry{
+			path: strings.Trim(path.Join(relPath, node.Name), "/"),
+			node: node,
+		})
+	}
+
+	return entries, nil
+}
+
+// Walk calls fn for every file below startPath, one PROPFIND per collection
+func (w *WebDAVSource) Walk(ctx context.Context, startPath string, fn WalkFunc) error {
+	startPath = strings.Trim(startPath, "/")
+
+	stack := []string{startPath}
+	for len(stack) > 0 {
+		// Pop from stack
+		current := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		entries, err := w.propfind(ctx, current)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if current == startPath {
+				w.log.Error("Failed to list start path: %v", err)
+				return err
+			}
+			w.errors.AddUnlisted(current+"/", strings.TrimPrefix(strings.TrimPrefix(current, startPath), "/"), "list collection", err)
+			continue
+		}
+
+		for _, entry := range entries {
+			relPath := strings.TrimPrefix(strings.TrimPrefix(entry.path, startPath), "/")
+			if !w.filter.Match(relPath, entry.node.IsDir) {
+				continue
+			}
+			if entry.node.IsDir {
+				stack = append(stack, entry.path)
+				continue
+			}
+			if err := fn(FileInfo{
+				Path:    entry.path,
+				RelPath: relPath,
+				Size:    entry.node.Size,
+				ModTime: entry.node.ModTime,
+				ETag:    entry.node.ETag,
+			}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ReadFile downloads the content of a file on the WebDAV server
+func (w *WebDAVSource) ReadFile(ctx context.Context, filePath string) (io.ReadCloser, error) {
+	target := w.resolve(strings.Trim(filePath, "/"), false)
+
+	resp, err := w.do(ctx, "Downloading "+filePath, http.StatusOK, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create GET request: %v", err)
+		}
+		return req, nil
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("failed to download %s: %w", filePath, err)
+	}
+
+	return resp.Body, nil
+}
+
+// do sends the request built by newRequest, retrying transient failures, and returns
+// the response if it has the wanted status. The request is rebuilt for every attempt
+// because its body is consumed by sending it.
+func (w *WebDAVSource) do(ctx context.Context, op string, want int, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	var resp *http.Response
+	err := w.retry.Do(ctx, op, func() error {
+		req, err := newRequest()
+		if err != nil {
+			return err
+		}
+		w.authorize(req)
+
+		resp, err = w.client.Do(req)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != want {
+			resp.Body.Close()
+			return retry.NewStatusError(resp, fmt.Errorf("%s returned %s", req.Method, resp.Status))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Errors returns the collections that could not be listed and files that could not be read
+func (w *WebDAVSource) Errors() *scanerr.Log {
+	return w.errors
+}
+
+// GetName returns the source name
+func (w *WebDAVSource) GetName() string {
+	return "webdav"
+}
+
+// resolve builds the URL of a path relative to the base URL
+func (w *WebDAVSource) resolve(relPath string, collection bool) *url.URL {
+	target := *w.baseURL
+	target.Path = path.Join(w.baseURL.Path, relPath)
+	if collection && !strings.HasSuffix(target.Path, "/") {
+		target.Path += "/"
+	}
+	return &target
+}
+
+// authorize adds bearer or basic credentials to a request
+func (w *WebDAVSource) authorize(req *http.Request) {
+	if w.token != "" {
+		req.Header.Set("Authorization", "Bearer "+w.token)
+	} else if w.username != "" {
+		req.SetBasicAuth(w.username, w.password)
+	}
+}
+
+// hrefToPath returns the unescaped path of an href, which may be absolute or relative
+func hrefToPath(href string) (string, error) {
+	u, err := url.Parse(href)
+	if err != nil {
+		return "", err
+	}
+	return u.Path, nil
+}
@@ -0,0 +1,51 @@
+package source
+
+import (
+	"bytes"
+	"errors"
+	"syscall"
+)
+
+// listXattrs returns the names of the extended attributes of a file
+func listXattrs(path string) ([]string, error) {
+	size, err := syscall.Listxattr(path, nil)
+	if err != nil || size == 0 {
+		return nil, ignoreUnsupported(err)
+	}
+	buf := make([]byte, size)
+	size, err = syscall.Listxattr(path, buf)
+	if err != nil {
+		return nil, ignoreUnsupported(err)
+	}
+
+	// Names are NUL terminated
+	var names []string
+	for _, name := range bytes.Split(buf[:size], []byte{0}) {
+		if len(name) > 0 {
+			names = append(names, string(name))
+		}
+	}
+	return names, nil
+}
+
+// getXattr returns the value of an extended attribute of a file
+func getXattr(path, name string) ([]byte, error) {
+	size, err := syscall.Getxattr(path, name, nil)
+	if err != nil || size == 0 {
+		return nil, ignoreUnsupported(err)
+	}
+	buf := make([]byte, size)
+	size, err = syscall.Getxattr(path, name, buf)
+	if err != nil {
+		return nil, ignoreUnsupported(err)
+	}
+	return buf[:size], nil
+}
+
+// ignoreUnsupported treats filesystems without extended attributes as files without any
+func ignoreUnsupported(err error) error {
+	if errors.Is(err, syscall.ENOTSUP) || errors.Is(err, syscall.ENODATA) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,111 @@
+package state
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/adaptive-scale/superscan/pkg/config"
+	"github.com/adaptive-scale/superscan/pkg/detector"
+	"github.com/adaptive-scale/superscan/pkg/scanerr"
+)
+
+// Checkpoint is the progress of a scan, saved periodically so that an interrupted
+// scan can continue where it stopped instead of starting over
+type Checkpoint struct {
+	ID         string `json:"id"`
+	SourceType string `json:"source_type"`
+	StartPath  string `json:"start_path"`
+	// ConfigPath is the configuration file the scan was started with, if any
+	ConfigPath string `json:"config_path,omitempty"`
+	// Filters are the include and exclude filters the scan was started with, so that
+	// a resumed scan walks the same files
+	Filters config.FiltersConfig `json:"filters"`
+	// FileSystem is how the local filesystem was traversed, for the same reason
+	FileSystem config.FileSystemConfig `json:"filesystem"`
+	// Seed is the sampling seed of the scan, so that every run of it samples the same rows
+	Seed int64 `json:"seed,omitempty"`
+	// Cursor is the source's position in its listing; every file before it has been scanned
+	Cursor   string             `json:"cursor,omitempty"`
+	Scanned  int                `json:"scanned"`
+	Failed   int                `json:"failed"`
+	Findings []detector.Finding `json:"findings,omitempty"`
+	// Errors are the paths that could not be listed, read or decoded
+	Errors []scanerr.PathError `json:"errors,omitempty"`
+	// Done is set once the whole source has been scanned
+	Done      bool      `json:"done"`
+	StartedAt time.Time `json:"started_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// DefaultCheckpointDir returns the default directory of scan checkpoints
+func DefaultCheckpointDir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %v", err)
+	}
+	return filepath.Join(homeDir, ".superscan", "scans"), nil
+}
+
+// NewCheckpoint starts the checkpoint of a new scan with a fresh ID
+func NewCheckpoint(sourceType, startPath, configPath string) *Checkpoint {
+	suffix := make([]byte, 3)
+	rand.Read(suffix)
+	now := time.Now()
+	return &Checkpoint{
+		ID:         now.Format("20060102-150405") + "-" + hex.EncodeToString(suffix),
+		SourceType: sourceType,
+		StartPath:  startPath,
+		ConfigPath: configPath,
+		StartedAt:  now,
+	}
+}
+
+// LoadCheckpoint reads the checkpoint of a scan from dir
+func LoadCheckpoint(dir, id string) (*Checkpoint, error) {
+	data, err := os.ReadFile(checkpointPath(dir, id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("no checkpoint for scan %s in %s", id, dir)
+		}
+		return nil, fmt.Errorf("failed to read checkpoint of scan %s: %v", id, err)
+	}
+	var cp Checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint of scan %s: %v", id, err)
+	}
+	return &cp, nil
+}
+
+// Save writes the checkpoint to dir. The file is replaced atomically, so a scan
+// killed while saving keeps its previous checkpoint.
+func (c *Checkpoint) Save(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create checkpoint directory: %v", err)
+	}
+	c.UpdatedAt = time.Now()
+	data, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint: %v", err)
+	}
+
+	path := checkpointPath(dir, c.ID)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write checkpoint: %v", err)
+	}
+	return nil
+}
+
+// checkpointPath returns the file of a scan's checkpoint
+func checkpointPath(dir, id string) string {
+	return filepath.Join(dir, filepath.Base(id)+".json")
+}
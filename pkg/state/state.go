@@ -0,0 +1,228 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/adaptive-scale/superscan/pkg/detector"
+	"github.com/adaptive-scale/superscan/pkg/logger"
+	bolt "go.etcd.io/bbolt"
+)
+
+// flushEvery is how many buffered records are written in one transaction
+const flushEvery = 1000
+
+// tokensBucket holds the change feed tokens of sources, apart from their records
+const tokensBucket = "change_tokens"
+
+// Record is what is remembered about a file after scanning it
+type Record struct {
+	// RelPath is the file's path below the start path, for reports
+	RelPath string    `json:"rel_path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	ETag    string    `json:"etag,omitempty"`
+	// ScannedAt is when the file was last scanned
+	ScannedAt time.Time          `json:"scanned_at"`
+	Findings  []detector.Finding `json:"findings,omitempty"`
+	// Folder marks a folder listed by a change feed, recorded so that the files below
+	// it can be forgotten when it is removed
+	Folder bool `json:"folder,omitempty"`
+}
+
+// Changed reports whether a file with the given size, modification time and ETag
+// differs from the recorded one. ETags are compared when both are known, since
+// some providers change modification times without changing content.
+func (r Record) Changed(size int64, modTime time.Time, etag string) bool {
+	if r.Size != size {
+		return true
+	}
+	if r.ETag != "" && etag != "" {
+		return r.ETag != etag
+	}
+	return !r.ModTime.Equal(modTime)
+}
+
+// Store is a local database of scanned files, with one bucket per source
+type Store struct {
+	db      *bolt.DB
+	pending map[string]map[string][]byte
+	count   int
+	log     *logger.Logger
+}
+
+// DefaultPath returns the default location of the state database
+func DefaultPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %v", err)
+	}
+	return filepath.Join(homeDir, ".superscan", "state.db"), nil
+}
+
+// Open opens or creates the state database at path
+func Open(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create state directory: %v", err)
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state database %s: %v", path, err)
+	}
+	return &Store{
+		db:      db,
+		pending: make(map[string]map[string][]byte),
+		log:     logger.New(logger.INFO),
+	}, nil
+}
+
+// Get returns the record of a file of a source, if it was scanned before
+func (s *Store) Get(source, path string) (Record, bool, error) {
+	var record Record
+	var found bool
+	if data, ok := s.pending[source][path]; ok {
+		if data == nil {
+			return record, false, nil
+		}
+		return record, true, json.Unmarshal(data, &record)
+	}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(source))
+		if b == nil {
+			return nil
+		}
+		data := b.Get([]byte(path))
+		if data == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(data, &record)
+	})
+	if err != nil {
+		return record, false, fmt.Errorf("failed to read state of %s: %v", path, err)
+	}
+	return record, found, nil
+}
+
+// Put records a scanned file. Writes are buffered; call Flush or Close to persist them.
+func (s *Store) Put(source, path string, record Record) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode state of %s: %v", path, err)
+	}
+	return s.buffer(source, path, data)
+}
+
+// Delete forgets a file that no longer exists
+func (s *Store) Delete(source, path string) error {
+	return s.buffer(source, path, nil)
+}
+
+// buffer queues a write, nil data meaning a deletion, and flushes full buffers
+func (s *Store) buffer(source, path string, data []byte) error {
+	if s.pending[source] == nil {
+		s.pending[source] = make(map[string][]byte)
+	}
+	s.pending[source][path] = data
+	s.count++
+	if s.count >= flushEvery {
+		return s.Flush()
+	}
+	return nil
+}
+
+// Paths calls fn with every recorded path of a source. fn must not modify the store.
+func (s *Store) Paths(source string, fn func(path string) error) error {
+	if err := s.Flush(); err != nil {
+		return err
+	}
+	return s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(source))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, _ []byte) error {
+			return fn(string(k))
+		})
+	})
+}
+
+// Flush writes buffered records in a single transaction
+func (s *Store) Flush() error {
+	if s.count == 0 {
+		return nil
+	}
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		for source, records := range s.pending {
+			b, err := tx.CreateBucketIfNotExists([]byte(source))
+			if err != nil {
+				return err
+			}
+			for path, data := range records {
+				if data == nil {
+					err = b.Delete([]byte(path))
+				} else {
+					err = b.Put([]byte(path), data)
+				}
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		s.log.Error("Failed to write state: %v", err)
+		return fmt.Errorf("failed to write state: %v", err)
+	}
+	s.pending = make(map[string]map[string][]byte)
+	s.count = 0
+	return nil
+}
+
+// Token returns the change feed token saved under key, or "" if there is none
+func (s *Store) Token(key string) (string, error) {
+	var token string
+	err := s.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte(tokensBucket)); b != nil {
+			token = string(b.Get([]byte(key)))
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to read change token: %v", err)
+	}
+	return token, nil
+}
+
+// SetToken saves a change feed token under key, after flushing buffered records so
+// that the token never gets ahead of them
+func (s *Store) SetToken(key, token string) error {
+	if err := s.Flush(); err != nil {
+		return err
+	}
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(tokensBucket))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(key), []byte(token))
+	})
+	if err != nil {
+		s.log.Error("Failed to write change token: %v", err)
+		return fmt.Errorf("failed to write change token: %v", err)
+	}
+	return nil
+}
+
+// Close flushes buffered records and closes the database
+func (s *Store) Close() error {
+	flushErr := s.Flush()
+	if err := s.db.Close(); err != nil {
+		return fmt.Errorf("failed to close state database: %v", err)
+	}
+	return flushErr
+}
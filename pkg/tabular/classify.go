@@ -0,0 +1,284 @@
+package tabular
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/adaptive-scale/superscan/pkg/computation"
+)
+
+// DefaultSampleRows is how many rows are sampled to classify columns
+const DefaultSampleRows = 1000
+
+// MinHitRate is the smallest share of sampled values that must match for a class to be reported
+const MinHitRate = 0.2
+
+// Column classes
+const (
+	ClassEmail      = "email"
+	ClassName       = "name"
+	ClassPhone      = "phone"
+	ClassNationalID = "national-id"
+	ClassFreeText   = "free-text"
+)
+
+// ClassHit is how often a column's sampled values matched a class
+type ClassHit struct {
+	Class string
+	Hits  int
+	// Rate is Hits divided by the number of non-empty sampled values
+	Rate float64
+	// Example is one matching value
+	Example string
+}
+
+// ColumnReport describes the inferred schema and classification of one column
+type ColumnReport struct {
+	Name string
+	// Type is the inferred value type: integer, float, boolean, date, string or empty
+	Type string
+	// Sampled is the number of sampled rows, NonEmpty how many of them had a value
+	Sampled  int
+	NonEmpty int
+	// Classes holds every class reaching MinHitRate, highest rate first
+	Classes []ClassHit
+}
+
+// classifier decides whether a value belongs to a class. hinted is set when the
+// column name suggests the class, which allows looser value checks.
+type classifier struct {
+	class string
+	hint  *regexp.Regexp
+	match func(value string, hinted bool) bool
+}
+
+var (
+	emailPattern    = regexp.MustCompile(`^[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}$`)
+	phonePattern    = regexp.MustCompile(`^\+?[0-9(][0-9 ().\-]{5,}[0-9]$`)
+	ssnPattern      = regexp.MustCompile(`^(\d{3})-(\d{2})-(\d{4})$`)
+	ninoPattern     = regexp.MustCompile(`^[A-CEGHJ-PR-TW-Z][A-CEGHJ-NPR-TW-Z] ?\d{2} ?\d{2} ?\d{2} ?[A-D]$`)
+	sinPattern      = regexp.MustCompile(`^\d{3}[ -]\d{3}[ -]\d{3}$`)
+	aadhaarPattern  = regexp.MustCompile(`^[2-9]\d{3} \d{4} \d{4}$`)
+	digitsPattern   = regexp.MustCompile(`^\d{9,12}$`)
+	namePartPattern = regexp.MustCompile(`^\p{Lu}[\p{L}'\-.]*$`)
+)
+
+// classifiers are evaluated against every sampled value
+var classifiers = []classifier{
+	{
+		class: ClassEmail,
+		hint:  regexp.MustCompile(`(?i)e-?mail`),
+		match: func(v string, _ bool) bool { return emailPattern.MatchString(v) },
+	},
+	{
+		class: ClassPhone,
+		hint:  regexp.MustCompile(`(?i)phone|mobile|^tel|_tel|cell|fax|msisdn`),
+		match: isPhone,
+	},
+	{
+		class: ClassNationalID,
+		hint:  regexp.MustCompile(`(?i)ssn|social.?security|national.?id|nino|^sin$|tax.?id|(^|_)tin$|aadhaar|passport`),
+		match: isNationalID,
+	},
+	{
+		class: ClassName,
+		hint:  regexp.MustCompile(`(?i)name|surname|customer|contact|person|owner`),
+		match: isName,
+	},
+	{
+		class: ClassFreeText,
+		match: isFreeText,
+	},
+}
+
+// Classify infers the type of every column and how often its values look like
+// personal data, from a random sample of up to sampleRows rows drawn by sampler.
+func Classify(table *Table, sampleRows int, sampler *computation.Sampler) []ColumnReport {
+	if sampleRows <= 0 {
+		sampleRows = DefaultSampleRows
+	}
+	var sample [][]string
+	if sampler != nil {
+		sample = computation.SelectRandomWith(sampler, table.Rows, sampleRows)
+	} else {
+		sample = computation.SelectRandom(table.Rows, sampleRows)
+	}
+
+	reports := make([]ColumnReport, 0, len(table.Columns))
+	for col, name := range table.Columns {
+		// Collect the sampled values of this column
+		values := make([]string, 0, len(sample))
+		for _, row := range sample {
+			if col < len(row) {
+				if v := strings.TrimSpace(row[col]); v != "" {
+					values = append(values, v)
+				}
+			}
+		}
+
+		report := ColumnReport{
+			Name:     name,
+			Type:     inferType(values),
+			Sampled:  len(sample),
+			NonEmpty: len(values),
+		}
+
+		for _, c := range classifiers {
+			hinted := c.hint != nil && c.hint.MatchString(name)
+			hit := ClassHit{Class: c.class}
+			for _, v := range values {
+				if c.match(v, hinted) {
+					hit.Hits++
+					if hit.Example == "" {
+						hit.Example = v
+					}
+				}
+			}
+			if len(values) > 0 {
+				hit.Rate = float64(hit.Hits) / float64(len(values))
+			}
+			if hit.Hits > 0 && hit.Rate >= MinHitRate {
+				report.Classes = append(report.Classes, hit)
+			}
+		}
+		sort.SliceStable(report.Classes, func(i, j int) bool {
+			return report.Classes[i].Rate > report.Classes[j].Rate
+		})
+
+		reports = append(reports, report)
+	}
+	return reports
+}
+
+// inferType returns the narrowest type every value parses as
+func inferType(values []string) string {
+	if len(values) == 0 {
+		return "empty"
+	}
+	types := []struct {
+		name  string
+		parse func(string) bool
+	}{
+		{"integer", func(v string) bool { _, err := strconv.ParseInt(v, 10, 64); return err == nil }},
+		{"float", func(v string) bool { _, err := strconv.ParseFloat(v, 64); return err == nil }},
+		{"boolean", func(v string) bool { _, err := strconv.ParseBool(v); return err == nil }},
+		{"date", isDate},
+	}
+	for _, t := range types {
+		all := true
+		for _, v := range values {
+			if !t.parse(v) {
+				all = false
+				break
+			}
+		}
+		if all {
+			return t.name
+		}
+	}
+	return "string"
+}
+
+// dateLayouts are the date formats recognised by inferType
+var dateLayouts = []string{time.RFC3339Nano, "2006-01-02", "2006-01-02 15:04:05", "2006/01/02", "01/02/2006", "02.01.2006"}
+
+// isDate reports whether a value parses as a date
+func isDate(v string) bool {
+	for _, layout := range dateLayouts {
+		if _, err := time.Parse(layout, v); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// isPhone reports whether a value looks like a phone number. Bare digit strings
+// only count in columns named like phone numbers.
+func isPhone(v string, hinted bool) bool {
+	digits := 0
+	for _, r := range v {
+		if unicode.IsDigit(r) {
+			digits++
+		}
+	}
+	if digits < 7 || digits > 15 {
+		return false
+	}
+	if !phonePattern.MatchString(v) || isNationalID(v, false) {
+		return false
+	}
+	if hinted {
+		return true
+	}
+	// Without a hint require formatting that plain numbers do not have
+	return strings.HasPrefix(v, "+") || (strings.ContainsAny(v, " ()-.") && !isDate(v))
+}
+
+// isNationalID reports whether a value looks like a US SSN, UK National Insurance
+// number, Canadian SIN or Indian Aadhaar number
+func isNationalID(v string, hinted bool) bool {
+	if m := ssnPattern.FindStringSubmatch(v); m != nil {
+		// Area 000, 666 and 900-999, group 00 and serial 0000 are never issued
+		return m[1] != "000" && m[1] != "666" && m[1][0] != '9' && m[2] != "00" && m[3] != "0000"
+	}
+	if ninoPattern.MatchString(strings.ToUpper(v)) {
+		return true
+	}
+	if sinPattern.MatchString(v) {
+		return luhn(v)
+	}
+	if aadhaarPattern.MatchString(v) {
+		return true
+	}
+	// Unformatted numbers only count in columns named like identifiers
+	return hinted && digitsPattern.MatchString(v)
+}
+
+// isName reports whether a value looks like a person's name: capitalised words,
+// two to four of them, or one to four in a column named like a name
+func isName(v string, hinted bool) bool {
+	parts := strings.Fields(v)
+	min := 2
+	if hinted {
+		min = 1
+	}
+	if len(parts) < min || len(parts) > 4 {
+		return false
+	}
+	for _, p := range parts {
+		if !namePartPattern.MatchString(p) {
+			return false
+		}
+	}
+	return true
+}
+
+// isFreeText reports whether a value is prose rather than a structured field
+func isFreeText(v string, _ bool) bool {
+	return len(v) >= 30 && len(strings.Fields(v)) >= 5
+}
+
+// luhn validates the Luhn checksum of the digits in a value
+func luhn(v string) bool {
+	sum, double := 0, false
+	for i := len(v) - 1; i >= 0; i-- {
+		c := v[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
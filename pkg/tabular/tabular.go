@@ -0,0 +1,225 @@
+package tabular
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// Table is tabular data read from a structured file
+type Table struct {
+	Columns []string
+	Rows    [][]string
+}
+
+// readers maps lower case file extensions to their table reader
+var readers = map[string]func([]byte) (*Table, error){
+	".csv":     readCSV,
+	".tsv":     readTSV,
+	".jsonl":   readJSONLines,
+	".ndjson":  readJSONLines,
+	".parquet": readParquet,
+}
+
+// Supported reports whether a file with this name can be read as a table
+func Supported(name string) bool {
+	_, ok := readers[strings.ToLower(filepath.Ext(name))]
+	return ok
+}
+
+// Read parses structured data into a table
+func Read(name string, data []byte) (*Table, error) {
+	reader, ok := readers[strings.ToLower(filepath.Ext(name))]
+	if !ok {
+		return nil, fmt.Errorf("unsupported table format: %s", name)
+	}
+	return reader(data)
+}
+
+// readCSV reads comma separated values with a header row
+func readCSV(data []byte) (*Table, error) {
+	return readDelimited(data, ',')
+}
+
+// readTSV reads tab separated values with a header row
+func readTSV(data []byte) (*Table, error) {
+	return readDelimited(data, '\t')
+}
+
+// readDelimited reads delimited records, using the first record as column names
+func readDelimited(data []byte, comma rune) (*Table, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.Comma = comma
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	r.ReuseRecord = false
+
+	table := &Table{}
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return table, fmt.Errorf("failed to parse record: %v", err)
+		}
+
+		// First record is the header
+		if table.Columns == nil {
+			table.Columns = make([]string, len(record))
+			for i, name := range record {
+				table.Columns[i] = columnName(strings.TrimSpace(name), i)
+			}
+			continue
+		}
+
+		// Widen the header for rows with extra fields
+		for len(table.Columns) < len(record) {
+			table.Columns = append(table.Columns, columnName("", len(table.Columns)))
+		}
+		table.Rows = append(table.Rows, record)
+	}
+	return table, nil
+}
+
+// readJSONLines reads one JSON object per line. Nested objects are flattened
+// into dotted column names and arrays are kept as JSON text.
+func readJSONLines(data []byte) (*Table, error) {
+	table := &Table{}
+	index := make(map[string]int)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), len(data)+1)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+
+		d := json.NewDecoder(bytes.NewReader(text))
+		d.UseNumber()
+		var object map[string]interface{}
+		if err := d.Decode(&object); err != nil {
+			return table, fmt.Errorf("failed to parse line %d: %v", line, err)
+		}
+
+		fields := make(map[string]string)
+		flatten("", object, fields)
+
+		// Columns are ordered by first appearance, keys of one object alphabetically
+		keys := make([]string, 0, len(fields))
+		for k := range fields {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if _, ok := index[k]; !ok {
+				index[k] = len(table.Columns)
+				table.Columns = append(table.Columns, k)
+			}
+		}
+
+		row := make([]string, len(table.Columns))
+		for k, v := range fields {
+			row[index[k]] = v
+		}
+		table.Rows = append(table.Rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return table, fmt.Errorf("failed to read lines: %v", err)
+	}
+	return table, nil
+}
+
+// flatten converts a decoded JSON object into dotted column names and string values
+func flatten(prefix string, object map[string]interface{}, fields map[string]string) {
+	for k, v := range object {
+		name := k
+		if prefix != "" {
+			name = prefix + "." + k
+		}
+		switch value := v.(type) {
+		case nil:
+			fields[name] = ""
+		case string:
+			fields[name] = value
+		case json.Number:
+			fields[name] = value.String()
+		case bool:
+			fields[name] = fmt.Sprintf("%t", value)
+		case map[string]interface{}:
+			flatten(name, value, fields)
+		default:
+			encoded, _ := json.Marshal(value)
+			fields[name] = string(encoded)
+		}
+	}
+}
+
+// readParquet reads every row group of a Parquet file. Each leaf column becomes a
+// column named by its dotted path; repeated values are joined with commas.
+func readParquet(data []byte) (*Table, error) {
+	f, err := parquet.OpenFile(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open parquet file: %v", err)
+	}
+
+	table := &Table{}
+	for _, path := range f.Schema().Columns() {
+		table.Columns = append(table.Columns, strings.Join(path, "."))
+	}
+
+	buf := make([]parquet.Row, 256)
+	for _, rowGroup := range f.RowGroups() {
+		rows := rowGroup.Rows()
+		for {
+			n, err := rows.ReadRows(buf)
+			for _, row := range buf[:n] {
+				table.Rows = append(table.Rows, parquetRow(row, len(table.Columns)))
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				rows.Close()
+				return table, fmt.Errorf("failed to read parquet rows: %v", err)
+			}
+		}
+		rows.Close()
+	}
+	return table, nil
+}
+
+// parquetRow converts a Parquet row into one string per leaf column
+func parquetRow(row parquet.Row, columns int) []string {
+	values := make([]string, columns)
+	for _, v := range row {
+		col := v.Column()
+		if v.IsNull() || col < 0 || col >= columns {
+			continue
+		}
+		if values[col] != "" {
+			values[col] += ","
+		}
+		values[col] += v.String()
+	}
+	return values
+}
+
+// columnName returns a header name, or a positional name for an empty header
+func columnName(name string, index int) string {
+	if name == "" {
+		return fmt.Sprintf("column %d", index+1)
+	}
+	return name
+}
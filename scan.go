@@ -0,0 +1,129 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/adaptive-scale/superscan/pkg/config"
+	"github.com/adaptive-scale/superscan/pkg/source"
+	"github.com/adaptive-scale/superscan/pkg/state"
+)
+
+// runScan implements the scan command, which scans the content of every file of a
+// source with checkpoints, so an interrupted scan can be resumed
+func runScan(args []string) {
+	fs := flag.NewFlagSet("scan", flag.ExitOnError)
+	sourceTypeStr := fs.String("source-type", "filesystem", "Type of source (filesystem|gdrive|s3|gcs|webdav|smb|git|image)")
+	startPath := fs.String("start-path", "/", "Starting path for scanning (default: /)")
+	configPath := fs.String("config", "", "Path to configuration file (optional)")
+	resume := fs.String("resume", "", "ID of an interrupted scan to continue")
+	interval := fs.Duration("checkpoint-interval", source.DefaultCheckpointInterval, "Minimum time between two checkpoints")
+	timeout := fs.Duration("timeout", 0, "Stop after this long, saving a checkpoint to resume from, e.g. 8h (default: no limit)")
+	checkpointDir := fs.String("checkpoint-dir", "", "Directory of scan checkpoints (default from config, or ~/.superscan/scans)")
+	applyFilters := filterFlags(fs)
+	fs.Parse(args)
+
+	// Load configuration if a file was given
+	var cfg *config.Config
+	if *configPath != "" {
+		var err error
+		cfg, err = config.LoadConfig(*configPath)
+		if err != nil {
+			fmt.Printf("Error loading config: %v\n", err)
+			os.Exit(1)
+		}
+		// Remember the configuration by absolute path, as a resume may run elsewhere
+		if abs, err := filepath.Abs(*configPath); err == nil {
+			*configPath = abs
+		}
+	}
+	dir, err := checkpointDirectory(*checkpointDir, cfg)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	var cp *state.Checkpoint
+	if *resume != "" {
+		if cp, err = state.LoadCheckpoint(dir, *resume); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if cp.Done {
+			fmt.Printf("Error: scan %s already finished\n", cp.ID)
+			os.Exit(1)
+		}
+		// Continue with the configuration the scan was started with
+		if cfg == nil && cp.ConfigPath != "" {
+			if cfg, err = config.LoadConfig(cp.ConfigPath); err != nil {
+				fmt.Printf("Error loading config: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		// and its filters and traversal options, as the cursor depends on which files were walked
+		if cfg == nil {
+			cfg = &config.Config{}
+			config.ApplyEnv(cfg)
+		}
+		cfg.Filters = cp.Filters
+		cfg.FileSystem = cp.FileSystem
+	} else {
+		var sourceType source.SourceType
+		if err := sourceType.Set(*sourceTypeStr); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			fs.Usage()
+			os.Exit(1)
+		}
+		// Local start paths are stored absolute for the same reason
+		if sourceType == source.FileSystem {
+			if abs, err := filepath.Abs(*startPath); err == nil {
+				*startPath = abs
+			}
+		}
+		cp = state.NewCheckpoint(*sourceTypeStr, *startPath, *configPath)
+		if cfg = applyFilters(cfg); cfg != nil {
+			cp.Filters = cfg.Filters
+			cp.FileSystem = cfg.FileSystem
+			cp.Seed = cfg.Sampling.Seed
+		}
+	}
+
+	// Stop on SIGINT, SIGTERM or timeout, saving a checkpoint
+	ctx, cancel := commandContext(*timeout)
+	defer cancel()
+
+	src, err := source.NewSource(ctx, cp.SourceType, cfg)
+	if err != nil {
+		exitError("creating source", err)
+	}
+
+	if *resume != "" {
+		fmt.Printf("Resuming scan %s after %d files\n", cp.ID, cp.Scanned)
+	} else {
+		fmt.Printf("Starting scan %s\n", cp.ID)
+	}
+	err = source.FullScan(ctx, src, cp, source.ScanOptions{
+		Dir:      dir,
+		Interval: *interval,
+	})
+	closeSources(src)
+	if err != nil {
+		exitError("scanning files", err)
+	}
+	if len(cp.Errors) > 0 {
+		os.Exit(exitIncomplete)
+	}
+}
+
+// checkpointDirectory returns the checkpoint directory given by flag, config or default
+func checkpointDirectory(flagDir string, cfg *config.Config) (string, error) {
+	if flagDir != "" {
+		return flagDir, nil
+	}
+	if cfg != nil && cfg.State.Checkpoints != "" {
+		return cfg.State.Checkpoints, nil
+	}
+	return state.DefaultCheckpointDir()
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/adaptive-scale/superscan/pkg/computation"
+	"github.com/adaptive-scale/superscan/pkg/config"
+	"github.com/adaptive-scale/superscan/pkg/similar"
+	"github.com/adaptive-scale/superscan/pkg/source"
+)
+
+// runSimilar implements the similar command, which clusters near duplicate files across sources
+func runSimilar(args []string) {
+	fs := flag.NewFlagSet("similar", flag.ExitOnError)
+	var sources stringList
+	fs.Var(&sources, "source", "Source to search as type:path, e.g. filesystem:/data or s3:logs/ (repeatable)")
+	threshold := fs.Float64("threshold", computation.DefaultSimilarity, "Minimum similarity (0-1) of a file to its cluster's representative")
+	metadataOnly := fs.Bool("metadata-only", false, "Compare files by type, extension and size without reading them")
+	images := fs.Bool("images", false, "Compare images by how they look rather than by their bytes")
+	configPath := fs.String("config", "", "Path to configuration file (optional)")
+	timeout := fs.Duration("timeout", 0, "Stop after this long, clustering the files listed so far, e.g. 30m (default: no limit)")
+	applyFilters := filterFlags(fs)
+	fs.Parse(args)
+
+	if len(sources) == 0 {
+		fmt.Println("Error: at least one --source is required")
+		fs.Usage()
+		os.Exit(1)
+	}
+	if *threshold <= 0 || *threshold > 1 {
+		fmt.Println("Error: --threshold must be between 0 and 1")
+		os.Exit(1)
+	}
+
+	// Load configuration if a file was given
+	var cfg *config.Config
+	if *configPath != "" {
+		var err error
+		cfg, err = config.LoadConfig(*configPath)
+		if err != nil {
+			fmt.Printf("Error loading config: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	cfg = applyFilters(cfg)
+
+	ctx, cancel := commandContext(*timeout)
+	defer cancel()
+
+	// Create a source for every target
+	var targets []similar.Target
+	for _, spec := range sources {
+		src, startPath, err := openSource(ctx, spec, cfg)
+		if err != nil {
+			fmt.Printf("Error creating source: %v\n", err)
+			os.Exit(1)
+		}
+		targets = append(targets, similar.Target{
+			Label:     spec,
+			Source:    src,
+			StartPath: startPath,
+		})
+	}
+
+	finder := similar.NewFinder(*threshold, *metadataOnly)
+	finder.SetImages(*images)
+	clusters, err := finder.Find(ctx, targets)
+	var opened []source.Source
+	for _, t := range targets {
+		opened = append(opened, t.Source)
+	}
+	closeSources(opened...)
+	if err != nil && clusters == nil {
+		exitError("finding similar files", err)
+	}
+	similar.Display(clusters)
+	incomplete := reportErrors(opened...)
+	if err != nil {
+		exitError("finding similar files", err)
+	}
+	if incomplete {
+		os.Exit(exitIncomplete)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/adaptive-scale/superscan/pkg/config"
+	"github.com/adaptive-scale/superscan/pkg/source"
+)
+
+// runWatch implements the watch command, which scans local files as they are created
+// and modified
+func runWatch(args []string) {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	startPath := fs.String("start-path", "", "Directory to watch, including its subdirectories (required)")
+	configPath := fs.String("config", "", "Path to configuration file (optional)")
+	debounce := fs.Duration("debounce", source.DefaultDebounce, "How long a file must stay unchanged before it is scanned")
+	scanExisting := fs.Bool("scan-existing", false, "Scan the files already present before watching for changes")
+	timeout := fs.Duration("timeout", 0, "Stop watching after this long, e.g. 8h (default: until interrupted)")
+	applyFilters := filterFlags(fs)
+	fs.Parse(args)
+
+	if *startPath == "" {
+		fmt.Println("Error: --start-path is required")
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	// Load configuration if a file was given
+	var cfg *config.Config
+	if *configPath != "" {
+		var err error
+		cfg, err = config.LoadConfig(*configPath)
+		if err != nil {
+			fmt.Printf("Error loading config: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	cfg = applyFilters(cfg)
+
+	ctx, cancel := commandContext(*timeout)
+	defer cancel()
+
+	src, err := source.NewSource(ctx, string(source.FileSystem), cfg)
+	if err != nil {
+		exitError("creating source", err)
+	}
+	opts := source.WatchOptions{
+		Debounce:     *debounce,
+		ScanExisting: *scanExisting,
+	}
+	if cfg != nil {
+		opts.Seed = cfg.Sampling.Seed
+	}
+	err = src.(source.Watcher).Watch(ctx, *startPath, opts)
+	// Watching until the timeout is how a bounded watch ends, not a failure
+	if errors.Is(err, context.DeadlineExceeded) {
+		err = nil
+	}
+	incomplete := reportErrors(src)
+	if err != nil {
+		exitError("watching files", err)
+	}
+	if incomplete {
+		os.Exit(exitIncomplete)
+	}
+}